@@ -1,134 +1,429 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
-	goelasticmigrator "github.com/xoticdsign/go-elasticmigrator"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/esconn"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/migrator"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
 )
 
 var (
-	ErrEnvsMustBeSpecified = fmt.Errorf("you have to specify the envs")
+	ErrUnknownCommand = fmt.Errorf("unknown command, expected up, down, status, plan, to <version>, baseline <version>, reindex [script] or alias [version]")
+	ErrNoNodes        = fmt.Errorf("no elasticsearch node is set (ES_ADDRESS or ES_ADDRESSES), the migrator needs one whatever the backend")
 )
 
-// getEnv() retrieves the necessary environment variables required for migration.
-// These environment variables must be set before running the application. The function ensures
-// all variables are present and returns an error if any are missing.
+const usage = `usage: esmigrator [-env ENV] [-config PATH] [-es-address ADDRESSES] <command>
+
+commands:
+  up            apply all the pending migrations
+  down          roll back the last applied migration
+  status        print the state of every migration
+  plan          print what up would do: the differences between the live index and its definition,
+                the pending migrations and the documents they would change, without writing anything
+  to <version>  apply or roll back the migrations up to the version, 0 rolls back all of them
+  baseline <version>
+                record the pending migrations up to the version as applied, without running them
+  reindex [script]
+                copy the documents to a new version of the index created from its definition, transformed by
+                the Painless script in the file, if any, and move the alias to it once the counts match
+  alias [version]
+                print the versions of the index, or move the alias to the version, e.g. to roll back a reindex
+
+upgrading a deployment created before the migrations:
+  its products index already exists, so the migrations creating and loading it would fail. Check with plan that
+  the index matches its definition, record those migrations with "esmigrator baseline 2", then apply the later
+  ones with up. The index isn't versioned until the first reindex puts it behind the alias: the reindex clones it
+  to products_v0 before the swap deletes it, so "esmigrator alias 0" rolls back to the original data.
+
+the search cache isn't purged by the migrator: the changes are searched once the cached results expire, within
+search.cache.ttl, or after DELETE /admin/cache on every SimpleSearch instance.`
+
+// getEnv() retrieves the environment variables of the migrator.
 //
 // Environment Variables (envs) explained:
-//   - DIRECTION: This environment variable specifies the direction of the migration.
-//     It can either be "up" or "down" and determines whether the migration should be applied
-//     or reverted. If not set, the program will throw an error.
-//   - MIGRATIONS: This variable holds the path or identifier for the migration scripts or
-//     configurations. It is critical for the program to know where to look for migration files.
-//   - MIGRATE_DOWN_WITH_INDEX: A flag (true/false) indicating if the index should be removed
-//     when rolling back a migration (down migration). If not provided, an error will occur.
-//   - ADDRESS: The address (URL) of the Elasticsearch server. This is used to connect to the
-//     server for performing migration operations. Without this, the connection cannot be established.
-//   - USERNAME: The username for Elasticsearch authentication. It is required to authenticate
-//     and access Elasticsearch for migration operations.
-//   - PASSWORD: The password corresponding to the USERNAME, used to authenticate access to Elasticsearch.
+//   - MIGRATIONS: the directory of the numbered migration files, "./migrations/elasticsearch" by default.
+//     Every file is named <version>_<name>.json (the index operations, e.g. the mapping changes) or
+//     <version>_<name>.ndjson (the data, in the bulk API format), and they are applied in the order of the versions.
+//     The index definitions the migrations create the index from are kept in definitions/ and are part of their checksums.
 //
-// If any of these environment variables are missing, the function will return an error (ErrEnvIsNotSet),
-// indicating which variable was not set properly.
-func getEnv() (map[string]string, error) {
-	direction := os.Getenv("DIRECTION")
-	migrations := os.Getenv("MIGRATIONS")
-	migrationDownBool := os.Getenv("MIGRATE_DOWN_WITH_INDEX")
-	esAddress := os.Getenv("ES_ADDRESS")
-	esUsername := os.Getenv("ES_USERNAME")
-	esPassword := os.Getenv("ES_PASSWORD")
-
+// The Elasticsearch connection settings (ES_ADDRESS, ES_ADDRESSES, ES_USERNAME, ES_PASSWORD, ES_API_KEY, ES_SERVICE_TOKEN,
+// ES_TRANSPORT_TLS_* and their _FILE variants) are not read here. They are loaded by loadConfig() exactly
+// like SimpleSearch loads them, so both connect to Elasticsearch the same way.
+func getEnv() map[string]string {
 	envs := make(map[string]string)
 
-	envs["direction"] = direction
-	envs["migrations"] = migrations
-	envs["migrate_down_with_index"] = migrationDownBool
-	envs["es_address"] = esAddress
-	envs["es_username"] = esUsername
-	envs["es_password"] = esPassword
+	envs["migrations"] = os.Getenv("MIGRATIONS")
+	if envs["migrations"] == "" {
+		envs["migrations"] = "./migrations/elasticsearch"
+	}
+
+	return envs
+}
+
+// loadConfig() loads the SimpleSearch configuration, which holds the Elasticsearch connection settings,
+// and returns it with the command and its arguments.
+//
+// The config files, environment variables and flags (-env, -config, -es-address) are the same as SimpleSearch's.
+// The migrations are applied through the first configured node.
+func loadConfig() (utils.Config, []string, error) {
+	flags, err := utils.ParseFlags("esmigrator", os.Args[1:])
+	if err != nil {
+		return utils.Config{}, nil, err
+	}
+	cfg, err := utils.MustLoadConfig(flags)
+	if err != nil {
+		return utils.Config{}, nil, err
+	}
+	return cfg, flags.Args, cfg.Validate()
+}
+
+// newHTTPClient() creates the HTTP client for the Migrator.
+//
+// It uses the same TLS settings as SimpleSearch (CA bundle, fingerprint pinning, client certificate) and sends
+// the API key or the service token, if configured, with every request.
+func newHTTPClient(cfg utils.Config) (*http.Client, error) {
+	transport, err := esconn.Transport(cfg.ElasticSearch)
+	if err != nil {
+		return &http.Client{}, err
+	}
 
-	return envs, nil
+	return &http.Client{
+		Transport: &esconn.AuthRoundTripper{
+			Next:          transport,
+			Authorization: esconn.AuthHeader(cfg.ElasticSearch),
+		},
+		Timeout: time.Minute,
+	}, nil
 }
 
 // main() is the entry point of the Migrator.
 func main() {
-	envs, err := getEnv()
+	err := run(os.Stdout)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+}
 
-	m := goelasticmigrator.New(goelasticmigrator.MigratorConfig{
-		Client: http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-				TLSHandshakeTimeout: time.Second * 10,
-			},
-			Timeout: time.Second * 10,
-		},
-		ElasticSearch: goelasticmigrator.ElasticSearch{
-			Address: envs["address"],
-			Index: goelasticmigrator.Index{
-				Name: "products",
-				Definition: map[string]interface{}{
-					"mappings": map[string]interface{}{
-						"properties": map[string]interface{}{
-							"category": map[string]interface{}{
-								"type": "keyword",
-							},
-							"created_at": map[string]interface{}{
-								"type": "date",
-							},
-							"description": map[string]interface{}{
-								"type": "text",
-							},
-							"id": map[string]interface{}{
-								"type": "long",
-							},
-							"name": map[string]interface{}{
-								"type": "text",
-							},
-							"price": map[string]interface{}{
-								"type": "float",
-							},
-							"stock": map[string]interface{}{
-								"type": "integer",
-							},
-						},
-					},
-				},
-			},
-			Credentials: goelasticmigrator.Credentials{
-				Username: envs["username"],
-				Password: envs["password"],
-			},
-		},
-	})
+// run() loads the migrations and runs the command.
+//
+// Nothing is applied or rolled back if an applied migration was modified or removed since, or if a pending
+// migration is older than the last applied one.
+func run(out io.Writer) error {
+	envs := getEnv()
+
+	cfg, args, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	// The config is valid without the nodes when the app searches a local file (the memory or disk backend).
+	nodes := cfg.ElasticSearch.Nodes()
+	if len(nodes) == 0 {
+		return ErrNoNodes
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("%s\n\n%s", ErrUnknownCommand, usage)
+	}
+
+	migrations, err := migrator.Load(envs["migrations"])
+	if err != nil {
+		return err
+	}
+
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	m := migrator.New(migrator.Config{
+		Client:   client,
+		Address:  nodes[0],
+		Username: cfg.ElasticSearch.Username,
+		Password: cfg.ElasticSearch.Password,
+	}, migrations)
 
-	switch envs["direction"] {
-	case "up":
-		err := m.MigrateUp(envs["migrations"])
+	ctx := context.Background()
+
+	var done []migrator.Migration
+
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		return status(ctx, out, m)
+
+	case args[0] == "plan" && len(args) == 1:
+		return plan(ctx, out, m, cfg.ElasticSearch.Index)
+
+	case args[0] == "reindex" && len(args) <= 2:
+		err = reindex(ctx, out, m, cfg.ElasticSearch.Index, args[1:])
+		if err == nil {
+			cacheNotice(out, cfg)
+		}
+		return err
+
+	case args[0] == "alias" && len(args) <= 2:
+		err = alias(ctx, out, m, cfg.ElasticSearch.Index, args[1:])
+		if err == nil && len(args) == 2 {
+			cacheNotice(out, cfg)
+		}
+		return err
+
+	case args[0] == "up" && len(args) == 1:
+		done, err = m.Up(ctx)
+
+	case args[0] == "down" && len(args) == 1:
+		done, err = m.Down(ctx)
+
+	case args[0] == "to" && len(args) == 2:
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("%w: %q", migrator.ErrUnknownVersion, args[1])
+		}
+		done, err = m.To(ctx, version)
+
+	case args[0] == "baseline" && len(args) == 2:
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("%w: %q", migrator.ErrUnknownVersion, args[1])
+		}
+		done, err = m.Baseline(ctx, version)
+
+	default:
+		return fmt.Errorf("%s\n\n%s", ErrUnknownCommand, usage)
+	}
+
+	for _, mg := range done {
+		fmt.Fprintf(out, "%s %s\n", args[0], mg)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		fmt.Fprintln(out, "nothing to do")
+		return nil
+	}
+	if args[0] != "baseline" {
+		cacheNotice(out, cfg)
+	}
+
+	return nil
+}
+
+// cacheNotice() tells that SimpleSearch keeps serving the cached results of the searches after the products were
+// written, until they expire or the cache is purged. The migrator can't purge it, as it doesn't know the instances.
+func cacheNotice(out io.Writer, cfg utils.Config) {
+	if !cfg.Search.Cache.Enabled {
+		return
+	}
+	fmt.Fprintf(out, "the cached search results show the changes within %s (search.cache.ttl), purge them sooner with DELETE /admin/cache on every instance\n", cfg.Search.Cache.TTL)
+}
+
+// status() prints the state of every migration.
+func status(ctx context.Context, out io.Writer, m *migrator.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tKIND\tSTATE\tAPPLIED AT")
+
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+
+		if s.Applied != nil {
+			state, appliedAt = "applied", s.Applied.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Modified {
+			state = "MODIFIED"
+		}
+		if s.Missing {
+			state = "MISSING"
+		}
+
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\t%s\n", s.Migration.Version, s.Migration.Name, s.Migration.Kind, state, appliedAt)
+	}
+
+	return w.Flush()
+}
+
+// plan() prints what "up" would do, without writing anything.
+//
+// The live index is compared with the definition in the config (ES_INDEX). The changes that can't be applied
+// to the live index are flagged, they need a reindex.
+func plan(ctx context.Context, out io.Writer, m *migrator.Migrator, definitionFile string) error {
+	definition, err := indexdef.Load(definitionFile)
+	if err != nil {
+		return err
+	}
+
+	p, err := m.Plan(ctx, definition)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !p.Exists:
+		fmt.Fprintf(out, "index %s doesn't exist\n", p.Index)
+	case len(p.Changes) == 0:
+		fmt.Fprintf(out, "index %s matches %s\n", p.Index, definitionFile)
+	default:
+		fmt.Fprintf(out, "index %s differs from %s:\n", p.Index, definitionFile)
+		for _, c := range p.Changes {
+			fmt.Fprintf(out, "  %s\n", c)
+		}
+		if p.Reindex() {
+			fmt.Fprintln(out, "some changes can't be applied to the live index, they require a reindex")
+		}
+	}
+
+	fmt.Fprintln(out)
+
+	if len(p.Pending) == 0 {
+		fmt.Fprintln(out, "no pending migrations")
+		return nil
+	}
+
+	data := map[int]migrator.DataPlan{}
+	for _, dp := range p.Data {
+		data[dp.Migration.Version] = dp
+	}
+
+	fmt.Fprintln(out, "pending migrations:")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	for _, mg := range p.Pending {
+		dp, ok := data[mg.Version]
+		if !ok {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", mg, mg.Kind, operations(mg))
+			continue
+		}
+
+		fmt.Fprintf(w, "  %s\t%s\t%d to create, %d to update, %d to delete, %d unchanged", mg, mg.Kind, dp.Create, dp.Update, dp.Delete, dp.Unchanged)
+		if dp.Conflicts > 0 {
+			fmt.Fprintf(w, ", %d failing", dp.Conflicts)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+// operations() describes the "up" operations of an index migration, e.g. "create_index products".
+func operations(mg migrator.Migration) string {
+	ops, err := mg.Operations()
+	if err != nil {
+		return err.Error()
+	}
+
+	var parts []string
+
+	for _, op := range ops.Up {
+		switch {
+		case op.CreateIndex != nil:
+			parts = append(parts, "create_index "+op.CreateIndex.Index)
+		case op.DeleteIndex != nil:
+			parts = append(parts, "delete_index "+op.DeleteIndex.Index)
+		case op.PutMapping != nil:
+			parts = append(parts, "put_mapping "+op.PutMapping.Index)
+		case op.PutSettings != nil:
+			parts = append(parts, "put_settings "+op.PutSettings.Index)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// reindex() copies the documents to a new version of the index and moves the alias to it.
+func reindex(ctx context.Context, out io.Writer, m *migrator.Migrator, definitionFile string, args []string) error {
+	definition, err := indexdef.Load(definitionFile)
+	if err != nil {
+		return err
+	}
+
+	var script string
+
+	if len(args) == 1 {
+		data, err := os.ReadFile(args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
+		script = string(data)
+	}
+
+	r, err := m.Reindex(ctx, definition, script)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "reindexed %d documents from %s to %s, %s now points to %s\n", r.Documents, r.From, r.To, r.Alias, r.To)
+
+	if r.Backup != "" {
+		fmt.Fprintf(out, "%s was deleted, as the alias took its name, its copy %s is kept, roll back with: esmigrator alias 0\n", r.From, r.Backup)
+		return nil
+	}
+
+	version, _ := definition.Version(r.From)
+	fmt.Fprintf(out, "%s is kept, roll back with: esmigrator alias %d\n", r.From, version)
+
+	return nil
+}
 
-	case "down":
-		if envs["migrate_down_with_index"] == "true" {
-			err := m.MigrateDown(true)
-			if err != nil {
-				panic(err)
-			}
+// alias() prints the versions of the index, or moves the alias to the version.
+func alias(ctx context.Context, out io.Writer, m *migrator.Migrator, definitionFile string, args []string) error {
+	definition, err := indexdef.Load(definitionFile)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("%w: %q", migrator.ErrUnknownIndex, args[0])
 		}
-		if envs["migrate_down_with_index"] == "false" {
-			err := m.MigrateDown(false)
-			if err != nil {
-				panic(err)
-			}
+
+		from, err := m.SwapAlias(ctx, definition, version)
+		if err != nil {
+			return err
+		}
+
+		if from == definition.Index(version) {
+			fmt.Fprintf(out, "%s already points to %s\n", definition.Name, from)
+			return nil
 		}
+		fmt.Fprintf(out, "%s now points to %s instead of %s\n", definition.Name, definition.Index(version), from)
+		return nil
 	}
+
+	versions, live, err := m.Versions(ctx, definition)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case live == "":
+		fmt.Fprintf(out, "%s doesn't exist\n", definition.Name)
+	case live == definition.Name:
+		fmt.Fprintf(out, "%s is an index, it isn't versioned until the first reindex, which backs it up to %s\n", definition.Name, definition.Index(0))
+	}
+
+	for _, v := range versions {
+		marker := " "
+		if definition.Index(v) == live {
+			marker = "*"
+		}
+		fmt.Fprintf(out, "%s %s\n", marker, definition.Index(v))
+	}
+
+	return nil
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/fakees"
+)
+
+/*
+
+FAKE ELASTICSEARCH FOR LOCAL DEVELOPMENT.
+
+Serves the subset of the Elasticsearch REST API used by SimpleSearch and esmigrator from memory: index create,
+get and delete, _bulk, _doc and _search with the bool, multi_match, match, term, terms, range and match_all queries.
+Nothing is persisted, so the data is lost on exit.
+
+Flags:
+  - -address: the address to listen on, "127.0.0.1:9200" by default.
+  - -tls: serve HTTPS with a self-signed certificate generated on start. Its SHA-256 fingerprint is logged, so it can be
+    pinned with ES_TRANSPORT_TLS_CA_FINGERPRINT, or the verification can be skipped with the tls_insecure of the local config.
+  - -load: NDJSON bulk files (e.g. the migration file) to index on start, comma separated.
+
+Any username, password or API key is accepted. E.g. `make fakees` in one terminal, then `make esmigrator`
+and `make simplesearch` in another.
+
+*/
+
+func main() {
+	address := flag.String("address", "127.0.0.1:9200", "address to listen on")
+	useTLS := flag.Bool("tls", false, "serve HTTPS with a self-signed certificate")
+	load := flag.String("load", "", "comma separated NDJSON bulk files to index on start")
+	flag.Parse()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	err := run(log, *address, *useTLS, *load)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(log *slog.Logger, address string, useTLS bool, load string) error {
+	es := fakees.New()
+
+	for _, path := range strings.Split(load, ",") {
+		if path == "" {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = es.Load(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		log.Info("file loaded", slog.String("file", path))
+	}
+
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           logRequests(log, es),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if !useTLS {
+		log.Info("listening", slog.String("address", "http://"+address))
+		return srv.ListenAndServe()
+	}
+
+	cert, fingerprint, err := selfSignedCert()
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	log.Info(
+		"listening",
+		slog.String("address", "https://"+address),
+		slog.String("fingerprint", fingerprint),
+	)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// Logs every request with its status.
+func logRequests(log *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		log.Info(
+			"request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+		)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Generates a self-signed certificate for localhost, returning it with its hex encoded SHA-256 fingerprint.
+func selfSignedCert() (tls.Certificate, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "fakees"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv4zero, net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	sum := sha256.Sum256(der)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, hex.EncodeToString(sum[:]), nil
+}
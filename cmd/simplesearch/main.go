@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/xoticdsign/go-simplesearch/internal/app"
 )
 
@@ -19,6 +22,11 @@ Main Features:
 
 2. Elasticsearch Integration:
    - Elasticsearch is used as the search engine for querying product data. The application connects to Elasticsearch and performs searches based on the input from the client. The search results are returned to the user as JSON responses.
+   - The products index is defined (name, aliases, settings and mappings) in `migrations/indices/products.json` (`ES_INDEX`). The esmigrator creates the first version of the index from a copy of it versioned with the migration (`migrations/elasticsearch/definitions`), covered by the migration checksum, so an edit to an applied definition is refused like an edit to the migration. The app searches through the `products` alias of a versioned index (`products_v1`, ...), so `esmigrator reindex` can copy the products to a new version with other mappings or analyzers and swap the alias without downtime, keeping the previous version for a rollback (`esmigrator alias <version>`).
+   - Clusters running OpenSearch are supported with `BACKEND_TYPE=opensearch`, which takes the same `ES_*` connection settings and sends the same queries, without the product check of the Elasticsearch client.
+   - For development and CI the app can run without Elasticsearch: with `BACKEND_TYPE=memory` it searches the products loaded from the NDJSON migration file (`BACKEND_FILE`) in memory, with the same matching and filtering.
+   - Small deployments can run without an Elasticsearch cluster too: with `BACKEND_TYPE=disk` the products are searched in an embedded inverted index with BM25 scoring, kept in `BACKEND_INDEX_DIR` and rebuilt from the migration file whenever it changes.
+   - For local end-to-end runs `cmd/fakees` (`make fakees`) serves a fake in-memory Elasticsearch with the subset of the API the app and esmigrator use, so no cluster is needed.
 
 3. Graceful Shutdown:
    - The application handles signals like SIGINT (Ctrl+C) or SIGTERM gracefully, ensuring that ongoing processes are cleaned up before the app shuts down, providing a smoother user experience during restarts or shutdowns.
@@ -29,7 +37,7 @@ Main Features:
 How it Works:
 -------------
 1. Environment Setup:
-   - The `env` environment variable determines the configuration file to be loaded. If not specified, the app defaults to "local" settings, which typically point to a development environment.
+   - The `-env` flag (or the `ENV` environment variable) determines the configuration files to be loaded: `config/base.yaml` and then `config/<env>.yaml` on top of it. If not specified, the app defaults to "local" settings, which typically point to a development environment. Every setting can be overridden with an environment variable (e.g. `ES_ADDRESSES`, a comma separated list of the Elasticsearch nodes) or a command-line flag, and the `-config` flag (or `CONFIG_PATH`) points the app to another config directory or file.
 
 2. App Initialization:
    - The `app.New` function initializes the application by loading the configuration and setting up necessary services, such as the Elasticsearch connection and the web server.
@@ -40,7 +48,13 @@ How it Works:
 4. Search Endpoint:
    - The main feature is a `/search` endpoint that listens for POST requests. Clients can send search queries, which the application then processes and queries Elasticsearch to return search results.
 
-5. Error Handling:
+5. Configuration Check:
+   - `simplesearch config check [flags]` loads the configuration exactly like the app does, prints the effective merged configuration with the secrets masked and validates it. It exits with a non-zero code if any problem is found, so it can be used in deployment pipelines.
+
+6. Secrets:
+   - Every secret (e.g. `ES_PASSWORD`) can be read from a file named in its `_FILE` variant (e.g. `ES_PASSWORD_FILE`), from a directory of mounted secret files (`SECRETS_PROVIDER=file`), or from a local encrypted file (`SECRETS_PROVIDER=encrypted`) prepared with `simplesearch secrets keygen` and `simplesearch secrets encrypt`, so the credentials never appear in command lines or process listings.
+
+7. Error Handling:
    - If any error occurs during the app initialization, running, or processing, the application panics and prints the error. This is a simple way of handling critical failures, but more sophisticated error handling and logging could be added for production environments.
 
 In summary, this project provides a straightforward example of how to build a Go web application with Elasticsearch as the backend for search functionality, while emphasizing flexibility, error handling, and graceful shutdown mechanisms.
@@ -48,7 +62,25 @@ In summary, this project provides a straightforward example of how to build a Go
 */
 
 func main() {
-	a, err := app.New()
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		err := app.CheckConfig(os.Args[3:], os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "secrets" {
+		err := app.Secrets(os.Args[2:], os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	a, err := app.New(os.Args[1:])
 	if err != nil {
 		panic(err)
 	}
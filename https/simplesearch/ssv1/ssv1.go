@@ -1,6 +1,8 @@
 package ssv1
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -26,11 +28,13 @@ type MakeSearchRequest struct {
 type MakeSearchRequestFilters struct {
 	PriceBottom float64 `json:"price_bottom"`
 	PriceTop    float64 `json:"price_top"`
+	Category    string  `json:"category"`
 }
 
 type MakeSearchResponse struct {
-	Message string      `json:"message"`
-	Result  interface{} `json:"result"`
+	Message  string      `json:"message"`
+	Result   interface{} `json:"result"`
+	Degraded bool        `json:"degraded,omitempty"`
 }
 
 func (u *UnimplementedHandlers) MakeSearch(c *fiber.Ctx) error {
@@ -42,3 +46,44 @@ func (u *UnimplementedHandlers) MakeSearch(c *fiber.Ctx) error {
 type Client struct {
 	ClientImplementation fiber.Client
 }
+
+type SetLogLevelRequest struct {
+	Level    string `json:"level"`
+	OpPrefix string `json:"op_prefix"`
+	TTL      string `json:"ttl"`
+}
+
+type LogLevelResponse struct {
+	Base      string     `json:"base"`
+	Override  string     `json:"override,omitempty"`
+	OpPrefix  string     `json:"op_prefix,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ReloadResponse struct {
+	Message string         `json:"message"`
+	Changes []ConfigChange `json:"changes"`
+}
+
+type ConfigChange struct {
+	Field      string `json:"field"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+type PurgeCacheResponse struct {
+	Message string `json:"message"`
+}
+
+type ReadinessResponse struct {
+	Status string       `json:"status"`
+	Nodes  []NodeHealth `json:"nodes,omitempty"`
+}
+
+type NodeHealth struct {
+	URL       string     `json:"url"`
+	Alive     bool       `json:"alive"`
+	Failures  int        `json:"failures,omitempty"`
+	DeadSince *time.Time `json:"dead_since,omitempty"`
+}
@@ -1,13 +1,17 @@
 package app
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/xoticdsign/go-simplesearch/internal/app/httpsss"
 	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
 	"github.com/xoticdsign/go-simplesearch/internal/utils"
 )
 
@@ -15,72 +19,84 @@ const op = "app."
 
 // App Struct represents the entire application.
 //
-// It contains the SimpleSearch service and manages the application's lifecycle (initialization, running, and shutdown).
+// It contains the SimpleSearch service and manages the application's lifecycle (initialization, running, reloading and shutdown).
 type App struct {
 	SimpleSearch *httpsss.App
 
-	log    *slog.Logger
-	config utils.Config
-}
-
-func getEnv() (map[string]string, error) {
-	env := os.Getenv("ENV")
-	address := os.Getenv("ADDRESS")
-	esAddress := os.Getenv("ES_ADDRESS")
-	esUsername := os.Getenv("ES_USERNAME")
-	esPassword := os.Getenv("ES_PASSWORD")
-
-	envs := make(map[string]string)
+	log             *slog.Logger
+	level           *logger.Level
+	redactor        *logger.Redactor
+	flags           utils.Flags
+	tracingShutdown func(context.Context) error
 
-	envs["env"] = env
-	envs["address"] = address
-	envs["es_address"] = esAddress
-	envs["es_username"] = esUsername
-	envs["es_password"] = esPassword
-
-	return envs, nil
+	mu     sync.Mutex
+	config utils.Config
 }
 
 // New() creates a new instance of the App.
 //
-// It loads the configuration based on the provided environment, initializes the logger,
+// It parses the command-line arguments, loads and validates the configuration for the selected environment, initializes the logger,
 // and creates the SimpleSearch application. Returns the App struct or an error if any step fails.
-func New() (*App, error) {
-	envs, err := getEnv()
+func New(args []string) (*App, error) {
+	flags, err := utils.ParseFlags("simplesearch", args)
+	if err != nil {
+		return &App{}, err
+	}
+
+	cfg, err := utils.MustLoadConfig(flags)
 	if err != nil {
 		return &App{}, err
 	}
 
-	cfg, err := utils.MustLoadConfig(envs)
+	err = cfg.Validate()
 	if err != nil {
 		return &App{}, err
 	}
 
-	log := logger.New(envs)
+	log, level, redactor := logger.New(cfg)
 
-	ss, err := httpsss.New(log, cfg)
+	tracingShutdown, err := tracing.New(cfg)
 	if err != nil {
 		return &App{}, err
 	}
 
-	return &App{
-		SimpleSearch: ss,
+	a := &App{
+		log:             log,
+		level:           level,
+		redactor:        redactor,
+		flags:           flags,
+		tracingShutdown: tracingShutdown,
 
-		log:    log,
 		config: cfg,
-	}, nil
+	}
+
+	ss, err := httpsss.New(log, cfg, httpsss.Admin{Level: level, Reload: a.Reload})
+	if err != nil {
+		return &App{}, err
+	}
+
+	a.SimpleSearch = ss
+
+	return a, nil
 }
 
 // Run() starts the application and handles the main application flow.
 //
 // It starts the SimpleSearch app in a separate goroutine and listens for termination signals (SIGTERM, SIGINT).
 // If an error occurs or a shutdown signal is received, it proceeds to shut down the application gracefully.
+// SIGUSR1 toggles the temporary debug log level and SIGHUP reloads the configuration without stopping the application.
 func (a *App) Run() error {
 	const fu = "Run()"
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
+	usrChan := make(chan os.Signal, 1)
+	signal.Notify(usrChan, syscall.SIGUSR1)
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
 	errChan := make(chan error, 1)
 
 	go func() {
@@ -90,19 +106,32 @@ func (a *App) Run() error {
 		}
 	}()
 
-	select {
-	case err := <-errChan:
-		a.log.Error(
-			"will shutdown, because an error occurred while running",
-			slog.String("op", op+fu),
-			slog.String("error", err.Error()),
-		)
+loop:
+	for {
+		select {
+		case err := <-errChan:
+			a.log.Error(
+				"will shutdown, because an error occurred while running",
+				slog.String("op", op+fu),
+				slog.String("error", err.Error()),
+			)
 
-	case <-sigChan:
-		a.log.Info(
-			"signaled to shutdown",
-			slog.String("op", op+fu),
-		)
+			break loop
+
+		case <-sigChan:
+			a.log.Info(
+				"signaled to shutdown",
+				slog.String("op", op+fu),
+			)
+
+			break loop
+
+		case <-usrChan:
+			a.toggleDebug()
+
+		case <-hupChan:
+			a.Reload()
+		}
 	}
 
 	err := a.shutdown()
@@ -112,9 +141,45 @@ func (a *App) Run() error {
 	return nil
 }
 
+// Toggles the temporary debug log level.
+//
+// If an override is active it is reverted, otherwise the debug level is switched on for the configured TTL,
+// optionally scoped to the configured op prefix.
+func (a *App) toggleDebug() {
+	const fu = "toggleDebug()"
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.level.Overridden() {
+		a.level.Reset()
+
+		a.log.Info(
+			"debug log level switched off",
+			slog.String("op", op+fu),
+		)
+
+		return
+	}
+
+	ttl := a.config.Log.DebugTTL
+	if ttl <= 0 {
+		ttl = time.Minute * 5
+	}
+
+	a.level.Set(slog.LevelDebug, a.config.Log.DebugOpPrefix, ttl)
+
+	a.log.Info(
+		"debug log level switched on",
+		slog.String("op", op+fu),
+		slog.String("op_prefix", a.config.Log.DebugOpPrefix),
+		slog.Duration("ttl", ttl),
+	)
+}
+
 // Shuts down the application gracefully.
 //
-// It stops the SimpleSearch service and handles any errors that may occur during the shutdown process.
+// It stops the SimpleSearch service, flushes the pending spans and handles any errors that may occur during the shutdown process.
 func (a *App) shutdown() error {
 	const fu = "shutdown()"
 
@@ -128,5 +193,19 @@ func (a *App) shutdown() error {
 
 		return err
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err = a.tracingShutdown(ctx)
+	if err != nil {
+		a.log.Error(
+			"error occurred while trying to flush the spans",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// CheckConfig() implements the "config check" command.
+//
+// It loads the configuration the same way New() does, prints the effective merged configuration with the secrets masked
+// to w and validates it. The returned error lists all the problems found, so the command can fail a deployment pipeline.
+func CheckConfig(args []string, w io.Writer) error {
+	flags, err := utils.ParseFlags("simplesearch config check", args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := utils.MustLoadConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(cfg.Masked())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "# effective configuration (env %q, config %q)\n", flags.Env, flags.ConfigPath)
+
+	_, err = w.Write(out)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Validate()
+}
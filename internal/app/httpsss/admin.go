@@ -0,0 +1,181 @@
+package httpsss
+
+import (
+	"context"
+	"crypto/subtle"
+	"expvar"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Default TTL of a log level override set through the admin endpoint.
+const defaultLogLevelTTL = time.Minute * 5
+
+// Admin struct holds the dependencies of the admin endpoints.
+//
+// Reload re-reads the configuration and applies its reloadable parts, returning the changes found.
+type Admin struct {
+	Level  *logger.Level
+	Reload func() ([]utils.Change, error)
+}
+
+// Holds all the HTTP request handlers of the admin endpoints.
+type adminHandlers struct {
+	Admin Admin
+
+	cache Invalidator
+
+	log    *slog.Logger
+	config utils.Config
+}
+
+// Invalidator interface is implemented by the services caching the search results.
+type Invalidator interface {
+	Invalidate(ctx context.Context)
+}
+
+// Registers the admin endpoints under /admin.
+//
+// Besides the handlers below, /admin/metrics serves the expvar metrics (e.g. the retries and the circuit breaker state).
+// The endpoints are registered only when the admin token is configured.
+func (h *adminHandlers) register(server *fiber.App) {
+	if h.config.Admin.Token == "" {
+		return
+	}
+
+	admin := server.Group("/admin", h.Auth)
+
+	admin.Get("/log-level", h.GetLogLevel)
+	admin.Put("/log-level", h.SetLogLevel)
+	admin.Delete("/log-level", h.ResetLogLevel)
+	admin.Post("/reload", h.Reload)
+	admin.Delete("/cache", h.PurgeCache)
+	admin.Get("/metrics", adaptor.HTTPHandler(expvar.Handler()))
+}
+
+// Auth handler checks the bearer token of the admin requests.
+func (h *adminHandlers) Auth(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Admin.Token)) != 1 {
+		return fiber.ErrUnauthorized
+	}
+	return c.Next()
+}
+
+// GetLogLevel handler returns the current log level and the active override, if any.
+func (h *adminHandlers) GetLogLevel(c *fiber.Ctx) error {
+	return c.JSON(logLevelResponse(h.Admin.Level.State()))
+}
+
+// SetLogLevel handler overrides the log level for a while.
+//
+// The override can be scoped to the records whose op starts with the given prefix (e.g. "service.ElasticSearch.").
+// It is reverted automatically after the TTL, 5 minutes by default.
+func (h *adminHandlers) SetLogLevel(c *fiber.Ctx) error {
+	const fu = "SetLogLevel()"
+
+	var req ssv1.SetLogLevelRequest
+
+	err := c.BodyParser(&req)
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	level, err := logger.ParseLevel(req.Level)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "unknown log level")
+	}
+
+	ttl := defaultLogLevelTTL
+
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "ttl must be a positive duration")
+		}
+	}
+
+	h.Admin.Level.Set(level, req.OpPrefix, ttl)
+
+	h.log.Info(
+		"log level overridden",
+		slog.String("op", op+fu),
+		slog.String("level", level.String()),
+		slog.String("op_prefix", req.OpPrefix),
+		slog.Duration("ttl", ttl),
+	)
+
+	return c.JSON(logLevelResponse(h.Admin.Level.State()))
+}
+
+// ResetLogLevel handler reverts the log level to the one from the config.
+func (h *adminHandlers) ResetLogLevel(c *fiber.Ctx) error {
+	const fu = "ResetLogLevel()"
+
+	h.Admin.Level.Reset()
+
+	h.log.Info(
+		"log level reset",
+		slog.String("op", op+fu),
+	)
+
+	return c.JSON(logLevelResponse(h.Admin.Level.State()))
+}
+
+// Reload handler re-reads the configuration and applies its reloadable parts.
+//
+// It responds with all the changes found, marking the ones that require a restart to take effect.
+// An invalid configuration is rejected and the current one is kept.
+func (h *adminHandlers) Reload(c *fiber.Ctx) error {
+	changes, err := h.Admin.Reload()
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	resp := ssv1.ReloadResponse{
+		Message: "reloaded",
+		Changes: []ssv1.ConfigChange{},
+	}
+
+	for _, change := range changes {
+		resp.Changes = append(resp.Changes, ssv1.ConfigChange{
+			Field:      change.Field,
+			Old:        change.Old,
+			New:        change.New,
+			Reloadable: change.Reloadable,
+		})
+	}
+
+	return c.JSON(resp)
+}
+
+// PurgeCache handler drops the cached search results.
+//
+// The API has no endpoints writing the products yet, so it is the way to invalidate the cache after the index is
+// changed by other means (e.g. by the migrator), on every instance. Otherwise the changes are seen within
+// search.cache.ttl. Future write endpoints must invalidate the cache themselves.
+func (h *adminHandlers) PurgeCache(c *fiber.Ctx) error {
+	h.cache.Invalidate(c.UserContext())
+
+	return c.JSON(ssv1.PurgeCacheResponse{
+		Message: "purged",
+	})
+}
+
+// Converts the state of the log level to the API response.
+func logLevelResponse(state logger.LevelState) ssv1.LogLevelResponse {
+	return ssv1.LogLevelResponse{
+		Base:      state.Base,
+		Override:  state.Override,
+		OpPrefix:  state.OpPrefix,
+		ExpiresAt: state.ExpiresAt,
+	}
+}
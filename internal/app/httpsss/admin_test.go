@@ -0,0 +1,60 @@
+package httpsss
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+func TestAdmin(t *testing.T) {
+	cfg := utils.Config{Env: "local", Admin: utils.Admin{Token: "secret"}}
+	_, level, _ := logger.New(cfg)
+
+	h := adminHandlers{
+		Admin:  Admin{Level: level},
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		config: cfg,
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	h.register(app)
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"no token", "", `{"level": "debug"}`, fiber.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", `{"level": "debug"}`, fiber.StatusUnauthorized},
+		{"unknown level", "Bearer secret", `{"level": "verbose"}`, fiber.StatusBadRequest},
+		{"bad ttl", "Bearer secret", `{"level": "debug", "ttl": "-1m"}`, fiber.StatusBadRequest},
+		{"malformed body", "Bearer secret", `{`, fiber.StatusBadRequest},
+		{"overridden", "Bearer secret", `{"level": "debug", "ttl": "1m"}`, fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPut, "/admin/log-level", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if tt.token != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.token)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
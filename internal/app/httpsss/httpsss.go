@@ -8,6 +8,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/ratelimit"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/resilience"
 	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
 	"github.com/xoticdsign/go-simplesearch/internal/services/simplesearch"
 	"github.com/xoticdsign/go-simplesearch/internal/utils"
@@ -22,27 +24,23 @@ type App struct {
 	Server ssv1.Server
 	Client ssv1.Client
 
-	log    *slog.Logger
-	config utils.Config
+	log     *slog.Logger
+	config  utils.Config
+	service *simplesearch.Service
+	limiter *ratelimit.Limiter
 }
 
 // New initializes and returns a new instance of the SimpleSearch App.
 //
 // It sets up the Fiber server, initializes the SimpleSearch service, and configures request handlers.
-func New(log *slog.Logger, cfg utils.Config) (*App, error) {
+// The admin endpoints are served with the dependencies from admin.
+func New(log *slog.Logger, cfg utils.Config, admin Admin) (*App, error) {
 	server := fiber.New(fiber.Config{
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
 		IdleTimeout:  cfg.IdleTimeout,
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			var e *fiber.Error
-
-			if errors.As(err, &e) {
-				return c.JSON(&e)
-			}
-			return c.JSON(fiber.ErrInternalServerError)
-		},
-		AppName: cfg.ServiceName,
+		ErrorHandler: errorHandler,
+		AppName:      cfg.ServiceName,
 	})
 
 	service, err := simplesearch.New(log, cfg)
@@ -50,9 +48,20 @@ func New(log *slog.Logger, cfg utils.Config) (*App, error) {
 		return &App{}, err
 	}
 
-	handlers := handlers{SimpleSearch: service}
+	limiter := ratelimit.New(cfg.RateLimit)
+
+	handlers := handlers{SimpleSearch: service, health: service}
+	middlewares := middlewares{log: log, config: cfg, limiter: limiter}
 
-	server.Post("/search", handlers.MakeSearch)
+	server.Use(middlewares.RequestID)
+	server.Use(middlewares.AccessLog)
+	server.Use(middlewares.Tracing)
+
+	server.Post("/search", middlewares.RateLimit, handlers.MakeSearch)
+	server.Get("/readyz", handlers.Ready)
+
+	adminHandlers := adminHandlers{Admin: admin, cache: service, log: log, config: cfg}
+	adminHandlers.register(server)
 
 	return &App{
 		Server: ssv1.Server{
@@ -61,11 +70,19 @@ func New(log *slog.Logger, cfg utils.Config) (*App, error) {
 		},
 		Client: ssv1.Client{},
 
-		log:    log,
-		config: cfg,
+		log:     log,
+		config:  cfg,
+		service: service,
+		limiter: limiter,
 	}, nil
 }
 
+// Reload applies the reloadable settings of the new config to the SimpleSearch service and the rate limit.
+func (a *App) Reload(cfg utils.Config) {
+	a.service.Reload(cfg)
+	a.limiter.SetLimit(cfg.RateLimit)
+}
+
 // Run starts the SimpleSearch application by listening on the configured host and port.
 //
 // It listens for incoming HTTP requests and forwards them to the appropriate handler functions.
@@ -109,13 +126,72 @@ type handlers struct {
 	ssv1.UnimplementedHandlers
 
 	SimpleSearch SimpleSearcher
+
+	health HealthChecker
 }
 
 // SimpleSearcher interface defines the contract for searching functionality.
 //
-// It contains the method `MakeSearch` that takes a search request and returns a list of products or an error.
+// It contains the method `MakeSearch` that takes a search request and returns a list of products, along with
+// how they were served, or an error.
 type SimpleSearcher interface {
-	MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error)
+	MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) (simplesearch.Result, error)
+}
+
+// HealthChecker interface defines the contract for reporting the health of the search nodes.
+//
+// No nodes are reported if they are not tracked, in which case the app is considered ready.
+type HealthChecker interface {
+	Health() []search.NodeHealth
+}
+
+// Ready handler reports whether the app can serve the search requests, with the health of every node.
+//
+// The app is ready while at least one node is alive. Otherwise it responds with 503 Service Unavailable,
+// so the load balancer stops routing the traffic to it.
+func (h *handlers) Ready(c *fiber.Ctx) error {
+	nodes := h.health.Health()
+
+	resp := ssv1.ReadinessResponse{
+		Status: "ready",
+	}
+
+	alive := 0
+	for _, node := range nodes {
+		if node.Alive {
+			alive++
+		}
+
+		resp.Nodes = append(resp.Nodes, ssv1.NodeHealth{
+			URL:       node.URL,
+			Alive:     node.Alive,
+			Failures:  node.Failures,
+			DeadSince: node.DeadSince,
+		})
+	}
+
+	if len(nodes) > 0 && alive == 0 {
+		resp.Status = "not ready"
+
+		return c.Status(fiber.StatusServiceUnavailable).JSON(resp)
+	}
+
+	return c.JSON(resp)
+}
+
+// Header of the search responses telling whether the results came from the cache, as defined in RFC 9211.
+const headerCacheStatus = "Cache-Status"
+
+// Formats the Cache-Status header value, e.g. "simplesearch; hit" or "simplesearch; fwd=miss".
+func cacheStatus(status simplesearch.CacheStatus) string {
+	switch status {
+	case simplesearch.CacheHit:
+		return "simplesearch; hit"
+	case simplesearch.CacheStale:
+		return "simplesearch; hit; detail=stale"
+	default:
+		return "simplesearch; fwd=" + string(status)
+	}
 }
 
 // MakeSearch handler processes search requests from clients.
@@ -130,6 +206,9 @@ func (h *handlers) MakeSearch(c *fiber.Ctx) error {
 		return fiber.ErrBadRequest
 	}
 
+	c.Locals(localQuery, req.SearchFor)
+	c.Locals(localQueryLength, len(req.SearchFor))
+
 	if req.SearchFor == "" {
 		return c.JSON(ssv1.MakeSearchResponse{
 			Message: "you must provide the desired search",
@@ -140,18 +219,59 @@ func (h *handlers) MakeSearch(c *fiber.Ctx) error {
 		req.Filters.PriceTop = 10000000
 	}
 
-	result, err := h.SimpleSearch.MakeSearch(context.Background(), req)
+	result, err := h.SimpleSearch.MakeSearch(c.UserContext(), req)
+
+	c.Set(headerCacheStatus, cacheStatus(result.CacheStatus))
+	c.Locals(localCache, string(result.CacheStatus))
+
 	if err != nil {
 		if errors.Is(err, search.ErrNoHits) {
+			c.Locals(localHits, 0)
+
 			return c.JSON(ssv1.MakeSearchResponse{
 				Message: "none found",
 			})
 		}
-		return fiber.ErrInternalServerError // TODO: BETTER ERROR HANDLING
+		return searchError(err)
 	}
 
+	c.Locals(localHits, len(result.Products))
+	c.Locals(localDegraded, result.Degraded)
+
 	return c.JSON(ssv1.MakeSearchResponse{
-		Message: "results",
-		Result:  result,
+		Message:  "results",
+		Result:   result.Products,
+		Degraded: result.Degraded,
 	})
 }
+
+// Maps the error of a search to the error responded to the client.
+//
+// The open circuit breaker is 503 Service Unavailable, the timeout is 504 Gateway Timeout, and the search engine
+// responding with an error status or an undecodable response is 502 Bad Gateway. Anything else is 500.
+func searchError(err error) error {
+	var statusErr *search.StatusError
+
+	switch {
+	case errors.Is(err, resilience.ErrCircuitOpen):
+		return fiber.NewError(fiber.StatusServiceUnavailable, "search is temporarily unavailable, try again later")
+	case errors.Is(err, context.DeadlineExceeded):
+		return fiber.NewError(fiber.StatusGatewayTimeout, "search timed out, try again later")
+	case errors.As(err, &statusErr), errors.Is(err, search.ErrDecodingJSON), errors.Is(err, search.ErrUnmarshalingJSON),
+		errors.Is(err, search.ErrInterfaceConversion):
+		return fiber.NewError(fiber.StatusBadGateway, "search engine failed, try again later")
+	default:
+		return fiber.ErrInternalServerError
+	}
+}
+
+// Responds with the error and its status code. The errors other than *fiber.Error are 500 Internal Server Error,
+// so the internal details aren't leaked to the clients.
+func errorHandler(c *fiber.Ctx, err error) error {
+	var e *fiber.Error
+
+	if !errors.As(err, &e) {
+		e = fiber.ErrInternalServerError
+	}
+	return c.Status(e.Code).JSON(e)
+}
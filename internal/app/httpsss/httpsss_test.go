@@ -0,0 +1,77 @@
+package httpsss
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/resilience"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/services/simplesearch"
+)
+
+type fakeSearcher struct {
+	err error
+}
+
+func (f fakeSearcher) MakeSearch(context.Context, ssv1.MakeSearchRequest) (simplesearch.Result, error) {
+	return simplesearch.Result{CacheStatus: simplesearch.CacheMiss}, f.err
+}
+
+func TestMakeSearchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"no hits", search.ErrNoHits, fiber.StatusOK},
+		{"circuit open", resilience.ErrCircuitOpen, fiber.StatusServiceUnavailable},
+		{"timeout", fmt.Errorf("searching: %w", context.DeadlineExceeded), fiber.StatusGatewayTimeout},
+		{"error status", &search.StatusError{StatusCode: 500}, fiber.StatusBadGateway},
+		{"undecodable response", search.ErrDecodingJSON, fiber.StatusBadGateway},
+		{"other", fmt.Errorf("unexpected"), fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers{SimpleSearch: fakeSearcher{err: tt.err}}
+
+			app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+			app.Post("/search", h.MakeSearch)
+
+			req := httptest.NewRequest(fiber.MethodPost, "/search", strings.NewReader(`{"search_for": "apple"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestCacheStatus(t *testing.T) {
+	tests := []struct {
+		status simplesearch.CacheStatus
+		want   string
+	}{
+		{simplesearch.CacheHit, "simplesearch; hit"},
+		{simplesearch.CacheStale, "simplesearch; hit; detail=stale"},
+		{simplesearch.CacheMiss, "simplesearch; fwd=miss"},
+		{simplesearch.CacheBypass, "simplesearch; fwd=bypass"},
+	}
+
+	for _, tt := range tests {
+		if got := cacheStatus(tt.status); got != tt.want {
+			t.Errorf("cacheStatus(%s) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
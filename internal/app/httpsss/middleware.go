@@ -0,0 +1,209 @@
+package httpsss
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/ratelimit"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/requestid"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Keys of the request locals the handlers fill in for the access log.
+const (
+	localHits        = "hits"
+	localQueryLength = "query_length"
+	localQuery       = "query"
+	localCache       = "cache"
+	localDegraded    = "degraded"
+)
+
+// Holds all the middlewares of the SimpleSearch app.
+type middlewares struct {
+	log     *slog.Logger
+	config  utils.Config
+	limiter *ratelimit.Limiter
+}
+
+// RequestID middleware accepts the request ID sent by the client in the X-Request-ID header or generates a new one.
+//
+// The ID is echoed back in the response, stored in the user context of the request and attached to the logger
+// that is handed downstream, so every log line caused by the request can be correlated with it.
+//
+// The header is copied, as the ID outlives the request's buffers reused by Fiber, e.g. in a coalesced search.
+func (m *middlewares) RequestID(c *fiber.Ctx) error {
+	id := strings.Clone(c.Get(requestid.Header))
+	if !requestid.Valid(id) {
+		id = requestid.New()
+	}
+
+	c.Set(requestid.Header, id)
+
+	ctx := requestid.WithContext(c.UserContext(), id)
+	ctx = logger.WithContext(ctx, m.log.With(slog.String("request_id", id)))
+
+	c.SetUserContext(ctx)
+
+	return c.Next()
+}
+
+// AccessLog middleware emits one structured log line per request.
+//
+// The line holds the method, path, status, latency, and, for search requests, the number of hits and the length
+// of the search text. The search text itself is logged only when it is not redacted in the config.
+func (m *middlewares) AccessLog(c *fiber.Ctx) error {
+	const fu = "AccessLog()"
+
+	if !m.config.AccessLog.Enabled {
+		return c.Next()
+	}
+
+	start := time.Now()
+
+	err := c.Next()
+
+	attrs := []any{
+		slog.String("op", op+fu),
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.Int("status", statusOf(c, err)),
+		slog.Duration("latency", time.Since(start)),
+	}
+
+	if hits, ok := c.Locals(localHits).(int); ok {
+		attrs = append(attrs, slog.Int("hits", hits))
+	}
+	if length, ok := c.Locals(localQueryLength).(int); ok {
+		attrs = append(attrs, slog.Int("query_length", length))
+	}
+	if cache, ok := c.Locals(localCache).(string); ok {
+		attrs = append(attrs, slog.String("cache", cache))
+	}
+	if degraded, ok := c.Locals(localDegraded).(bool); ok && degraded {
+		attrs = append(attrs, slog.Bool("degraded", degraded))
+	}
+	if query, ok := c.Locals(localQuery).(string); ok && !m.config.AccessLog.RedactQuery {
+		attrs = append(attrs, slog.String("query", query))
+	}
+
+	logger.FromContext(c.UserContext(), m.log).Info("request", attrs...)
+
+	return err
+}
+
+// RateLimit middleware limits the number of requests every client can make, by its IP address.
+//
+// The requests over the limit are answered with 429 Too Many Requests, and the Retry-After header tells
+// the client how many seconds to wait.
+func (m *middlewares) RateLimit(c *fiber.Ctx) error {
+	// The client is kept by the limiter after the request, so its address is copied.
+	ok, wait := m.limiter.Allow(strings.Clone(c.IP()), time.Now())
+	if ok {
+		return c.Next()
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	return fiber.NewError(fiber.StatusTooManyRequests, "too many requests, try again later")
+}
+
+// Tracing middleware starts a server span for every request.
+//
+// The parent span context is extracted from the incoming W3C traceparent header, so the request joins
+// the caller's trace. The span is put into the user context of the request and is ended after the handler returns.
+//
+// The spans are exported after the request's buffers are reused by Fiber, so the path and the headers are copied.
+func (m *middlewares) Tracing(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c: c})
+
+	method, path := strings.Clone(c.Method()), strings.Clone(c.Path())
+
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		method+" "+path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+			attribute.String("user_agent.original", strings.Clone(c.Get(fiber.HeaderUserAgent))),
+		),
+	)
+	defer span.End()
+
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	span.SetName(method + " " + c.Route().Path)
+	span.SetAttributes(attribute.String("http.route", c.Route().Path))
+
+	if id := requestid.FromContext(ctx); id != "" {
+		span.SetAttributes(attribute.String("http.request.id", id))
+	}
+
+	status := statusOf(c, err)
+
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+	if err != nil {
+		span.RecordError(err)
+	}
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(status))
+	}
+
+	return err
+}
+
+// Returns the status code the request will be answered with.
+//
+// Errors are turned into responses by the error handler only after the middlewares return,
+// so the code is taken from the error when there is one.
+func statusOf(c *fiber.Ctx, err error) int {
+	var e *fiber.Error
+
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return fiber.StatusInternalServerError
+	}
+	return c.Response().StatusCode()
+}
+
+// headerCarrier adapts the headers of a Fiber request to the propagation.TextMapCarrier interface.
+//
+// The values are copied, as the extracted span context, e.g. its tracestate, outlives the request.
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return strings.Clone(h.c.Get(key))
+}
+
+func (h headerCarrier) Set(key string, value string) {
+	h.c.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+
+	h.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+
+	return keys
+}
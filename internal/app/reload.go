@@ -0,0 +1,72 @@
+package app
+
+import (
+	"log/slog"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Reload() re-reads the configuration and applies its reloadable parts.
+//
+// The configuration is loaded with the same flags as on startup and validated. If it is invalid, nothing changes.
+// Otherwise the reloadable sections (search, ranking, rate limit and log level) are swapped atomically in the running components,
+// while the rest (e.g. the listening address) keep their current values until restart. The secrets of the new config are redacted
+// from the logs along with the running ones. Every change is logged.
+// It returns the changes found, including the ones that were not applied.
+func (a *App) Reload() ([]utils.Change, error) {
+	const fu = "Reload()"
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cfg, err := utils.MustLoadConfig(a.flags)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		a.log.Error(
+			"can't reload the config, keeping the current one",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		return nil, err
+	}
+
+	changes := utils.Diff(a.config, cfg)
+
+	for _, c := range changes {
+		if c.Reloadable {
+			a.log.Info(
+				"config changed",
+				slog.String("op", op+fu),
+				slog.String("field", c.Field),
+				slog.String("old", c.Old),
+				slog.String("new", c.New),
+			)
+		} else {
+			a.log.Warn(
+				"config changed, but requires restart to take effect",
+				slog.String("op", op+fu),
+				slog.String("field", c.Field),
+				slog.String("old", c.Old),
+				slog.String("new", c.New),
+			)
+		}
+	}
+
+	a.redactor.SetSecrets(a.config, cfg)
+	a.config = a.config.WithReloadable(cfg)
+
+	a.level.SetBase(logger.LevelFor(a.config))
+	a.SimpleSearch.Reload(a.config)
+
+	a.log.Info(
+		"config reloaded",
+		slog.String("op", op+fu),
+		slog.Int("changes", len(changes)),
+	)
+
+	return changes, nil
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/secrets"
+)
+
+var (
+	ErrUnknownCommand = fmt.Errorf("unknown command")
+)
+
+// Secrets() implements the "secrets" commands that prepare the files of the "encrypted" secret provider.
+//
+//   - "secrets keygen" prints a new random key, to be stored in the key file;
+//   - "secrets encrypt -key-file <path> -in <plain.json> -out <secrets.enc>" encrypts a JSON object mapping the
+//     secret names (e.g. "ES_PASSWORD") to their values.
+func Secrets(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected keygen or encrypt", ErrUnknownCommand)
+	}
+
+	switch args[0] {
+	case "keygen":
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(w, key)
+		return err
+
+	case "encrypt":
+		var keyFile, in, out string
+
+		set := flag.NewFlagSet("simplesearch secrets encrypt", flag.ContinueOnError)
+
+		set.StringVar(&keyFile, "key-file", "", "file with the hex encoded key")
+		set.StringVar(&in, "in", "", "JSON file with the plaintext secrets")
+		set.StringVar(&out, "out", "", "encrypted secrets file to write")
+
+		err := set.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+
+		keyData, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+
+		key, err := secrets.ParseKey(string(keyData))
+		if err != nil {
+			return err
+		}
+
+		plain, err := os.ReadFile(in)
+		if err != nil {
+			return err
+		}
+
+		var values map[string]string
+
+		err = json.Unmarshal(plain, &values)
+		if err != nil {
+			return err
+		}
+
+		data, err := secrets.Encrypt(key, values)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(out, data, 0o600)
+
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownCommand, args[0])
+	}
+}
@@ -0,0 +1,15 @@
+package analyzer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Terms() splits the text into the lowercased terms, roughly like the standard analyzer of Elasticsearch.
+//
+// The terms are the runs of letters and digits, everything else separates them.
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
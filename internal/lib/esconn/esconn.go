@@ -0,0 +1,167 @@
+package esconn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+var (
+	ErrNoCertificates      = fmt.Errorf("no certificates found in the CA bundle")
+	ErrFingerprintMismatch = fmt.Errorf("no certificate of the server matches the pinned fingerprint")
+	ErrUntrustedChain      = fmt.Errorf("the certificate of the server isn't signed by the pinned certificate")
+)
+
+// Transport() creates the HTTP transport for connecting to ElasticSearch.
+//
+// It is shared by the service and the migrator, so both apply the same TLS settings and timeouts.
+func Transport(cfg utils.ElasticSearch) (*http.Transport, error) {
+	tlsConfig, err := TLSConfig(cfg.Transport.TLS)
+	if err != nil {
+		return &http.Transport{}, err
+	}
+
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: cfg.Transport.TLSTimeout,
+		IdleConnTimeout:     cfg.Transport.IdleTimeout,
+	}, nil
+}
+
+// TLSConfig() creates the TLS config for connecting to ElasticSearch.
+//
+// The certificate authorities from the CA bundle replace the system ones. The client certificate is presented for mTLS.
+// When a fingerprint is pinned, the regular verification is replaced by checking the certificates presented by the server
+// against the SHA-256 fingerprint, which is how ElasticSearch prints the one of its CA on first launch. Either the server
+// certificate itself is pinned, or it must be signed, for the server name, by the pinned certificate it presented (the CA).
+// The config validation rejects a fingerprint together with a CA bundle, which wouldn't be used.
+func TLSConfig(cfg utils.ESTransportTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.Insecure,
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return &tls.Config{}, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return &tls.Config{}, ErrNoCertificates
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return &tls.Config{}, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.Fingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(cfg.Fingerprint, ":", ""))
+		if err != nil {
+			return &tls.Config{}, err
+		}
+
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPinned(cs, fingerprint)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Checks the certificates of the server against the pinned fingerprint.
+//
+// Only the server certificate can be trusted by its fingerprint alone. Any other certificate is just sent along by
+// the server, so a pinned one is used as the only root the server certificate must chain to.
+func verifyPinned(cs tls.ConnectionState, fingerprint []byte) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrFingerprintMismatch
+	}
+
+	var pinned *x509.Certificate
+
+	intermediates := x509.NewCertPool()
+
+	for i, cert := range cs.PeerCertificates {
+		sum := sha256.Sum256(cert.Raw)
+
+		switch {
+		case !bytes.Equal(sum[:], fingerprint):
+			if i > 0 {
+				intermediates.AddCert(cert)
+			}
+		case i == 0:
+			return nil
+		default:
+			pinned = cert
+		}
+	}
+
+	if pinned == nil {
+		return ErrFingerprintMismatch
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(pinned)
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedChain, err)
+	}
+	return nil
+}
+
+// AuthHeader() returns the Authorization header value for the API key or the service token.
+//
+// It returns an empty string for the username and password, which are sent as basic authentication by the clients themselves.
+func AuthHeader(cfg utils.ElasticSearch) string {
+	switch {
+	case cfg.APIKey != "":
+		return "ApiKey " + cfg.APIKey
+	case cfg.ServiceToken != "":
+		return "Bearer " + cfg.ServiceToken
+	default:
+		return ""
+	}
+}
+
+// AuthRoundTripper is the http.RoundTripper that adds the Authorization header to every request.
+//
+// It is used by the clients that support only basic authentication.
+type AuthRoundTripper struct {
+	Next          http.RoundTripper
+	Authorization string
+}
+
+func (a *AuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if a.Authorization == "" {
+		return a.Next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", a.Authorization)
+
+	return a.Next.RoundTrip(req)
+}
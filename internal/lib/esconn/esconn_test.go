@@ -0,0 +1,91 @@
+package esconn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Creates a certificate signed by the parent, or a self-signed one if parent is nil.
+func newCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !isCA {
+		template.DNSNames = []string{name}
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestVerifyPinned(t *testing.T) {
+	ca, caKey := newCert(t, "Elasticsearch CA", true, nil, nil)
+	leaf, _ := newCert(t, "es01", false, ca, caKey)
+	forged, _ := newCert(t, "es01", false, nil, nil)
+	other, otherKey := newCert(t, "Other CA", true, nil, nil)
+	foreign, _ := newCert(t, "es01", false, other, otherKey)
+
+	fingerprint := func(cert *x509.Certificate) []byte {
+		sum := sha256.Sum256(cert.Raw)
+		return sum[:]
+	}
+
+	tests := []struct {
+		name  string
+		chain []*x509.Certificate
+		pin   []byte
+		host  string
+		err   error
+	}{
+		{"signed by the pinned CA", []*x509.Certificate{leaf, ca}, fingerprint(ca), "es01", nil},
+		{"pinned server certificate", []*x509.Certificate{forged}, fingerprint(forged), "anything", nil},
+		{"forged certificate sent with the pinned CA", []*x509.Certificate{forged, ca}, fingerprint(ca), "es01", ErrUntrustedChain},
+		{"signed by another CA sent with the pinned CA", []*x509.Certificate{foreign, ca}, fingerprint(ca), "es01", ErrUntrustedChain},
+		{"another server name", []*x509.Certificate{leaf, ca}, fingerprint(ca), "es02", ErrUntrustedChain},
+		{"pinned CA not sent", []*x509.Certificate{leaf}, fingerprint(ca), "es01", ErrFingerprintMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPinned(tls.ConnectionState{PeerCertificates: tt.chain, ServerName: tt.host}, tt.pin)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("verifyPinned() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
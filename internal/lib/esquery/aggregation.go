@@ -0,0 +1,148 @@
+package esquery
+
+import "encoding/json"
+
+// Aggregation is implemented by every aggregation of the DSL.
+type Aggregation interface {
+	// Source() returns the aggregation as the value of its JSON, e.g. {"terms": {"field": "category"}}.
+	Source() map[string]any
+}
+
+// TermsAggregation struct represents the terms aggregation, bucketing the documents by the values of a field.
+type TermsAggregation struct {
+	field string
+	size  *int
+	order map[string]string
+	subs  map[string]Aggregation
+}
+
+// TermsAgg() creates a terms aggregation of the field.
+func TermsAgg(field string) *TermsAggregation {
+	return &TermsAggregation{field: field}
+}
+
+// Size() sets the number of the returned buckets.
+func (a *TermsAggregation) Size(size int) *TermsAggregation {
+	a.size = &size
+	return a
+}
+
+// Order() sorts the buckets by the key (e.g. "_count" or "_key") in the order, "asc" or "desc".
+func (a *TermsAggregation) Order(key string, order string) *TermsAggregation {
+	a.order = map[string]string{key: order}
+	return a
+}
+
+// SubAggregation() adds a named aggregation computed within every bucket.
+func (a *TermsAggregation) SubAggregation(name string, agg Aggregation) *TermsAggregation {
+	if a.subs == nil {
+		a.subs = map[string]Aggregation{}
+	}
+	a.subs[name] = agg
+	return a
+}
+
+func (a *TermsAggregation) Source() map[string]any {
+	body := map[string]any{"field": a.field}
+
+	if a.size != nil {
+		body["size"] = *a.size
+	}
+	if a.order != nil {
+		body["order"] = a.order
+	}
+
+	return withSubs(map[string]any{"terms": body}, a.subs)
+}
+
+func (a *TermsAggregation) MarshalJSON() ([]byte, error) { return json.Marshal(a.Source()) }
+
+// RangeAggregation struct represents the range aggregation, bucketing the documents by the ranges of a numeric field.
+type RangeAggregation struct {
+	field  string
+	ranges []map[string]any
+	subs   map[string]Aggregation
+}
+
+// RangeAgg() creates a range aggregation of the field without ranges.
+func RangeAgg(field string) *RangeAggregation {
+	return &RangeAggregation{field: field, ranges: []map[string]any{}}
+}
+
+// AddRange() adds a bucket from the inclusive lower bound to the exclusive upper bound. Nil bounds are open.
+// The key names the bucket, if not empty.
+func (a *RangeAggregation) AddRange(key string, from *float64, to *float64) *RangeAggregation {
+	r := map[string]any{}
+
+	setString(r, "key", key)
+	if from != nil {
+		r["from"] = *from
+	}
+	if to != nil {
+		r["to"] = *to
+	}
+
+	a.ranges = append(a.ranges, r)
+	return a
+}
+
+// SubAggregation() adds a named aggregation computed within every bucket.
+func (a *RangeAggregation) SubAggregation(name string, agg Aggregation) *RangeAggregation {
+	if a.subs == nil {
+		a.subs = map[string]Aggregation{}
+	}
+	a.subs[name] = agg
+	return a
+}
+
+func (a *RangeAggregation) Source() map[string]any {
+	return withSubs(map[string]any{
+		"range": map[string]any{
+			"field":  a.field,
+			"ranges": a.ranges,
+		},
+	}, a.subs)
+}
+
+func (a *RangeAggregation) MarshalJSON() ([]byte, error) { return json.Marshal(a.Source()) }
+
+// MetricAggregation struct represents a single-value metric aggregation of a field, e.g. min, max, avg, sum or cardinality.
+type MetricAggregation struct {
+	kind  string
+	field string
+}
+
+// Min() creates a min aggregation of the field.
+func Min(field string) *MetricAggregation { return &MetricAggregation{kind: "min", field: field} }
+
+// Max() creates a max aggregation of the field.
+func Max(field string) *MetricAggregation { return &MetricAggregation{kind: "max", field: field} }
+
+// Avg() creates an avg aggregation of the field.
+func Avg(field string) *MetricAggregation { return &MetricAggregation{kind: "avg", field: field} }
+
+// Sum() creates a sum aggregation of the field.
+func Sum(field string) *MetricAggregation { return &MetricAggregation{kind: "sum", field: field} }
+
+// Cardinality() creates a cardinality aggregation, the approximate number of the distinct values of the field.
+func Cardinality(field string) *MetricAggregation {
+	return &MetricAggregation{kind: "cardinality", field: field}
+}
+
+func (a *MetricAggregation) Source() map[string]any {
+	return map[string]any{a.kind: map[string]any{"field": a.field}}
+}
+
+func (a *MetricAggregation) MarshalJSON() ([]byte, error) { return json.Marshal(a.Source()) }
+
+// Adds the sub-aggregations to the source of a bucket aggregation.
+func withSubs(source map[string]any, subs map[string]Aggregation) map[string]any {
+	if len(subs) > 0 {
+		aggs := map[string]any{}
+		for name, agg := range subs {
+			aggs[name] = agg.Source()
+		}
+		source["aggs"] = aggs
+	}
+	return source
+}
@@ -0,0 +1,238 @@
+package esquery
+
+import "encoding/json"
+
+// SearchRequest struct represents the body of a search request: the query with the paging, sorting, aggregations,
+// highlighting and collapsing of the results.
+//
+// Every builder of the package serializes to exactly the JSON of the Elasticsearch Query DSL, with the unset
+// options left out, so the bodies can be compared with the ones written by hand.
+type SearchRequest struct {
+	query     Query
+	size      *int
+	from      *int
+	sort      []Sort
+	aggs      map[string]Aggregation
+	highlight *Highlight
+	collapse  *Collapse
+	source    []string
+}
+
+// Search() creates an empty search request body.
+func Search() *SearchRequest {
+	return &SearchRequest{}
+}
+
+// Query() sets the query.
+func (s *SearchRequest) Query(query Query) *SearchRequest {
+	s.query = query
+	return s
+}
+
+// Size() sets the number of the returned hits.
+func (s *SearchRequest) Size(size int) *SearchRequest {
+	s.size = &size
+	return s
+}
+
+// From() sets the number of the hits skipped.
+func (s *SearchRequest) From(from int) *SearchRequest {
+	s.from = &from
+	return s
+}
+
+// Sort() adds the sort criteria, applied in order.
+func (s *SearchRequest) Sort(sort ...Sort) *SearchRequest {
+	s.sort = append(s.sort, sort...)
+	return s
+}
+
+// Aggregation() adds a named aggregation.
+func (s *SearchRequest) Aggregation(name string, agg Aggregation) *SearchRequest {
+	if s.aggs == nil {
+		s.aggs = map[string]Aggregation{}
+	}
+	s.aggs[name] = agg
+	return s
+}
+
+// Highlight() sets the highlighting of the hits.
+func (s *SearchRequest) Highlight(h *Highlight) *SearchRequest {
+	s.highlight = h
+	return s
+}
+
+// Collapse() sets the collapsing of the hits.
+func (s *SearchRequest) Collapse(c *Collapse) *SearchRequest {
+	s.collapse = c
+	return s
+}
+
+// Source() limits the returned _source to the fields.
+func (s *SearchRequest) Source(fields ...string) *SearchRequest {
+	s.source = fields
+	return s
+}
+
+func (s *SearchRequest) MarshalJSON() ([]byte, error) {
+	body := map[string]any{}
+
+	if s.query != nil {
+		body["query"] = s.query.Source()
+	}
+	if s.size != nil {
+		body["size"] = *s.size
+	}
+	if s.from != nil {
+		body["from"] = *s.from
+	}
+	if len(s.sort) > 0 {
+		var sort []any
+		for _, v := range s.sort {
+			sort = append(sort, v.source())
+		}
+		body["sort"] = sort
+	}
+	if len(s.aggs) > 0 {
+		aggs := map[string]any{}
+		for name, agg := range s.aggs {
+			aggs[name] = agg.Source()
+		}
+		body["aggs"] = aggs
+	}
+	if s.highlight != nil {
+		body["highlight"] = s.highlight.source()
+	}
+	if s.collapse != nil {
+		body["collapse"] = s.collapse.source()
+	}
+	if s.source != nil {
+		body["_source"] = s.source
+	}
+
+	return json.Marshal(body)
+}
+
+// Sort struct represents a sort criterion.
+type Sort struct {
+	field   string
+	order   string
+	missing any
+}
+
+// SortBy() sorts by the field in the order, "asc" or "desc".
+func SortBy(field string, order string) Sort {
+	return Sort{field: field, order: order}
+}
+
+// SortByScore() sorts by the score, the best first.
+func SortByScore() Sort {
+	return Sort{field: "_score"}
+}
+
+// Missing() sets where the documents without the field go, "_first", "_last" or a value standing for the missing one.
+func (s Sort) Missing(missing any) Sort {
+	s.missing = missing
+	return s
+}
+
+func (s Sort) source() any {
+	if s.order == "" && s.missing == nil {
+		return s.field
+	}
+
+	body := map[string]any{}
+
+	setString(body, "order", s.order)
+	if s.missing != nil {
+		body["missing"] = s.missing
+	}
+
+	return map[string]any{s.field: body}
+}
+
+// Highlight struct represents the highlighting of the matched terms in the fields of the hits.
+type Highlight struct {
+	fields       map[string]map[string]any
+	preTags      []string
+	postTags     []string
+	fragmentSize *int
+}
+
+// NewHighlight() creates a highlighting of the fields.
+func NewHighlight(fields ...string) *Highlight {
+	h := &Highlight{fields: map[string]map[string]any{}}
+	for _, f := range fields {
+		h.fields[f] = map[string]any{}
+	}
+	return h
+}
+
+// Tags() sets the tags wrapping the highlighted terms, "<em>" and "</em>" by default.
+func (h *Highlight) Tags(pre string, post string) *Highlight {
+	h.preTags = []string{pre}
+	h.postTags = []string{post}
+	return h
+}
+
+// FragmentSize() sets the size of the highlighted fragments in characters.
+func (h *Highlight) FragmentSize(size int) *Highlight {
+	h.fragmentSize = &size
+	return h
+}
+
+// NumberOfFragments() sets the maximal number of the fragments of the field, 0 highlighting the whole field.
+func (h *Highlight) NumberOfFragments(field string, n int) *Highlight {
+	if h.fields[field] == nil {
+		h.fields[field] = map[string]any{}
+	}
+	h.fields[field]["number_of_fragments"] = n
+	return h
+}
+
+func (h *Highlight) source() map[string]any {
+	body := map[string]any{"fields": h.fields}
+
+	if h.preTags != nil {
+		body["pre_tags"] = h.preTags
+		body["post_tags"] = h.postTags
+	}
+	if h.fragmentSize != nil {
+		body["fragment_size"] = *h.fragmentSize
+	}
+
+	return body
+}
+
+// Collapse struct represents the collapsing of the hits by a keyword or numeric field, leaving the best hit of every value.
+type Collapse struct {
+	field     string
+	innerHits map[string]any
+}
+
+// CollapseBy() collapses the hits by the field.
+func CollapseBy(field string) *Collapse {
+	return &Collapse{field: field}
+}
+
+// InnerHits() returns up to size collapsed hits of every value under the name, sorted by the sort criteria.
+func (c *Collapse) InnerHits(name string, size int, sort ...Sort) *Collapse {
+	c.innerHits = map[string]any{"name": name, "size": size}
+
+	if len(sort) > 0 {
+		var s []any
+		for _, v := range sort {
+			s = append(s, v.source())
+		}
+		c.innerHits["sort"] = s
+	}
+	return c
+}
+
+func (c *Collapse) source() map[string]any {
+	body := map[string]any{"field": c.field}
+	if c.innerHits != nil {
+		body["inner_hits"] = c.innerHits
+	}
+	return body
+}
@@ -0,0 +1,138 @@
+package esquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	low, high := 100.0, 500.0
+
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{
+			name: "empty search",
+			v:    Search(),
+			want: `{}`,
+		},
+		{
+			name: "bool",
+			v: Bool().
+				Must(MultiMatch("apple macbook", "name^3", "description").Type("most_fields").Operator("and")).
+				Filter(Range("price").Gte(0).Lte(1000), Term("category", "laptop")).
+				MustNot(Match("stock", 0)).
+				Should(Terms("brand", "apple", "dell")).
+				MinimumShouldMatch(1).
+				Boost(2),
+			want: `{"bool": {
+				"must": [{"multi_match": {"query": "apple macbook", "fields": ["name^3", "description"], "type": "most_fields", "operator": "and"}}],
+				"filter": [{"range": {"price": {"gte": 0, "lte": 1000}}}, {"term": {"category": "laptop"}}],
+				"must_not": [{"match": {"stock": 0}}],
+				"should": [{"terms": {"brand": ["apple", "dell"]}}],
+				"minimum_should_match": 1,
+				"boost": 2
+			}}`,
+		},
+		{
+			name: "long forms",
+			v: Bool().Should(
+				Match("name", "apple").Operator("and").Boost(2),
+				Term("category", "laptop").Boost(1.5),
+				Range("created_at").Gt("now-1y").Lt("now").Format("date_math"),
+				MatchAll(),
+			),
+			want: `{"bool": {"should": [
+				{"match": {"name": {"query": "apple", "operator": "and", "boost": 2}}},
+				{"term": {"category": {"value": "laptop", "boost": 1.5}}},
+				{"range": {"created_at": {"gt": "now-1y", "lt": "now", "format": "date_math"}}},
+				{"match_all": {}}
+			]}}`,
+		},
+		{
+			name: "function score",
+			v: FunctionScore(MultiMatch("phone", "name")).
+				Add(
+					FieldValueFactor("stock").Factor(1.2).Modifier("log1p").Missing(1),
+					Weight(2).Filter(Term("category", "smartphone")),
+					Decay("gauss", "created_at", "now", "30d").WithWeight(0.5),
+				).
+				ScoreMode("sum").
+				BoostMode("multiply").
+				MaxBoost(10),
+			want: `{"function_score": {
+				"query": {"multi_match": {"query": "phone", "fields": ["name"]}},
+				"functions": [
+					{"field_value_factor": {"field": "stock", "factor": 1.2, "modifier": "log1p", "missing": 1}},
+					{"filter": {"term": {"category": "smartphone"}}, "weight": 2},
+					{"gauss": {"created_at": {"origin": "now", "scale": "30d"}}, "weight": 0.5}
+				],
+				"score_mode": "sum",
+				"boost_mode": "multiply",
+				"max_boost": 10
+			}}`,
+		},
+		{
+			name: "search",
+			v: Search().
+				Query(MatchAll()).
+				Size(10).
+				From(20).
+				Sort(SortByScore(), SortBy("price", "asc").Missing("_last"), SortBy("created_at", "")).
+				Aggregation("categories", TermsAgg("category").Size(5).Order("_count", "desc").SubAggregation("avg_price", Avg("price"))).
+				Aggregation("prices", RangeAgg("price").AddRange("cheap", nil, &low).AddRange("", &low, &high).AddRange("expensive", &high, nil)).
+				Aggregation("max_price", Max("price")).
+				Highlight(NewHighlight("name", "description").Tags("<b>", "</b>").FragmentSize(50).NumberOfFragments("name", 0)).
+				Collapse(CollapseBy("category").InnerHits("cheapest", 3, SortBy("price", "asc"))).
+				Source("name", "price"),
+			want: `{
+				"query": {"match_all": {}},
+				"size": 10,
+				"from": 20,
+				"sort": ["_score", {"price": {"order": "asc", "missing": "_last"}}, "created_at"],
+				"aggs": {
+					"categories": {"terms": {"field": "category", "size": 5, "order": {"_count": "desc"}}, "aggs": {"avg_price": {"avg": {"field": "price"}}}},
+					"prices": {"range": {"field": "price", "ranges": [{"key": "cheap", "to": 100}, {"from": 100, "to": 500}, {"key": "expensive", "from": 500}]}},
+					"max_price": {"max": {"field": "price"}}
+				},
+				"highlight": {"fields": {"name": {"number_of_fragments": 0}, "description": {}}, "pre_tags": ["<b>"], "post_tags": ["</b>"], "fragment_size": 50},
+				"collapse": {"field": "category", "inner_hits": {"name": "cheapest", "size": 3, "sort": [{"price": {"order": "asc"}}]}},
+				"_source": ["name", "price"]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(canonical(t, got), canonical(t, []byte(tt.want))) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Returns the JSON with the keys sorted and the whitespace removed.
+func canonical(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var v any
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
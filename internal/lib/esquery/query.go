@@ -0,0 +1,482 @@
+package esquery
+
+import "encoding/json"
+
+// Query is implemented by every query of the DSL.
+type Query interface {
+	// Source() returns the query as the value of its JSON, e.g. {"term": {"category": "laptop"}}.
+	Source() map[string]any
+}
+
+// BoolQuery struct represents the bool query, matching the documents by a boolean combination of the other queries.
+type BoolQuery struct {
+	must               []Query
+	filter             []Query
+	mustNot            []Query
+	should             []Query
+	minimumShouldMatch any
+	boost              *float64
+}
+
+// Bool() creates an empty bool query.
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+// Must() adds the queries that must match and contribute to the score.
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Filter() adds the queries that must match without contributing to the score.
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// MustNot() adds the queries that must not match.
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// Should() adds the queries that should match.
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// MinimumShouldMatch() sets the number or the percentage (e.g. "75%") of the should queries that must match.
+func (q *BoolQuery) MinimumShouldMatch(v any) *BoolQuery {
+	q.minimumShouldMatch = v
+	return q
+}
+
+// Boost() sets the boost of the query.
+func (q *BoolQuery) Boost(boost float64) *BoolQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *BoolQuery) Source() map[string]any {
+	body := map[string]any{}
+
+	for occur, queries := range map[string][]Query{
+		"must":     q.must,
+		"filter":   q.filter,
+		"must_not": q.mustNot,
+		"should":   q.should,
+	} {
+		if len(queries) > 0 {
+			body[occur] = sources(queries)
+		}
+	}
+
+	if q.minimumShouldMatch != nil {
+		body["minimum_should_match"] = q.minimumShouldMatch
+	}
+	setBoost(body, q.boost)
+
+	return map[string]any{"bool": body}
+}
+
+func (q *BoolQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// MultiMatchQuery struct represents the multi_match query, matching the text against several fields.
+type MultiMatchQuery struct {
+	query    any
+	fields   []string
+	typ      string
+	operator string
+	boost    *float64
+}
+
+// MultiMatch() creates a multi_match query of the text against the fields, which can be boosted, e.g. "name^3".
+func MultiMatch(query any, fields ...string) *MultiMatchQuery {
+	return &MultiMatchQuery{query: query, fields: fields}
+}
+
+// Type() sets the type of the query, e.g. "best_fields" (the default), "most_fields" or "phrase".
+func (q *MultiMatchQuery) Type(typ string) *MultiMatchQuery {
+	q.typ = typ
+	return q
+}
+
+// Operator() sets the operator combining the terms of the text, "or" (the default) or "and".
+func (q *MultiMatchQuery) Operator(operator string) *MultiMatchQuery {
+	q.operator = operator
+	return q
+}
+
+// Boost() sets the boost of the query.
+func (q *MultiMatchQuery) Boost(boost float64) *MultiMatchQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *MultiMatchQuery) Source() map[string]any {
+	body := map[string]any{
+		"query":  q.query,
+		"fields": q.fields,
+	}
+
+	setString(body, "type", q.typ)
+	setString(body, "operator", q.operator)
+	setBoost(body, q.boost)
+
+	return map[string]any{"multi_match": body}
+}
+
+func (q *MultiMatchQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// MatchQuery struct represents the match query, matching the analyzed text against a field.
+//
+// Without options it is serialized in the short form, {"match": {"field": query}}.
+type MatchQuery struct {
+	field    string
+	query    any
+	operator string
+	boost    *float64
+}
+
+// Match() creates a match query of the text against the field.
+func Match(field string, query any) *MatchQuery {
+	return &MatchQuery{field: field, query: query}
+}
+
+// Operator() sets the operator combining the terms of the text, "or" (the default) or "and".
+func (q *MatchQuery) Operator(operator string) *MatchQuery {
+	q.operator = operator
+	return q
+}
+
+// Boost() sets the boost of the query.
+func (q *MatchQuery) Boost(boost float64) *MatchQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *MatchQuery) Source() map[string]any {
+	if q.operator == "" && q.boost == nil {
+		return map[string]any{"match": map[string]any{q.field: q.query}}
+	}
+
+	body := map[string]any{"query": q.query}
+
+	setString(body, "operator", q.operator)
+	setBoost(body, q.boost)
+
+	return map[string]any{"match": map[string]any{q.field: body}}
+}
+
+func (q *MatchQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// TermQuery struct represents the term query, matching the exact value of a field.
+//
+// Without options it is serialized in the short form, {"term": {"field": value}}.
+type TermQuery struct {
+	field string
+	value any
+	boost *float64
+}
+
+// Term() creates a term query of the exact value of the field.
+func Term(field string, value any) *TermQuery {
+	return &TermQuery{field: field, value: value}
+}
+
+// Boost() sets the boost of the query.
+func (q *TermQuery) Boost(boost float64) *TermQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *TermQuery) Source() map[string]any {
+	if q.boost == nil {
+		return map[string]any{"term": map[string]any{q.field: q.value}}
+	}
+
+	body := map[string]any{"value": q.value}
+	setBoost(body, q.boost)
+
+	return map[string]any{"term": map[string]any{q.field: body}}
+}
+
+func (q *TermQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// TermsQuery struct represents the terms query, matching any of the exact values of a field.
+type TermsQuery struct {
+	field  string
+	values []any
+	boost  *float64
+}
+
+// Terms() creates a terms query of the exact values of the field.
+func Terms(field string, values ...any) *TermsQuery {
+	return &TermsQuery{field: field, values: values}
+}
+
+// Boost() sets the boost of the query.
+func (q *TermsQuery) Boost(boost float64) *TermsQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *TermsQuery) Source() map[string]any {
+	values := q.values
+	if values == nil {
+		values = []any{}
+	}
+
+	body := map[string]any{q.field: values}
+	setBoost(body, q.boost)
+
+	return map[string]any{"terms": body}
+}
+
+func (q *TermsQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// RangeQuery struct represents the range query, matching the values of a field within the bounds.
+type RangeQuery struct {
+	field  string
+	bounds map[string]any
+	format string
+	boost  *float64
+}
+
+// Range() creates a range query of the field without bounds.
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, bounds: map[string]any{}}
+}
+
+// Gte() sets the inclusive lower bound.
+func (q *RangeQuery) Gte(v any) *RangeQuery {
+	q.bounds["gte"] = v
+	return q
+}
+
+// Gt() sets the exclusive lower bound.
+func (q *RangeQuery) Gt(v any) *RangeQuery {
+	q.bounds["gt"] = v
+	return q
+}
+
+// Lte() sets the inclusive upper bound.
+func (q *RangeQuery) Lte(v any) *RangeQuery {
+	q.bounds["lte"] = v
+	return q
+}
+
+// Lt() sets the exclusive upper bound.
+func (q *RangeQuery) Lt(v any) *RangeQuery {
+	q.bounds["lt"] = v
+	return q
+}
+
+// Format() sets the format of the date bounds.
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.format = format
+	return q
+}
+
+// Boost() sets the boost of the query.
+func (q *RangeQuery) Boost(boost float64) *RangeQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *RangeQuery) Source() map[string]any {
+	body := map[string]any{}
+	for k, v := range q.bounds {
+		body[k] = v
+	}
+
+	setString(body, "format", q.format)
+	setBoost(body, q.boost)
+
+	return map[string]any{"range": map[string]any{q.field: body}}
+}
+
+func (q *RangeQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// MatchAllQuery struct represents the match_all query, matching every document.
+type MatchAllQuery struct{}
+
+// MatchAll() creates a match_all query.
+func MatchAll() *MatchAllQuery {
+	return &MatchAllQuery{}
+}
+
+func (q *MatchAllQuery) Source() map[string]any {
+	return map[string]any{"match_all": map[string]any{}}
+}
+
+func (q *MatchAllQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// FunctionScoreQuery struct represents the function_score query, modifying the scores of the documents matched
+// by the query with the functions.
+type FunctionScoreQuery struct {
+	query     Query
+	functions []Function
+	scoreMode string
+	boostMode string
+	maxBoost  *float64
+}
+
+// FunctionScore() creates a function_score query modifying the scores of the query.
+func FunctionScore(query Query) *FunctionScoreQuery {
+	return &FunctionScoreQuery{query: query}
+}
+
+// Add() adds the functions.
+func (q *FunctionScoreQuery) Add(functions ...Function) *FunctionScoreQuery {
+	q.functions = append(q.functions, functions...)
+	return q
+}
+
+// ScoreMode() sets how the scores of the functions are combined, e.g. "multiply" (the default) or "sum".
+func (q *FunctionScoreQuery) ScoreMode(mode string) *FunctionScoreQuery {
+	q.scoreMode = mode
+	return q
+}
+
+// BoostMode() sets how the combined score of the functions is combined with the query score, e.g. "multiply" (the default) or "replace".
+func (q *FunctionScoreQuery) BoostMode(mode string) *FunctionScoreQuery {
+	q.boostMode = mode
+	return q
+}
+
+// MaxBoost() caps the combined score of the functions.
+func (q *FunctionScoreQuery) MaxBoost(maxBoost float64) *FunctionScoreQuery {
+	q.maxBoost = &maxBoost
+	return q
+}
+
+func (q *FunctionScoreQuery) Source() map[string]any {
+	body := map[string]any{}
+
+	if q.query != nil {
+		body["query"] = q.query.Source()
+	}
+	if len(q.functions) > 0 {
+		var functions []map[string]any
+		for _, f := range q.functions {
+			functions = append(functions, f.Source())
+		}
+		body["functions"] = functions
+	}
+
+	setString(body, "score_mode", q.scoreMode)
+	setString(body, "boost_mode", q.boostMode)
+	if q.maxBoost != nil {
+		body["max_boost"] = *q.maxBoost
+	}
+
+	return map[string]any{"function_score": body}
+}
+
+func (q *FunctionScoreQuery) MarshalJSON() ([]byte, error) { return json.Marshal(q.Source()) }
+
+// Function is implemented by the score functions of the function_score query.
+type Function interface {
+	Source() map[string]any
+}
+
+// ScoreFunction struct represents a score function of the function_score query, optionally applied only to the documents
+// matching its filter and weighted.
+type ScoreFunction struct {
+	kind   string
+	params map[string]any
+	filter Query
+	weight *float64
+}
+
+// Weight() creates a function scoring the weight.
+func Weight(weight float64) *ScoreFunction {
+	return &ScoreFunction{weight: &weight}
+}
+
+// FieldValueFactor() creates a function scoring the numeric value of the field.
+func FieldValueFactor(field string) *ScoreFunction {
+	return &ScoreFunction{kind: "field_value_factor", params: map[string]any{"field": field}}
+}
+
+// Decay() creates a decay function ("gauss", "linear" or "exp") scoring the distance of the field value from the origin.
+func Decay(kind string, field string, origin any, scale any) *ScoreFunction {
+	return &ScoreFunction{
+		kind: kind,
+		params: map[string]any{
+			field: map[string]any{"origin": origin, "scale": scale},
+		},
+	}
+}
+
+// Factor() sets the factor of the field value, for the field_value_factor function.
+func (f *ScoreFunction) Factor(factor float64) *ScoreFunction {
+	f.params["factor"] = factor
+	return f
+}
+
+// Modifier() sets the modifier of the field value, e.g. "log1p" or "sqrt", for the field_value_factor function.
+func (f *ScoreFunction) Modifier(modifier string) *ScoreFunction {
+	f.params["modifier"] = modifier
+	return f
+}
+
+// Missing() sets the value used for the documents without the field, for the field_value_factor function.
+func (f *ScoreFunction) Missing(missing float64) *ScoreFunction {
+	f.params["missing"] = missing
+	return f
+}
+
+// Filter() applies the function only to the documents matching the query.
+func (f *ScoreFunction) Filter(query Query) *ScoreFunction {
+	f.filter = query
+	return f
+}
+
+// WithWeight() multiplies the score of the function by the weight.
+func (f *ScoreFunction) WithWeight(weight float64) *ScoreFunction {
+	f.weight = &weight
+	return f
+}
+
+func (f *ScoreFunction) Source() map[string]any {
+	body := map[string]any{}
+
+	if f.kind != "" {
+		body[f.kind] = f.params
+	}
+	if f.filter != nil {
+		body["filter"] = f.filter.Source()
+	}
+	if f.weight != nil {
+		body["weight"] = *f.weight
+	}
+
+	return body
+}
+
+func (f *ScoreFunction) MarshalJSON() ([]byte, error) { return json.Marshal(f.Source()) }
+
+// Returns the sources of the queries.
+func sources(queries []Query) []map[string]any {
+	s := make([]map[string]any, 0, len(queries))
+	for _, q := range queries {
+		s = append(s, q.Source())
+	}
+	return s
+}
+
+func setString(body map[string]any, key string, v string) {
+	if v != "" {
+		body[key] = v
+	}
+}
+
+func setBoost(body map[string]any, boost *float64) {
+	if boost != nil {
+		body["boost"] = *boost
+	}
+}
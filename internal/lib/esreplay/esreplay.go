@@ -0,0 +1,258 @@
+package esreplay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Mode of the Transport.
+type Mode int
+
+const (
+	// Replay serves the responses from the fixture file, without any requests made.
+	Replay Mode = iota
+	// Record makes the requests through the underlying transport and saves the interactions into the fixture file.
+	Record
+)
+
+var (
+	ErrNoInteraction = fmt.Errorf("no recorded interaction matches the request")
+	ErrNotRecording  = fmt.Errorf("transport is not recording")
+)
+
+// Response headers that are not recorded, as they change on every request or don't match the compacted body.
+var volatileHeaders = []string{"Date", "Content-Length"}
+
+// Interaction struct represents a recorded request with its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request struct represents a recorded request.
+//
+// Only the method, the path with the query and the body are recorded, so neither the address of the cluster
+// nor the credentials end up in the fixtures. The bodies that are not JSON are stored as JSON strings.
+type Request struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response struct represents a recorded response.
+type Response struct {
+	StatusCode int             `json:"status_code"`
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// Transport struct represents an http.RoundTripper for the ElasticSearch client that records the interactions
+// with a cluster into a fixture file, or replays them from it, so the code using the client can be tested offline.
+//
+// On replay a request is answered with the first unused interaction with the same method, URL and body,
+// the JSON bodies being compared regardless of their formatting and key order.
+type Transport struct {
+	mode Mode
+	path string
+	next http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// New creates a new Transport for the fixture file.
+//
+// In the Replay mode the fixture file is loaded and next is not used. In the Record mode the requests are made
+// through next (http.DefaultTransport if nil), and the fixture file is written by Save().
+func New(path string, mode Mode, next http.RoundTripper) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	t := &Transport{
+		mode: mode,
+		path: path,
+		next: next,
+	}
+
+	if mode == Record {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &Transport{}, err
+	}
+
+	err = json.Unmarshal(data, &t.interactions)
+	if err != nil {
+		return &Transport{}, fmt.Errorf("%s: %w", path, err)
+	}
+	t.used = make([]bool, len(t.interactions))
+
+	return t, nil
+}
+
+// RoundTrip() replays or records the request, depending on the mode.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := Request{
+		Method: req.Method,
+		URL:    req.URL.RequestURI(),
+		Body:   rawBody(body),
+	}
+
+	if t.mode == Record {
+		return t.record(req, recorded)
+	}
+	return t.replay(req, recorded)
+}
+
+// Save() writes the recorded interactions into the fixture file, creating its directory.
+func (t *Transport) Save() error {
+	if t.mode != Record {
+		return ErrNotRecording
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, err := json.MarshalIndent(t.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(t.path), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, append(data, '\n'), 0o644)
+}
+
+func (t *Transport) record(req *http.Request, recorded Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := resp.Header.Clone()
+	for _, h := range volatileHeaders {
+		header.Del(h)
+	}
+
+	t.mu.Lock()
+	t.interactions = append(t.interactions, Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       rawBody(body),
+		},
+	})
+	t.mu.Unlock()
+
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, in := range t.interactions {
+		if t.used[i] || !matches(in.Request, recorded) {
+			continue
+		}
+		t.used[i] = true
+
+		body := in.Response.Body
+
+		var s string
+		if json.Unmarshal(body, &s) == nil {
+			body = []byte(s)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, recorded.Method, recorded.URL)
+}
+
+// Reads the body and replaces it with a copy, so it can still be read by the caller.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*body = io.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+// Returns the body to be stored in a fixture: compacted if it is JSON, or as a JSON string otherwise.
+func rawBody(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	if json.Valid(body) && json.Compact(&buf, body) == nil {
+		return buf.Bytes()
+	}
+
+	s, _ := json.Marshal(string(body))
+	return s
+}
+
+// Reports whether the requests are the same, comparing their JSON bodies by value.
+func matches(a Request, b Request) bool {
+	if a.Method != b.Method || a.URL != b.URL {
+		return false
+	}
+	if len(a.Body) == 0 || len(b.Body) == 0 {
+		return len(a.Body) == len(b.Body)
+	}
+
+	var va, vb any
+
+	if json.Unmarshal(a.Body, &va) != nil || json.Unmarshal(b.Body, &vb) != nil {
+		return bytes.Equal(a.Body, b.Body)
+	}
+
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+
+	return bytes.Equal(ca, cb)
+}
@@ -0,0 +1,85 @@
+package esreplay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Write([]byte(`{"echo": ` + string(body) + `}`))
+	}))
+	defer srv.Close()
+
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder, err := New(fixture, Record, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := roundTrip(t, recorder, srv.URL+"/products/_search?pretty=true", `{"query": {"match_all": {}}, "size": 1}`)
+
+	err = recorder.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := New(fixture, Replay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The address doesn't matter, and the JSON body matches regardless of its formatting and key order.
+	got := roundTrip(t, replayer, "http://elsewhere:9200/products/_search?pretty=true", `{"size":1,"query":{"match_all":{}}}`)
+
+	if got != want {
+		t.Errorf("replayed body = %s, want %s", got, want)
+	}
+	if calls != 1 {
+		t.Errorf("server called %d times, want 1", calls)
+	}
+
+	// Every interaction is replayed once.
+	req, _ := http.NewRequest(http.MethodPost, "http://elsewhere:9200/products/_search?pretty=true", strings.NewReader(`{"size":1,"query":{"match_all":{}}}`))
+
+	_, err = replayer.RoundTrip(req)
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, ErrNoInteraction)
+	}
+}
+
+func roundTrip(t *testing.T, rt http.RoundTripper, url string, body string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("X-Elastic-Product") != "Elasticsearch" {
+		t.Errorf("X-Elastic-Product header = %q", resp.Header.Get("X-Elastic-Product"))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(strings.Fields(string(data)), "")
+}
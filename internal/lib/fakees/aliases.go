@@ -0,0 +1,310 @@
+package fakees
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returns the index of the name, resolving an alias. The name is returned as is if it is unknown.
+// Must be called with the mutex held.
+func (s *Server) lookup(name string) (string, *index, bool) {
+	if index, ok := s.aliases[name]; ok {
+		name = index
+	}
+	ix, ok := s.indices[name]
+	return name, ix, ok
+}
+
+// Returns the sorted indices of the name: an index, an alias, or a pattern ending with "*".
+// Must be called with the mutex held.
+func (s *Server) expand(name string) []string {
+	prefix, pattern := strings.CutSuffix(name, "*")
+	if !pattern {
+		if concrete, _, ok := s.lookup(name); ok {
+			return []string{concrete}
+		}
+		return nil
+	}
+
+	var names []string
+	for n := range s.indices {
+		if strings.HasPrefix(n, prefix) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Returns the aliases of the index, as in the get index response.
+// Must be called with the mutex held.
+func (s *Server) aliasesOf(name string) map[string]any {
+	aliases := map[string]any{}
+	for alias, index := range s.aliases {
+		if index == name {
+			aliases[alias] = map[string]any{}
+		}
+	}
+	return aliases
+}
+
+// Applies the add, remove and remove_index actions atomically: all of them or none.
+// An alias points to a single index in the fake.
+func (s *Server) updateAliases(w http.ResponseWriter, r *http.Request) {
+	type target struct {
+		Index string `json:"index"`
+		Alias string `json:"alias"`
+	}
+
+	var body struct {
+		Actions []map[string]target `json:"actions"`
+	}
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases := make(map[string]string, len(s.aliases))
+	for alias, index := range s.aliases {
+		aliases[alias] = index
+	}
+	removed := map[string]bool{}
+
+	for _, action := range body.Actions {
+		for op, t := range action {
+			if _, ok := s.indices[t.Index]; !ok || removed[t.Index] {
+				writeIndexNotFound(w, t.Index)
+				return
+			}
+
+			switch op {
+			case "add":
+				if _, ok := s.indices[t.Alias]; ok && !removed[t.Alias] {
+					writeError(w, http.StatusBadRequest, "invalid_alias_name_exception",
+						fmt.Sprintf("Invalid alias name [%s]: an index or data stream exists with the same name as the alias", t.Alias))
+					return
+				}
+				aliases[t.Alias] = t.Index
+
+			case "remove":
+				if aliases[t.Alias] != t.Index {
+					writeError(w, http.StatusNotFound, "aliases_not_found_exception", fmt.Sprintf("aliases [%s] missing", t.Alias))
+					return
+				}
+				delete(aliases, t.Alias)
+
+			case "remove_index":
+				removed[t.Index] = true
+				for alias, index := range aliases {
+					if index == t.Index {
+						delete(aliases, alias)
+					}
+				}
+
+			default:
+				writeError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf("unknown alias action [%s]", op))
+				return
+			}
+		}
+	}
+
+	for name := range removed {
+		delete(s.indices, name)
+	}
+	s.aliases = aliases
+
+	writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true, "errors": false})
+}
+
+func (s *Server) count(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ix, ok := s.lookup(name)
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"count":   len(ix.docs),
+		"_shards": map[string]any{"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+	})
+}
+
+// Copies the documents of the source index to the destination one, transformed by the script.
+//
+// The copy is made at once, with wait_for_completion=false it is returned as a completed task.
+// The scripts are a subset of Painless: statements assigning a literal to a field of ctx._source,
+// or removing a field with ctx._source.remove('field').
+func (s *Server) reindex(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var body struct {
+		Source struct {
+			Index string `json:"index"`
+		} `json:"source"`
+		Dest struct {
+			Index string `json:"index"`
+		} `json:"dest"`
+		Script struct {
+			Source string `json:"source"`
+		} `json:"script"`
+	}
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	transform, err := parseScript(body.Script.Source)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "script_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, src, ok := s.lookup(body.Source.Index)
+	if !ok {
+		writeIndexNotFound(w, body.Source.Index)
+		return
+	}
+
+	var created, updated int
+	var failures []map[string]any
+
+	for _, id := range src.order {
+		source, err := transform(src.docs[id].source)
+		if err == nil {
+			_, status, applyErr := s.applyAction("index", body.Dest.Index, id, source)
+			switch {
+			case applyErr != nil:
+				err = applyErr
+			case status == http.StatusCreated:
+				created++
+			default:
+				updated++
+			}
+		}
+		if err != nil {
+			failures = append(failures, map[string]any{"index": body.Dest.Index, "id": id, "cause": map[string]any{"reason": err.Error()}})
+		}
+	}
+
+	response := map[string]any{
+		"took":     time.Since(start).Milliseconds(),
+		"total":    len(src.order),
+		"created":  created,
+		"updated":  updated,
+		"deleted":  0,
+		"noops":    0,
+		"failures": append([]map[string]any{}, failures...),
+	}
+
+	if r.URL.Query().Get("wait_for_completion") != "false" {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	id := "fakees:" + strconv.Itoa(len(s.tasks)+1)
+	s.tasks[id] = map[string]any{
+		"completed": true,
+		"task":      map[string]any{"node": "fakees", "id": len(s.tasks) + 1, "action": "indices:data/write/reindex"},
+		"response":  response,
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"task": id})
+}
+
+func (s *Server) task(w http.ResponseWriter, id string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tasks[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "resource_not_found_exception", fmt.Sprintf("task [%s] isn't running and hasn't stored its results", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+var (
+	assignment = regexp.MustCompile(`^ctx\._source\.(\w+)\s*=\s*(.+)$`)
+	removal    = regexp.MustCompile(`^ctx\._source\.remove\(\s*['"](\w+)['"]\s*\)$`)
+)
+
+// Parses the supported subset of Painless into a transformation of the sources.
+func parseScript(script string) (func(json.RawMessage) (json.RawMessage, error), error) {
+	type statement struct {
+		field  string
+		value  any
+		remove bool
+	}
+
+	var statements []statement
+
+	for _, line := range strings.Split(script, ";") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if m := removal.FindStringSubmatch(line); m != nil {
+			statements = append(statements, statement{field: m[1], remove: true})
+			continue
+		}
+
+		m := assignment.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported statement [%s]", line)
+		}
+
+		literal := m[2]
+		if strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") {
+			literal = strconv.Quote(strings.Trim(literal, "'"))
+		}
+
+		var value any
+		if err := json.Unmarshal([]byte(literal), &value); err != nil {
+			return nil, fmt.Errorf("unsupported value [%s]", m[2])
+		}
+		statements = append(statements, statement{field: m[1], value: value})
+	}
+
+	return func(source json.RawMessage) (json.RawMessage, error) {
+		if len(statements) == 0 {
+			return source, nil
+		}
+
+		var fields map[string]any
+		if err := json.Unmarshal(source, &fields); err != nil {
+			return nil, err
+		}
+
+		for _, st := range statements {
+			if st.remove {
+				delete(fields, st.field)
+				continue
+			}
+			fields[st.field] = st.value
+		}
+
+		return json.Marshal(fields)
+	}, nil
+}
@@ -0,0 +1,950 @@
+package fakees
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+)
+
+// Version of Elasticsearch reported by the fake.
+const Version = "8.17.1"
+
+// Server struct is an in-memory fake of the subset of the Elasticsearch REST API used by SimpleSearch and the migrator.
+//
+// It implements the index create, get, clone and delete, the mapping and settings put, the write block, the aliases, _bulk, _mget, _doc get, index and delete,
+// _count, _reindex as a task, and _search with the bool, multi_match, match, term, terms, range and match_all queries. The scoring is simplified: a text field scores
+// the number of the matched query terms. Every response carries the X-Elastic-Product header, so the official
+// clients accept it. It is an http.Handler, so it can be served with httptest.NewServer() in tests.
+type Server struct {
+	mu      sync.RWMutex
+	indices map[string]*index
+	aliases map[string]string
+	tasks   map[string]map[string]any
+	mux     *http.ServeMux
+}
+
+// Index with its settings, mappings and documents in the order they were first indexed.
+type index struct {
+	settings map[string]any
+	mappings map[string]any
+	types    map[string]string
+	docs     map[string]*document
+	order    []string
+	seq      int
+}
+
+type document struct {
+	source json.RawMessage
+	fields map[string]any
+}
+
+// New() creates a fake with no indices.
+func New() *Server {
+	s := &Server{
+		indices: make(map[string]*index),
+		aliases: make(map[string]string),
+		tasks:   make(map[string]map[string]any),
+		mux:     http.NewServeMux(),
+	}
+
+	// The GET patterns match HEAD too.
+	s.mux.HandleFunc("GET /{$}", s.info)
+	s.mux.HandleFunc("GET /_nodes/http", s.nodes)
+	s.mux.HandleFunc("GET /_cluster/health", s.health)
+
+	s.mux.HandleFunc("PUT /{index}", s.createIndex)
+	s.mux.HandleFunc("GET /{index}", s.getIndex)
+	s.mux.HandleFunc("DELETE /{index}", s.deleteIndex)
+	s.mux.HandleFunc("POST /{index}/_refresh", s.refresh)
+	s.mux.HandleFunc("PUT /{index}/_mapping", s.putMapping)
+	s.mux.HandleFunc("PUT /{index}/_settings", s.putSettings)
+	s.mux.HandleFunc("POST /{index}/_clone/{target}", s.cloneIndex)
+	s.mux.HandleFunc("PUT /{index}/_clone/{target}", s.cloneIndex)
+	s.mux.HandleFunc("POST /{index}/_count", s.count)
+	s.mux.HandleFunc("POST /_aliases", s.updateAliases)
+	s.mux.HandleFunc("POST /_reindex", s.reindex)
+
+	s.mux.HandleFunc("POST /_bulk", s.bulk)
+	s.mux.HandleFunc("PUT /_bulk", s.bulk)
+	s.mux.HandleFunc("POST /{index}/_bulk", s.bulk)
+	s.mux.HandleFunc("PUT /{index}/_bulk", s.bulk)
+
+	s.mux.HandleFunc("POST /_mget", s.mget)
+	s.mux.HandleFunc("POST /{index}/_mget", s.mget)
+
+	s.mux.HandleFunc("GET /{index}/_doc/{id}", s.getDoc)
+	s.mux.HandleFunc("PUT /{index}/_doc/{id}", s.indexDoc)
+	s.mux.HandleFunc("POST /{index}/_doc/{id}", s.indexDoc)
+	s.mux.HandleFunc("POST /{index}/_doc", s.indexDoc)
+	s.mux.HandleFunc("DELETE /{index}/_doc/{id}", s.deleteDoc)
+
+	s.mux.HandleFunc("GET /_search", s.search)
+	s.mux.HandleFunc("POST /_search", s.search)
+	s.mux.HandleFunc("GET /{index}/_search", s.search)
+	s.mux.HandleFunc("POST /{index}/_search", s.search)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	// The /_tasks/{id} pattern would conflict with the /{index}/... ones.
+	if id, ok := strings.CutPrefix(r.URL.Path, "/_tasks/"); ok && r.Method == http.MethodGet {
+		s.task(w, id)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// Load() indexes the documents from the NDJSON bulk body, e.g. the migration file, to seed the fake.
+func (s *Server) Load(r io.Reader) error {
+	items, errors, err := s.applyBulk("", r)
+	if err != nil {
+		return err
+	}
+	if errors {
+		for _, item := range items {
+			for _, result := range item {
+				if e, ok := result["error"]; ok {
+					return fmt.Errorf("bulk item failed: %v", e)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":         "fakees",
+		"cluster_name": "fakees",
+		"version": map[string]any{
+			"number":       Version,
+			"build_flavor": "default",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+func (s *Server) nodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"nodes": map[string]any{
+			"fakees": map[string]any{
+				"name":  "fakees",
+				"roles": []string{"master", "data"},
+				"http": map[string]any{
+					"publish_address": r.Host,
+				},
+			},
+		},
+	})
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cluster_name": "fakees",
+		"status":       "green",
+	})
+}
+
+func (s *Server) createIndex(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	var body struct {
+		Settings map[string]any `json:"settings"`
+		Aliases  map[string]any `json:"aliases"`
+		Mappings map[string]any `json:"mappings"`
+	}
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.indices[name]; ok {
+		writeError(w, http.StatusBadRequest, "resource_already_exists_exception", fmt.Sprintf("index [%s] already exists", name))
+		return
+	}
+	if _, ok := s.aliases[name]; ok {
+		writeError(w, http.StatusBadRequest, "invalid_index_name_exception", fmt.Sprintf("Invalid index name [%s], already exists as alias", name))
+		return
+	}
+	for alias := range body.Aliases {
+		if _, ok := s.indices[alias]; ok {
+			writeError(w, http.StatusBadRequest, "invalid_alias_name_exception", fmt.Sprintf("Invalid alias name [%s]: an index exists with the same name as the alias", alias))
+			return
+		}
+	}
+
+	ix := newIndex(body.Mappings)
+	ix.settings = indexSettings(name, body.Settings)
+
+	s.indices[name] = ix
+	for alias := range body.Aliases {
+		s.aliases[alias] = name
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"acknowledged":        true,
+		"shards_acknowledged": true,
+		"index":               name,
+	})
+}
+
+func (s *Server) getIndex(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := s.expand(name)
+	if r.Method == http.MethodHead {
+		if len(names) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if len(names) == 0 && !strings.HasSuffix(name, "*") {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	result := map[string]any{}
+
+	for _, n := range names {
+		ix := s.indices[n]
+
+		result[n] = map[string]any{
+			"aliases":  s.aliasesOf(n),
+			"mappings": ix.mappings,
+			"settings": ix.settings,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) deleteIndex(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.aliases[name]; ok {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("The provided expression [%s] matches an alias, specify the corresponding concrete indices instead.", name))
+		return
+	}
+	if _, ok := s.indices[name]; !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	delete(s.indices, name)
+	for alias, index := range s.aliases {
+		if index == name {
+			delete(s.aliases, alias)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true})
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"_shards": map[string]any{"total": 1, "successful": 1, "failed": 0},
+	})
+}
+
+// Adds the fields to the mappings. The type of a mapped field can't be changed, as in Elasticsearch.
+func (s *Server) putMapping(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	var body struct {
+		Properties map[string]map[string]any `json:"properties"`
+	}
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ix, ok := s.lookup(name)
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	for field, p := range body.Properties {
+		t, _ := p["type"].(string)
+		if current, ok := ix.types[field]; ok && current != t {
+			writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("mapper [%s] cannot be changed from type [%s] to [%s]", field, current, t))
+			return
+		}
+	}
+
+	props, _ := ix.mappings["properties"].(map[string]any)
+	if props == nil {
+		props = map[string]any{}
+		ix.mappings["properties"] = props
+	}
+
+	for field, p := range body.Properties {
+		props[field] = p
+		if t, ok := p["type"].(string); ok {
+			ix.types[field] = t
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true})
+}
+
+// Updates the settings of the index. An empty or null value resets the setting to its default.
+func (s *Server) putSettings(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	var body map[string]any
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ix, ok := s.lookup(name)
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	flat := indexdef.FlattenSettings(ix.settings)
+	for k, v := range indexdef.FlattenSettings(body) {
+		if v == "" {
+			delete(flat, k)
+			continue
+		}
+		flat[k] = v
+	}
+	ix.settings = nestSettings(flat)
+
+	writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true})
+}
+
+// Copies the index with its settings, mappings and documents to the target index, without the aliases.
+// The index must be write-blocked, as in Elasticsearch.
+func (s *Server) cloneIndex(w http.ResponseWriter, r *http.Request) {
+	name, target := r.PathValue("index"), r.PathValue("target")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	concrete, src, ok := s.lookup(name)
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+	if !src.writeBlocked() {
+		writeError(w, http.StatusBadRequest, "illegal_state_exception",
+			fmt.Sprintf("index %s must be read-only to resize index. use \"index.blocks.write=true\"", concrete))
+		return
+	}
+	if _, _, ok := s.lookup(target); ok {
+		writeError(w, http.StatusBadRequest, "resource_already_exists_exception", fmt.Sprintf("index [%s] already exists", target))
+		return
+	}
+
+	var mappings map[string]any
+
+	data, err := json.Marshal(src.mappings)
+	if err == nil {
+		err = json.Unmarshal(data, &mappings)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+
+	ix := newIndex(mappings)
+
+	flat := indexdef.FlattenSettings(src.settings)
+	flat["index.provided_name"] = target
+	flat["index.uuid"] = "fake-" + target
+	flat["index.creation_date"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	ix.settings = nestSettings(flat)
+
+	for _, id := range src.order {
+		_, _, err := ix.put(id, src.docs[id].source)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "exception", err.Error())
+			return
+		}
+	}
+
+	s.indices[target] = ix
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"acknowledged":        true,
+		"shards_acknowledged": true,
+		"index":               target,
+	})
+}
+
+func (s *Server) mget(w http.ResponseWriter, r *http.Request) {
+	defaultIndex := r.PathValue("index")
+
+	var body struct {
+		Docs []struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		} `json:"docs"`
+		IDs []string `json:"ids"`
+	}
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	for _, id := range body.IDs {
+		body.Docs = append(body.Docs, struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{ID: id})
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs := make([]map[string]any, 0, len(body.Docs))
+
+	for _, d := range body.Docs {
+		name := d.Index
+		if name == "" {
+			name = defaultIndex
+		}
+
+		concrete, ix, ok := s.lookup(name)
+		if !ok {
+			docs = append(docs, map[string]any{
+				"_index": name,
+				"_id":    d.ID,
+				"error":  map[string]any{"type": "index_not_found_exception", "reason": fmt.Sprintf("no such index [%s]", name)},
+			})
+			continue
+		}
+
+		doc, ok := ix.docs[d.ID]
+		if !ok {
+			docs = append(docs, map[string]any{"_index": concrete, "_id": d.ID, "found": false})
+			continue
+		}
+		docs = append(docs, map[string]any{"_index": concrete, "_id": d.ID, "found": true, "_source": doc.source})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"docs": docs})
+}
+
+func (s *Server) bulk(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	items, errors, err := s.applyBulk(r.PathValue("index"), r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"took":   time.Since(start).Milliseconds(),
+		"errors": errors,
+		"items":  items,
+	})
+}
+
+// Applies the NDJSON bulk body, returning the bulk response items and whether any of them failed.
+func (s *Server) applyBulk(defaultIndex string, body io.Reader) ([]map[string]map[string]any, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		items  []map[string]map[string]any
+		errors bool
+	)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    any    `json:"_id"`
+		}
+
+		err := json.Unmarshal(line, &action)
+		if err != nil || len(action) != 1 {
+			return nil, false, fmt.Errorf("malformed action/metadata line [%s]", line)
+		}
+
+		for op, meta := range action {
+			name := meta.Index
+			if name == "" {
+				name = defaultIndex
+			}
+			id := ""
+			if meta.ID != nil {
+				id = fmt.Sprint(meta.ID)
+			}
+
+			var source []byte
+
+			if op != "delete" {
+				if !scanner.Scan() {
+					return nil, false, fmt.Errorf("the bulk request must be terminated by a newline")
+				}
+				source = bytes.Clone(scanner.Bytes())
+			}
+
+			result, status, err := s.applyAction(op, name, id, source)
+			if err != nil && status == 0 {
+				return nil, false, err
+			}
+
+			item := map[string]any{"_index": name, "_id": result, "status": status}
+			if err != nil {
+				errors = true
+				item["error"] = map[string]any{"type": "document_missing_exception", "reason": err.Error()}
+			} else {
+				item["result"] = resultName(op, status)
+			}
+
+			items = append(items, map[string]map[string]any{op: item})
+		}
+	}
+
+	return items, errors, scanner.Err()
+}
+
+// Applies a single bulk action, returning the document ID and the status.
+//
+// A zero status with an error means the request is malformed and must be rejected as a whole.
+// Must be called with the mutex held.
+func (s *Server) applyAction(op string, name string, id string, source []byte) (string, int, error) {
+	if name == "" {
+		return "", 0, fmt.Errorf("index is missing")
+	}
+
+	_, ix, ok := s.lookup(name)
+	if !ok {
+		if op == "delete" || op == "update" {
+			return id, http.StatusNotFound, fmt.Errorf("no such index [%s]", name)
+		}
+
+		ix = newIndex(nil)
+		s.indices[name] = ix
+	}
+	if ix.writeBlocked() {
+		return id, http.StatusForbidden, fmt.Errorf("index [%s] blocked by: [FORBIDDEN/8/index write (api)]", name)
+	}
+
+	switch op {
+	case "index", "create":
+		if op == "create" && id != "" && ix.docs[id] != nil {
+			return id, http.StatusConflict, fmt.Errorf("[%s]: version conflict, document already exists", id)
+		}
+
+		id, created, err := ix.put(id, source)
+		if err != nil {
+			return "", 0, err
+		}
+		if created {
+			return id, http.StatusCreated, nil
+		}
+		return id, http.StatusOK, nil
+
+	case "delete":
+		if !ix.remove(id) {
+			return id, http.StatusNotFound, nil
+		}
+		return id, http.StatusOK, nil
+
+	case "update":
+		var update struct {
+			Doc map[string]any `json:"doc"`
+		}
+
+		err := json.Unmarshal(source, &update)
+		if err != nil {
+			return "", 0, err
+		}
+
+		d, ok := ix.docs[id]
+		if !ok {
+			return id, http.StatusNotFound, fmt.Errorf("[%s]: document missing", id)
+		}
+
+		for k, v := range update.Doc {
+			d.fields[k] = v
+		}
+
+		merged, err := json.Marshal(d.fields)
+		if err != nil {
+			return "", 0, err
+		}
+
+		_, _, err = ix.put(id, merged)
+		if err != nil {
+			return "", 0, err
+		}
+		return id, http.StatusOK, nil
+
+	default:
+		return "", 0, fmt.Errorf("malformed action/metadata line, expected one of [create, delete, index, update] but found [%s]", op)
+	}
+}
+
+func (s *Server) getDoc(w http.ResponseWriter, r *http.Request) {
+	name, id := r.PathValue("index"), r.PathValue("id")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, ix, ok := s.lookup(name)
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	d, ok := ix.docs[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"_index": name, "_id": id, "found": false})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"_index": name, "_id": id, "found": true, "_source": d.source})
+}
+
+func (s *Server) indexDoc(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("index")
+
+	source, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, status, err := s.applyAction("index", name, r.PathValue("id"), source)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		return
+	}
+
+	writeJSON(w, status, map[string]any{"_index": name, "_id": id, "result": resultName("index", status)})
+}
+
+func (s *Server) deleteDoc(w http.ResponseWriter, r *http.Request) {
+	name, id := r.PathValue("index"), r.PathValue("id")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, ix, ok := s.lookup(name)
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+
+	if !ix.remove(id) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"_index": name, "_id": id, "result": "not_found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"_index": name, "_id": id, "result": "deleted"})
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var body struct {
+		Query map[string]any `json:"query"`
+		Size  *int           `json:"size"`
+		From  int            `json:"from"`
+	}
+
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+		return
+	}
+
+	size := 10
+	if body.Size != nil {
+		size = *body.Size
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+		size = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("from")); err == nil {
+		body.From = v
+	}
+	if body.Query == nil {
+		body.Query = map[string]any{"match_all": map[string]any{}}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+
+	if name := r.PathValue("index"); name != "" {
+		concrete, _, ok := s.lookup(name)
+		if !ok {
+			writeIndexNotFound(w, name)
+			return
+		}
+		names = []string{concrete}
+	} else {
+		for name := range s.indices {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	type hit struct {
+		index string
+		id    string
+		score float64
+		doc   *document
+	}
+
+	var hits []hit
+
+	for _, name := range names {
+		ix := s.indices[name]
+
+		for _, id := range ix.order {
+			d := ix.docs[id]
+
+			matched, score, err := evaluate(body.Query, d.fields, ix.types)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+				return
+			}
+			if matched {
+				hits = append(hits, hit{index: name, id: id, score: score, doc: d})
+			}
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].score > hits[j].score
+	})
+
+	var maxScore any
+	if len(hits) > 0 {
+		maxScore = hits[0].score
+	}
+
+	page := []map[string]any{}
+
+	for i := body.From; i < len(hits) && i < body.From+size; i++ {
+		page = append(page, map[string]any{
+			"_index":  hits[i].index,
+			"_id":     hits[i].id,
+			"_score":  hits[i].score,
+			"_source": hits[i].doc.source,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"took":      time.Since(start).Milliseconds(),
+		"timed_out": false,
+		"_shards":   map[string]any{"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": map[string]any{
+			"total":     map[string]any{"value": len(hits), "relation": "eq"},
+			"max_score": maxScore,
+			"hits":      page,
+		},
+	})
+}
+
+// Creates an empty index with the mappings, remembering the type of every mapped field.
+func newIndex(mappings map[string]any) *index {
+	if mappings == nil {
+		mappings = map[string]any{}
+	}
+
+	ix := &index{
+		settings: indexSettings("", nil),
+		mappings: mappings,
+		types:    make(map[string]string),
+		docs:     make(map[string]*document),
+	}
+
+	if props, ok := mappings["properties"].(map[string]any); ok {
+		for field, p := range props {
+			if t, ok := p.(map[string]any)["type"].(string); ok {
+				ix.types[field] = t
+			}
+		}
+	}
+
+	return ix
+}
+
+// Returns the settings of a new index the way Elasticsearch returns them: nested under "index", with string values,
+// the defaults and the ones set by Elasticsearch included.
+func indexSettings(name string, settings map[string]any) map[string]any {
+	flat := map[string]string{
+		"index.number_of_shards":   "1",
+		"index.number_of_replicas": "1",
+		"index.provided_name":      name,
+		"index.creation_date":      strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"index.uuid":               "fake-" + name,
+		"index.version.created":    "8521000",
+	}
+	for k, v := range indexdef.FlattenSettings(settings) {
+		flat[k] = v
+	}
+
+	return nestSettings(flat)
+}
+
+// Nests the index.* settings under "index", as Elasticsearch returns them.
+func nestSettings(flat map[string]string) map[string]any {
+	nested := map[string]any{}
+
+	for key, v := range flat {
+		m := nested
+		parts := strings.Split(key, ".")
+
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := m[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				m[part] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = v
+	}
+
+	return nested
+}
+
+// Reports whether the writes to the index are blocked by the index.blocks.write setting.
+func (ix *index) writeBlocked() bool {
+	return indexdef.FlattenSettings(ix.settings)["index.blocks.write"] == "true"
+}
+
+// Stores the document, generating an ID if it is empty. It reports whether the document was created.
+func (ix *index) put(id string, source []byte) (string, bool, error) {
+	var fields map[string]any
+
+	err := json.Unmarshal(source, &fields)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to parse the document: %v", err)
+	}
+
+	if id == "" {
+		ix.seq++
+		id = "fake-" + strconv.Itoa(ix.seq)
+	}
+
+	_, exists := ix.docs[id]
+	if !exists {
+		ix.order = append(ix.order, id)
+	}
+
+	ix.docs[id] = &document{source: json.RawMessage(bytes.Clone(source)), fields: fields}
+
+	return id, !exists, nil
+}
+
+// Removes the document, reporting whether it existed.
+func (ix *index) remove(id string) bool {
+	if _, ok := ix.docs[id]; !ok {
+		return false
+	}
+
+	delete(ix.docs, id)
+
+	for i, v := range ix.order {
+		if v == id {
+			ix.order = append(ix.order[:i], ix.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Returns the "result" of a bulk item.
+func resultName(op string, status int) string {
+	switch {
+	case op == "delete" && status == http.StatusOK:
+		return "deleted"
+	case op == "delete":
+		return "not_found"
+	case status == http.StatusCreated:
+		return "created"
+	default:
+		return "updated"
+	}
+}
+
+// Decodes the JSON body, if any.
+func decodeBody(r *http.Request, v any) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, typ string, reason string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"root_cause": []map[string]any{{"type": typ, "reason": reason}},
+			"type":       typ,
+			"reason":     reason,
+		},
+		"status": status,
+	})
+}
+
+func writeIndexNotFound(w http.ResponseWriter, name string) {
+	writeError(w, http.StatusNotFound, "index_not_found_exception", fmt.Sprintf("no such index [%s]", name))
+}
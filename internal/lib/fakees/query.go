@@ -0,0 +1,337 @@
+package fakees
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/analyzer"
+)
+
+// Evaluates the query against the document fields, returning whether it matches and its score.
+//
+// The fields mapped as "text", and the string fields of the unmapped ones, are analyzed and score the number
+// of the distinct matched query terms. The other fields match by equality.
+func evaluate(q map[string]any, fields map[string]any, types map[string]string) (bool, float64, error) {
+	if len(q) != 1 {
+		return false, 0, fmt.Errorf("query malformed, expected a single query, found %d", len(q))
+	}
+
+	for name, body := range q {
+		switch name {
+		case "match_all":
+			return true, 1, nil
+
+		case "bool":
+			return evaluateBool(body, fields, types)
+
+		case "multi_match":
+			return evaluateMultiMatch(body, fields, types)
+
+		case "match":
+			field, value, err := fieldValue(name, body, "query")
+			if err != nil {
+				return false, 0, err
+			}
+			score := scoreField(field, value, fields, types)
+			return score > 0, score, nil
+
+		case "term":
+			field, value, err := fieldValue(name, body, "value")
+			if err != nil {
+				return false, 0, err
+			}
+			ok := equal(fields[field], value)
+			return ok, boolScore(ok), nil
+
+		case "terms":
+			field, value, err := fieldValue(name, body, "")
+			if err != nil {
+				return false, 0, err
+			}
+			values, ok := value.([]any)
+			if !ok {
+				return false, 0, fmt.Errorf("[terms] query requires an array of values for [%s]", field)
+			}
+			ok = slices.ContainsFunc(values, func(v any) bool { return equal(fields[field], v) })
+			return ok, boolScore(ok), nil
+
+		case "range":
+			return evaluateRange(body, fields)
+
+		default:
+			return false, 0, fmt.Errorf("unknown query [%s]", name)
+		}
+	}
+	return false, 0, nil
+}
+
+func evaluateBool(body any, fields map[string]any, types map[string]string) (bool, float64, error) {
+	clauses, ok := body.(map[string]any)
+	if !ok {
+		return false, 0, fmt.Errorf("[bool] query malformed")
+	}
+
+	var (
+		score     float64
+		scoring   bool
+		shoulds   int
+		shouldHit int
+	)
+
+	for occur, v := range clauses {
+		var queries []any
+
+		switch v := v.(type) {
+		case []any:
+			queries = v
+		case map[string]any:
+			queries = []any{v}
+		default:
+			if occur == "minimum_should_match" || occur == "boost" {
+				continue
+			}
+			return false, 0, fmt.Errorf("[bool] malformed clause [%s]", occur)
+		}
+
+		for _, sub := range queries {
+			q, ok := sub.(map[string]any)
+			if !ok {
+				return false, 0, fmt.Errorf("[bool] malformed clause [%s]", occur)
+			}
+
+			matched, s, err := evaluate(q, fields, types)
+			if err != nil {
+				return false, 0, err
+			}
+
+			switch occur {
+			case "must":
+				if !matched {
+					return false, 0, nil
+				}
+				score += s
+				scoring = true
+			case "filter":
+				if !matched {
+					return false, 0, nil
+				}
+				scoring = true
+			case "must_not":
+				if matched {
+					return false, 0, nil
+				}
+			case "should":
+				shoulds++
+				if matched {
+					shouldHit++
+					score += s
+				}
+			default:
+				return false, 0, fmt.Errorf("[bool] query does not support [%s]", occur)
+			}
+		}
+	}
+
+	// Without the must and filter clauses at least one should clause has to match.
+	if !scoring && shoulds > 0 && shouldHit == 0 {
+		return false, 0, nil
+	}
+	if score == 0 {
+		score = 1
+	}
+	return true, score, nil
+}
+
+// The "best_fields" multi_match: the best field score times its boost.
+func evaluateMultiMatch(body any, fields map[string]any, types map[string]string) (bool, float64, error) {
+	params, ok := body.(map[string]any)
+	if !ok {
+		return false, 0, fmt.Errorf("[multi_match] query malformed")
+	}
+
+	query, ok := params["query"]
+	if !ok {
+		return false, 0, fmt.Errorf("[multi_match] requires query value")
+	}
+
+	var names []any
+
+	if v, ok := params["fields"].([]any); ok {
+		names = v
+	} else {
+		for field := range fields {
+			names = append(names, field)
+		}
+	}
+
+	var best float64
+
+	for _, n := range names {
+		spec, ok := n.(string)
+		if !ok {
+			return false, 0, fmt.Errorf("[multi_match] malformed fields")
+		}
+
+		field, boost := spec, 1.0
+
+		if i := strings.IndexByte(spec, '^'); i >= 0 {
+			b, err := strconv.ParseFloat(spec[i+1:], 64)
+			if err != nil {
+				return false, 0, fmt.Errorf("[multi_match] malformed boost of [%s]", spec)
+			}
+			field, boost = spec[:i], b
+		}
+
+		best = max(best, scoreField(field, query, fields, types)*boost)
+	}
+
+	return best > 0, best, nil
+}
+
+func evaluateRange(body any, fields map[string]any) (bool, float64, error) {
+	field, value, err := fieldValue("range", body, "")
+	if err != nil {
+		return false, 0, err
+	}
+
+	bounds, ok := value.(map[string]any)
+	if !ok {
+		return false, 0, fmt.Errorf("[range] query malformed for [%s]", field)
+	}
+
+	v, ok := fields[field]
+	if !ok {
+		return false, 0, nil
+	}
+
+	for bound, limit := range bounds {
+		c, ok := compare(v, limit)
+		if !ok {
+			return false, 0, nil
+		}
+
+		switch bound {
+		case "gte":
+			ok = c >= 0
+		case "gt":
+			ok = c > 0
+		case "lte":
+			ok = c <= 0
+		case "lt":
+			ok = c < 0
+		default:
+			return false, 0, fmt.Errorf("[range] query does not support [%s]", bound)
+		}
+		if !ok {
+			return false, 0, nil
+		}
+	}
+	return true, 1, nil
+}
+
+// Returns the field and the value of the queries like {"term": {"field": value}} or {"term": {"field": {"value": value}}}.
+func fieldValue(name string, body any, key string) (string, any, error) {
+	params, ok := body.(map[string]any)
+	if !ok || len(params) != 1 {
+		return "", nil, fmt.Errorf("[%s] query malformed, expected a single field", name)
+	}
+
+	for field, v := range params {
+		if m, ok := v.(map[string]any); ok && key != "" {
+			value, ok := m[key]
+			if !ok {
+				return "", nil, fmt.Errorf("[%s] query malformed, no [%s] for [%s]", name, key, field)
+			}
+			return field, value, nil
+		}
+		return field, v, nil
+	}
+	return "", nil, nil
+}
+
+// Scores the match of the query against the field: the number of the distinct query terms found in the text fields,
+// and 1 if the other fields equal the query.
+func scoreField(field string, query any, fields map[string]any, types map[string]string) float64 {
+	v, ok := fields[field]
+	if !ok {
+		return 0
+	}
+
+	text, isString := v.(string)
+	t, mapped := types[field]
+
+	if isString && (t == "text" || !mapped) {
+		q, ok := query.(string)
+		if !ok {
+			q = fmt.Sprint(query)
+		}
+
+		terms := analyzer.Terms(text)
+		score := 0.0
+
+		for i, term := range analyzer.Terms(q) {
+			if !slices.Contains(analyzer.Terms(q)[:i], term) && slices.Contains(terms, term) {
+				score++
+			}
+		}
+		return score
+	}
+
+	return boolScore(equal(v, query))
+}
+
+// Reports whether the values are equal, comparing the numbers and the numeric strings by value.
+func equal(a any, b any) bool {
+	c, ok := compare(a, b)
+	return ok && c == 0
+}
+
+// Compares the values as numbers if both are numeric, and as strings otherwise.
+func compare(a any, b any) (int, bool) {
+	fa, okA := number(a)
+	fb, okB := number(b)
+
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if !okA || !okB {
+		if ba, ok := a.(bool); ok {
+			if bb, ok := b.(bool); ok && ba == bb {
+				return 0, true
+			}
+		}
+		return 0, false
+	}
+	return strings.Compare(sa, sb), true
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func boolScore(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
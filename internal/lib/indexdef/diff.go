@@ -0,0 +1,392 @@
+package indexdef
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeKind is the kind of a difference between the live index and its definition.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "+"
+	Removed ChangeKind = "-"
+	Changed ChangeKind = "~"
+)
+
+// Parameters of a field that can be changed on an existing index, the others are fixed when the field is mapped.
+var updatableParams = map[string]bool{
+	"ignore_above":          true,
+	"search_analyzer":       true,
+	"search_quote_analyzer": true,
+	"meta":                  true,
+}
+
+// Parameters of the mappings, besides the fields, that can't be changed on an existing index.
+var staticMappings = map[string]bool{
+	"_source":  true,
+	"_routing": true,
+}
+
+// Settings that are fixed when the index is created, as index.* keys. A key ending with a dot is a prefix.
+var staticSettings = []string{
+	"index.number_of_shards",
+	"index.number_of_routing_shards",
+	"index.routing_partition_size",
+	"index.codec",
+	"index.sort.",
+	"index.analysis.",
+}
+
+// Change struct represents a difference between the live index and its definition: a field, a setting or an alias
+// added, removed or changed by the definition. Reindex is set if the change can't be applied to the live index,
+// with the Reason.
+type Change struct {
+	Section string
+	Name    string
+	Kind    ChangeKind
+	Live    string
+	Desired string
+	Reindex bool
+	Reason  string
+}
+
+// String() returns the change as a line of a diff, e.g. "~ mappings price: {"type":"float"} -> {"type":"double"}".
+func (c Change) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %s %s", c.Kind, c.Section, c.Name)
+
+	switch c.Kind {
+	case Added:
+		fmt.Fprintf(&b, ": %s", c.Desired)
+	case Removed:
+		fmt.Fprintf(&b, ": %s", c.Live)
+	default:
+		fmt.Fprintf(&b, ": %s -> %s", orDefault(c.Live), c.Desired)
+	}
+	if c.Reindex {
+		fmt.Fprintf(&b, " (requires a reindex: %s)", c.Reason)
+	}
+
+	return b.String()
+}
+
+// Diff() compares the live index, as returned by the get index API, with its definition.
+//
+// The fields are compared with their parameters, the multi-fields and the fields of the objects included.
+// A field removed from the definition, or with another type or a fixed parameter changed, requires a reindex.
+// Only the settings of the definition are compared, as the live index has many more, and the static ones
+// (e.g. the number of shards or the analysis) require a reindex. The aliases are compared by their names
+// and their bodies. The changes are ordered by section and name.
+func Diff(live Definition, desired Definition) ([]Change, error) {
+	var changes []Change
+
+	mappings, err := diffMappings(live.Mappings, desired.Mappings)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, mappings...)
+
+	settings, err := diffSettings(live.Settings, desired.Settings)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, settings...)
+
+	aliases, err := diffAliases(live.Aliases, desired.Aliases)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, aliases...)
+
+	return changes, nil
+}
+
+// Compares the fields and the other parameters of the mappings.
+func diffMappings(live json.RawMessage, desired json.RawMessage) ([]Change, error) {
+	liveMap, err := decodeObject(live)
+	if err != nil {
+		return nil, err
+	}
+	desiredMap, err := decodeObject(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	liveFields, desiredFields := map[string]map[string]any{}, map[string]map[string]any{}
+	flattenFields("", liveMap["properties"], liveFields)
+	flattenFields("", desiredMap["properties"], desiredFields)
+
+	var changes []Change
+
+	for _, name := range unionKeys(liveFields, desiredFields) {
+		l, inLive := liveFields[name]
+		d, inDesired := desiredFields[name]
+
+		c := Change{Section: "mappings", Name: name, Live: canonical(l), Desired: canonical(d)}
+
+		switch {
+		case !inLive:
+			c.Kind = Added
+		case !inDesired:
+			c.Kind, c.Reindex, c.Reason = Removed, true, "a field can't be removed from an index"
+		case c.Live == c.Desired:
+			continue
+		case fieldType(l) != fieldType(d):
+			c.Kind, c.Reindex, c.Reason = Changed, true, fmt.Sprintf("the type can't be changed from %s to %s", fieldType(l), fieldType(d))
+		default:
+			c.Kind = Changed
+			for _, param := range unionKeys(l, d) {
+				if !updatableParams[param] && canonical(l[param]) != canonical(d[param]) {
+					c.Reindex, c.Reason = true, fmt.Sprintf("the %s parameter can't be changed", param)
+					break
+				}
+			}
+		}
+
+		changes = append(changes, c)
+	}
+
+	delete(liveMap, "properties")
+	delete(desiredMap, "properties")
+
+	for _, name := range unionKeys(liveMap, desiredMap) {
+		_, inDesired := desiredMap[name]
+
+		// The live mappings hold the defaults too, only the parameters of the definition are compared.
+		if !inDesired {
+			continue
+		}
+
+		c := Change{Section: "mappings", Name: name, Kind: Changed, Live: canonical(liveMap[name]), Desired: canonical(desiredMap[name])}
+		if c.Live == c.Desired {
+			continue
+		}
+		if staticMappings[name] {
+			c.Reindex, c.Reason = true, fmt.Sprintf("%s can't be changed on an existing index", name)
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// Compares the settings of the definition with the live ones.
+func diffSettings(live json.RawMessage, desired json.RawMessage) ([]Change, error) {
+	liveMap, err := decodeObject(live)
+	if err != nil {
+		return nil, err
+	}
+	desiredMap, err := decodeObject(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	liveSettings, desiredSettings := FlattenSettings(liveMap), FlattenSettings(desiredMap)
+
+	var changes []Change
+
+	for _, name := range unionKeys(desiredSettings, nil) {
+		l, inLive := liveSettings[name]
+		d := desiredSettings[name]
+
+		if l == d {
+			continue
+		}
+
+		c := Change{Section: "settings", Name: name, Kind: Changed, Live: l, Desired: d}
+		if !inLive {
+			c.Live = ""
+		}
+		if staticSetting(name) {
+			c.Reindex, c.Reason = true, "static setting"
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// Compares the aliases by their names and bodies.
+func diffAliases(live json.RawMessage, desired json.RawMessage) ([]Change, error) {
+	liveMap, err := decodeObject(live)
+	if err != nil {
+		return nil, err
+	}
+	desiredMap, err := decodeObject(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+
+	for _, name := range unionKeys(liveMap, desiredMap) {
+		l, inLive := liveMap[name]
+		d, inDesired := desiredMap[name]
+
+		c := Change{Section: "aliases", Name: name, Live: canonical(l), Desired: canonical(d)}
+
+		switch {
+		case !inLive:
+			c.Kind = Added
+		case !inDesired:
+			c.Kind = Removed
+		case c.Live == c.Desired:
+			continue
+		default:
+			c.Kind = Changed
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// FlattenSettings() returns the settings as index.* keys with string values, the way Elasticsearch returns them.
+//
+// Both the nested ({"index": {"number_of_shards": 1}}) and the dotted ({"index.number_of_shards": "1"})
+// forms are accepted, with or without the "index." prefix.
+func FlattenSettings(settings map[string]any) map[string]string {
+	flat := map[string]string{}
+
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		if m, ok := v.(map[string]any); ok {
+			for k, child := range m {
+				walk(prefix+k+".", child)
+			}
+			return
+		}
+
+		key := strings.TrimSuffix(prefix, ".")
+		if !strings.HasPrefix(key, "index.") {
+			key = "index." + key
+		}
+
+		switch v := v.(type) {
+		case string:
+			flat[key] = v
+		default:
+			flat[key] = canonical(v)
+		}
+	}
+
+	for k, v := range settings {
+		walk(k+".", v)
+	}
+
+	return flat
+}
+
+// Collects the parameters of every field, by its dotted path. The objects and the multi-fields are walked,
+// without their properties and fields parameters.
+func flattenFields(prefix string, properties any, fields map[string]map[string]any) {
+	props, ok := properties.(map[string]any)
+	if !ok {
+		return
+	}
+
+	for name, p := range props {
+		params, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		path := prefix + name
+		own := map[string]any{}
+
+		for k, v := range params {
+			if k != "properties" && k != "fields" {
+				own[k] = v
+			}
+		}
+		fields[path] = own
+
+		flattenFields(path+".", params["properties"], fields)
+		flattenFields(path+".", params["fields"], fields)
+	}
+}
+
+// Returns the type of a field, "object" for the objects, which have no type.
+func fieldType(params map[string]any) string {
+	if t, ok := params["type"].(string); ok {
+		return t
+	}
+	return "object"
+}
+
+// Reports whether the setting is fixed when the index is created.
+func staticSetting(name string) bool {
+	for _, s := range staticSettings {
+		if name == s || (strings.HasSuffix(s, ".") && strings.HasPrefix(name, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes a JSON object, an empty one if the data is empty.
+func decodeObject(data json.RawMessage) (map[string]any, error) {
+	m := map[string]any{}
+	if len(data) == 0 {
+		return m, nil
+	}
+
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadDefinition, err)
+	}
+	if m == nil {
+		m = map[string]any{}
+	}
+	return m, nil
+}
+
+// Returns the value as JSON with sorted keys, so equal values have the same representation.
+func canonical(v any) string {
+	if v == nil {
+		return ""
+	}
+	if m, ok := v.(map[string]any); ok && m == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// Returns the keys of both maps, sorted.
+func unionKeys[V any](a map[string]V, b map[string]V) []string {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Shows an unset live value.
+func orDefault(v string) string {
+	if v == "" {
+		return "(default)"
+	}
+	return v
+}
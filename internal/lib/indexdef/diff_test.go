@@ -0,0 +1,62 @@
+package indexdef
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	live := Definition{
+		Name:     "products",
+		Settings: json.RawMessage(`{"index": {"number_of_shards": "1", "number_of_replicas": "1", "uuid": "x"}}`),
+		Aliases:  json.RawMessage(`{"old": {}}`),
+		Mappings: json.RawMessage(`{"dynamic": "strict", "properties": {
+			"name": {"type": "text", "fields": {"raw": {"type": "keyword", "ignore_above": 256}}},
+			"price": {"type": "float"},
+			"stock": {"type": "integer"},
+			"tags": {"type": "keyword"}
+		}}`),
+	}
+	desired := Definition{
+		Name:     "products",
+		Settings: json.RawMessage(`{"number_of_shards": 2, "index.number_of_replicas": 0}`),
+		Aliases:  json.RawMessage(`{"products_read": {}}`),
+		Mappings: json.RawMessage(`{"dynamic": "strict", "properties": {
+			"name": {"type": "text", "fields": {"raw": {"type": "keyword", "ignore_above": 512}}},
+			"price": {"type": "double"},
+			"stock": {"type": "integer", "index": false},
+			"brand": {"type": "keyword"}
+		}}`),
+	}
+
+	changes, err := Diff(live, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`+ mappings brand: {"type":"keyword"}`,
+		`~ mappings name.raw: {"ignore_above":256,"type":"keyword"} -> {"ignore_above":512,"type":"keyword"}`,
+		`~ mappings price: {"type":"float"} -> {"type":"double"} (requires a reindex: the type can't be changed from float to double)`,
+		`~ mappings stock: {"type":"integer"} -> {"index":false,"type":"integer"} (requires a reindex: the index parameter can't be changed)`,
+		`- mappings tags: {"type":"keyword"} (requires a reindex: a field can't be removed from an index)`,
+		`~ settings index.number_of_replicas: 1 -> 0`,
+		`~ settings index.number_of_shards: 1 -> 2 (requires a reindex: static setting)`,
+		`- aliases old: {}`,
+		`+ aliases products_read: {}`,
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("Diff() = %d changes %v, want %d", len(changes), changes, len(want))
+	}
+	for i, c := range changes {
+		if c.String() != want[i] {
+			t.Errorf("change %d = %s\nwant %s", i, c, want[i])
+		}
+	}
+
+	changes, err = Diff(live, live)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Diff() of the same index = %v, %v, want no changes", changes, err)
+	}
+}
@@ -0,0 +1,135 @@
+package indexdef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrNoName        = fmt.Errorf("index definition must have a name")
+	ErrBadExtension  = fmt.Errorf("index definition must be a .json, .yaml or .yml file")
+	ErrBadDefinition = fmt.Errorf("malformed index definition")
+)
+
+// Definition struct represents an index as defined in its file: the name, the aliases, the settings
+// (e.g. the analyzers) and the mappings.
+//
+// The same file is read by the esmigrator, which creates the index and puts its mappings, and by the
+// Elasticsearch and OpenSearch services, which search it, so both always agree on the index.
+//
+// The name is an alias of the live index, one of the versions of the index named <name>_v<version>.
+// A reindex copies the documents to the next version and moves the alias to it, without downtime.
+type Definition struct {
+	Name     string          `json:"name"`
+	Aliases  json.RawMessage `json:"aliases,omitempty"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+	Mappings json.RawMessage `json:"mappings,omitempty"`
+}
+
+// Load() reads the definition of an index from a JSON or YAML file.
+//
+// The unknown keys are rejected, so a misspelled section is found before the index is created.
+func Load(path string) (Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	switch filepath.Ext(path) {
+	case ".json":
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return Definition{}, fmt.Errorf("%s: %w: %v", path, ErrBadDefinition, err)
+		}
+	default:
+		return Definition{}, fmt.Errorf("%s: %w", path, ErrBadExtension)
+	}
+
+	var d Definition
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&d)
+	if err != nil {
+		return Definition{}, fmt.Errorf("%s: %w: %v", path, ErrBadDefinition, err)
+	}
+	if d.Name == "" {
+		return Definition{}, fmt.Errorf("%s: %w", path, ErrNoName)
+	}
+
+	return d, nil
+}
+
+// Body() returns the body of the create index request: the aliases, the settings and the mappings.
+func (d Definition) Body() ([]byte, error) {
+	body := map[string]json.RawMessage{}
+
+	for key, section := range map[string]json.RawMessage{"aliases": d.Aliases, "settings": d.Settings, "mappings": d.Mappings} {
+		if len(section) > 0 {
+			body[key] = section
+		}
+	}
+
+	return json.Marshal(body)
+}
+
+// Index() returns the name of a version of the index, e.g. "products_v2". Version 0 is the backup of the index
+// created before the indices were versioned, made by the first reindex.
+func (d Definition) Index(version int) string {
+	return fmt.Sprintf("%s_v%d", d.Name, version)
+}
+
+// Version() returns the version of an index of the definition, or false if the index isn't one of its versions.
+func (d Definition) Version(index string) (int, bool) {
+	v, ok := strings.CutPrefix(index, d.Name+"_v")
+	if !ok {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// Aliased() returns the definition of a version of the index, with the name of the definition among its aliases.
+func (d Definition) Aliased() (Definition, error) {
+	aliases := map[string]json.RawMessage{}
+
+	if len(d.Aliases) > 0 {
+		err := json.Unmarshal(d.Aliases, &aliases)
+		if err != nil {
+			return Definition{}, fmt.Errorf("%w: %v", ErrBadDefinition, err)
+		}
+	}
+	aliases[d.Name] = json.RawMessage(`{}`)
+
+	data, err := json.Marshal(aliases)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	d.Aliases = data
+	return d, nil
+}
+
+// Converts a YAML document to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v any
+
+	err := yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
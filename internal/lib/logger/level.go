@@ -0,0 +1,204 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the runtime-adjustable level of the logger.
+//
+// It holds the base level from the config and an optional temporary override. The override lowers (or raises)
+// the level either for all records or only for the records whose op starts with a prefix (e.g. "service.ElasticSearch."),
+// and it is reverted automatically once its TTL is over.
+type Level struct {
+	base     slog.LevelVar
+	override atomic.Pointer[levelOverride]
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+type levelOverride struct {
+	level     slog.Level
+	opPrefix  string
+	expiresAt time.Time
+}
+
+// LevelState describes the current state of the Level.
+type LevelState struct {
+	Base      string
+	Override  string
+	OpPrefix  string
+	ExpiresAt *time.Time
+}
+
+// Creates a new Level with the base level.
+func newLevel(base slog.Level) *Level {
+	l := &Level{}
+	l.base.Set(base)
+
+	return l
+}
+
+// Level() returns the lowest level any record can currently be logged at.
+//
+// It implements slog.Leveler, so the wrapped handlers let through everything the override may need.
+func (l *Level) Level() slog.Level {
+	base := l.base.Level()
+
+	o := l.active()
+	if o != nil && o.level < base {
+		return o.level
+	}
+	return base
+}
+
+// SetBase() changes the base level.
+func (l *Level) SetBase(level slog.Level) {
+	l.base.Set(level)
+}
+
+// Set() overrides the level for ttl.
+//
+// When opPrefix is not empty, only the records whose op starts with it are affected. A new override replaces the previous one.
+func (l *Level) Set(level slog.Level, opPrefix string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+
+	o := &levelOverride{
+		level:     level,
+		opPrefix:  opPrefix,
+		expiresAt: time.Now().Add(ttl),
+	}
+
+	l.override.Store(o)
+
+	// The override is compared, so a timer that fires late can't revert a newer override.
+	l.timer = time.AfterFunc(ttl, func() {
+		l.override.CompareAndSwap(o, nil)
+	})
+}
+
+// Reset() removes the override, reverting to the base level.
+func (l *Level) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	l.override.Store(nil)
+}
+
+// Overridden() reports whether an override is currently active.
+func (l *Level) Overridden() bool {
+	return l.active() != nil
+}
+
+// State() returns the current state of the Level.
+func (l *Level) State() LevelState {
+	state := LevelState{Base: l.base.Level().String()}
+
+	o := l.active()
+	if o != nil {
+		expiresAt := o.expiresAt
+
+		state.Override = o.level.String()
+		state.OpPrefix = o.opPrefix
+		state.ExpiresAt = &expiresAt
+	}
+
+	return state
+}
+
+// Returns the override if it is set and not expired yet.
+func (l *Level) active() *levelOverride {
+	o := l.override.Load()
+	if o == nil || time.Now().After(o.expiresAt) {
+		return nil
+	}
+	return o
+}
+
+// Reports whether a record at the level and with the op must be logged.
+func (l *Level) allow(level slog.Level, op string) bool {
+	if level >= l.base.Level() {
+		return true
+	}
+
+	o := l.active()
+	if o == nil || level < o.level {
+		return false
+	}
+	return o.opPrefix == "" || strings.HasPrefix(op, o.opPrefix)
+}
+
+// ParseLevel() parses a level name such as "debug" or "WARN".
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(strings.ToUpper(name)))
+	return level, err
+}
+
+// levelHandler is a slog.Handler that applies the Level, including the op-scoped override, to the records.
+type levelHandler struct {
+	next  slog.Handler
+	level *Level
+	op    string
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.next.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	op := h.op
+
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "op" {
+			op = a.Value.String()
+			return false
+		}
+		return true
+	})
+
+	if !h.level.allow(r.Level, op) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	op := h.op
+
+	for _, a := range attrs {
+		if a.Key == "op" {
+			op = a.Value.String()
+		}
+	}
+
+	return &levelHandler{
+		next:  h.next.WithAttrs(attrs),
+		level: h.level,
+		op:    op,
+	}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{
+		next:  h.next.WithGroup(name),
+		level: h.level,
+		op:    h.op,
+	}
+}
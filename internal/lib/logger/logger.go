@@ -1,26 +1,92 @@
 package logger
 
 import (
+	"context"
 	"log/slog"
 	"os"
+
+	"github.com/mattn/go-isatty"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
 )
 
 // Creates a new Logger.
 //
-// Environment must be specified with env variable.
-func New(envs map[string]string) *slog.Logger {
-	var log *slog.Logger
+// The environment is taken from the config. In "production" the records are written as JSON,
+// in "development" as colored human-friendly text, and as plain text otherwise. In every environment
+// the secrets of the config are redacted and the repetitive error logs are sampled as configured.
+//
+// The returned Level controls the level of the logger at runtime, and the Redactor the secrets it redacts.
+func New(cfg utils.Config) (*slog.Logger, *Level, *Redactor) {
+	var handler slog.Handler
 
-	switch envs["env"] {
+	r := newRedactor(cfg)
+	level := newLevel(LevelFor(cfg))
+
+	switch cfg.Env {
 	case "production":
-		// TODO
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: r.ReplaceAttr,
+		})
 
 	case "development":
-		// TODO
+		handler = newPrettyHandler(os.Stdout, prettyOptions{
+			Level:       level,
+			ReplaceAttr: r.ReplaceAttr,
+			Color:       os.Getenv("NO_COLOR") == "" && isatty.IsTerminal(os.Stdout.Fd()),
+		})
 
 	default:
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: r.ReplaceAttr,
+		})
+	}
+
+	if cfg.Log.Sampling.Burst > 0 {
+		handler = newSamplingHandler(handler, cfg.Log.Sampling)
+	}
+
+	handler = &levelHandler{next: handler, level: level}
+
+	return slog.New(handler), level, r
+}
+
+// LevelFor() returns the base level from the config.
+//
+// If the level is not set, it defaults to info in production and to debug elsewhere.
+func LevelFor(cfg utils.Config) slog.Level {
+	def := slog.LevelDebug
+	if cfg.Env == "production" {
+		def = slog.LevelInfo
+	}
+
+	if cfg.Log.Level == "" {
+		return def
 	}
 
+	level, err := ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return def
+	}
+	return level
+}
+
+type ctxKey struct{}
+
+// WithContext() returns a copy of ctx that carries the logger.
+//
+// It is used to hand a request scoped logger (e.g. one with the request ID attached) to the services downstream.
+func WithContext(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
+}
+
+// FromContext() returns the logger stored in ctx, or the fallback logger if there is none.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	log, ok := ctx.Value(ctxKey{}).(*slog.Logger)
+	if !ok || log == nil {
+		return fallback
+	}
 	return log
 }
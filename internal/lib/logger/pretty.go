@@ -0,0 +1,188 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ANSI escape codes used by the pretty handler.
+const (
+	colorReset  = "\033[0m"
+	colorDim    = "\033[2m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+)
+
+// prettyOptions holds the settings of the pretty handler.
+type prettyOptions struct {
+	Level       slog.Leveler
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+	Color       bool
+}
+
+// prettyHandler is a slog.Handler that writes human-friendly lines for development.
+//
+// A line looks like "15:04:05.000 INFO  message op=... key=value". The level and the op are colored
+// when Color is set, which makes the output easy to scan in a terminal.
+type prettyHandler struct {
+	opts   prettyOptions
+	attrs  []slog.Attr
+	groups []string
+
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+// Creates a new pretty handler writing to w.
+func newPrettyHandler(w io.Writer, opts prettyOptions) *prettyHandler {
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	return &prettyHandler{
+		opts: opts,
+
+		mu: &sync.Mutex{},
+		w:  w,
+	}
+}
+
+func (h *prettyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *prettyHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(h.paint(colorDim, r.Time.Format(time.TimeOnly+".000")))
+	buf.WriteByte(' ')
+	buf.WriteString(h.paint(levelColor(r.Level), fmt.Sprintf("%-5s", r.Level.String())))
+	buf.WriteByte(' ')
+	buf.WriteString(r.Message)
+
+	for _, a := range h.attrs {
+		h.writeAttr(&buf, a, nil)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.writeAttr(&buf, a, h.groups)
+		return true
+	})
+
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	nh.attrs = append([]slog.Attr{}, h.attrs...)
+
+	for _, a := range attrs {
+		nh.attrs = append(nh.attrs, prefixAttr(a, h.groups))
+	}
+	return &nh
+}
+
+func (h *prettyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	nh := *h
+	nh.groups = append(append([]string{}, h.groups...), name)
+
+	return &nh
+}
+
+// Writes a single " key=value" pair, flattening the groups into dotted keys.
+func (h *prettyHandler) writeAttr(buf *bytes.Buffer, a slog.Attr, groups []string) {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(append([]string{}, groups...), a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			h.writeAttr(buf, ga, groups)
+		}
+		return
+	}
+
+	if h.opts.ReplaceAttr != nil {
+		a = h.opts.ReplaceAttr(groups, a)
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	a = prefixAttr(a, groups)
+
+	value := a.Value.String()
+	if needsQuoting(value) {
+		value = strconv.Quote(value)
+	}
+
+	buf.WriteByte(' ')
+
+	if a.Key == "op" {
+		buf.WriteString(h.paint(colorCyan, a.Key+"="+value))
+		return
+	}
+
+	buf.WriteString(h.paint(colorDim, a.Key+"="))
+	buf.WriteString(value)
+}
+
+// Wraps s into the color when the colors are enabled.
+func (h *prettyHandler) paint(color string, s string) string {
+	if !h.opts.Color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// Returns the color of the level name.
+func levelColor(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return colorRed
+	case level >= slog.LevelWarn:
+		return colorYellow
+	case level >= slog.LevelInfo:
+		return colorBlue
+	default:
+		return colorDim
+	}
+}
+
+// Prefixes the attribute key with the dotted group names.
+func prefixAttr(a slog.Attr, groups []string) slog.Attr {
+	for i := len(groups) - 1; i >= 0; i-- {
+		a.Key = groups[i] + "." + a.Key
+	}
+	return a
+}
+
+// Reports whether the value must be quoted to stay on a single readable line.
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r >= 0x7f {
+			return true
+		}
+	}
+	return false
+}
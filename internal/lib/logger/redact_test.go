@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+func TestRedactor(t *testing.T) {
+	r := newRedactor(utils.Config{
+		ElasticSearch: utils.ElasticSearch{Password: "hunter22", APIKey: "abc"},
+	})
+
+	tests := []struct {
+		name string
+		attr slog.Attr
+		want string
+	}{
+		{"sensitive key", slog.String("ES_Password", "anything"), redacted},
+		{"secret in value", slog.String("error", "login with hunter22 failed"), "login with " + redacted + " failed"},
+		{"secret in error", slog.Any("error", errors.New("bad password hunter22")), "bad password " + redacted},
+		{"short secret kept", slog.String("msg", "abc"), "abc"},
+		{"authorization scheme", slog.String("header", "Basic dXNlcjpwYXNz"), "Basic " + redacted},
+		{"url user info", slog.String("node", "https://elastic:changeme@es:9200"), "https://elastic:" + redacted + "@es:9200"},
+		{"url", slog.Any("node", &url.URL{Scheme: "https", User: url.UserPassword("elastic", "changeme"), Host: "es:9200"}), "https://elastic:xxxxx@es:9200"},
+		{"plain value", slog.String("query", "apple"), "apple"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ReplaceAttr(nil, tt.attr).Value.String(); got != tt.want {
+				t.Errorf("ReplaceAttr(%s) = %q, want %q", tt.attr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorSetSecrets(t *testing.T) {
+	old := utils.Config{Admin: utils.Admin{Token: "old-token"}}
+	rotated := utils.Config{Admin: utils.Admin{Token: "new-token"}}
+
+	var buf bytes.Buffer
+
+	r := newRedactor(old)
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: r.ReplaceAttr}))
+
+	r.SetSecrets(old, rotated)
+	log.Error("request failed", slog.String("error", "tokens old-token and new-token rejected"))
+
+	if out := buf.String(); strings.Contains(out, "old-token") || strings.Contains(out, "new-token") {
+		t.Errorf("logged %q, want both tokens redacted", out)
+	}
+
+	buf.Reset()
+	r.SetSecrets(rotated)
+	log.Error("request failed", slog.String("error", "old-token"))
+
+	if out := buf.String(); !strings.Contains(out, "old-token") {
+		t.Errorf("logged %q, want the dropped token kept", out)
+	}
+}
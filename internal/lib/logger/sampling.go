@@ -0,0 +1,188 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// samplingHandler is a slog.Handler that drops repetitive error logs.
+//
+// Records at the error level are grouped by message and op. Within every interval only the first Burst records of
+// a group are passed to the wrapped handler. When the interval of a group with dropped records ends, the last dropped
+// record is written with their number, so the volume is still visible even if the burst is over. Records below
+// the error level are never sampled.
+type samplingHandler struct {
+	next  slog.Handler
+	state *samplingState
+	op    string
+}
+
+// samplingState is shared between a handler and all the handlers derived from it with WithAttrs and WithGroup.
+type samplingState struct {
+	burst    int
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[string]*samplingCount
+}
+
+type samplingCount struct {
+	start   time.Time
+	n       int
+	dropped int
+
+	// The last dropped record and the handler it was dropped by, written by the timer at the end of the interval.
+	last  slog.Record
+	next  slog.Handler
+	timer *time.Timer
+}
+
+// Creates a new sampling handler wrapping next.
+func newSamplingHandler(next slog.Handler, cfg utils.LogSampling) *samplingHandler {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &samplingHandler{
+		next: next,
+		state: &samplingState{
+			burst:    cfg.Burst,
+			interval: interval,
+			counts:   make(map[string]*samplingCount),
+		},
+	}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelError {
+		return h.next.Handle(ctx, r)
+	}
+
+	op := h.op
+
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "op" {
+			op = a.Value.String()
+			return false
+		}
+		return true
+	})
+
+	pass, dropped := h.state.allow(r.Level.String()+"|"+op+"|"+r.Message, r, h.next)
+	if !pass {
+		return nil
+	}
+	if dropped > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("sampled_dropped", dropped))
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	op := h.op
+
+	for _, a := range attrs {
+		if a.Key == "op" {
+			op = a.Value.String()
+		}
+	}
+
+	return &samplingHandler{
+		next:  h.next.WithAttrs(attrs),
+		state: h.state,
+		op:    op,
+	}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{
+		next:  h.next.WithGroup(name),
+		state: h.state,
+		op:    h.op,
+	}
+}
+
+// Reports whether a record of the group can be written, and how many records of the group were dropped
+// in the previous interval and not reported yet.
+func (s *samplingState) allow(key string, r slog.Record, next slog.Handler) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := r.Time
+
+	c, ok := s.counts[key]
+	if !ok {
+		// Drop the groups of the past intervals, so the map doesn't grow with every distinct message.
+		// Their dropped records are still reported by the timers.
+		for k, old := range s.counts {
+			if t.Sub(old.start) >= s.interval {
+				delete(s.counts, k)
+			}
+		}
+
+		c = &samplingCount{start: t}
+		s.counts[key] = c
+	}
+
+	var dropped int
+
+	if t.Sub(c.start) >= s.interval {
+		// The record came before the timer fired, it reports the dropped ones instead.
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		dropped = c.dropped
+		c.dropped = 0
+
+		c = &samplingCount{start: t}
+		s.counts[key] = c
+	}
+
+	c.n++
+
+	if c.n <= s.burst {
+		return true, dropped
+	}
+
+	c.dropped++
+	c.last, c.next = r.Clone(), next
+
+	if c.timer == nil {
+		c.timer = time.AfterFunc(s.interval-t.Sub(c.start), func() { s.report(key, c) })
+	}
+	return false, 0
+}
+
+// Writes the last dropped record of the group with the number of dropped ones, at the end of its interval,
+// and forgets the group.
+func (s *samplingState) report(key string, c *samplingCount) {
+	s.mu.Lock()
+
+	dropped, r, next := c.dropped, c.last, c.next
+	c.dropped = 0
+
+	if s.counts[key] == c {
+		delete(s.counts, key)
+	}
+
+	s.mu.Unlock()
+
+	if dropped == 0 {
+		return
+	}
+
+	r.AddAttrs(slog.Int("sampled_dropped", dropped))
+
+	_ = next.Handle(context.Background(), r)
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Handler recording the messages of the records with the number of the dropped ones.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg := r.Message
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "sampled_dropped" {
+			msg += " dropped=" + a.Value.String()
+		}
+		return true
+	})
+
+	h.records = append(h.records, msg)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestSamplingHandler(t *testing.T) {
+	type record struct {
+		level slog.Level
+		msg   string
+		op    string
+		at    time.Duration
+	}
+
+	tests := []struct {
+		name    string
+		records []record
+		want    []string
+	}{
+		{
+			name: "burst",
+			records: []record{
+				{slog.LevelError, "a", "x", 0}, {slog.LevelError, "a", "x", 0}, {slog.LevelError, "a", "x", 0},
+			},
+			want: []string{"a", "a"},
+		},
+		{
+			name: "below error not sampled",
+			records: []record{
+				{slog.LevelWarn, "a", "x", 0}, {slog.LevelWarn, "a", "x", 0}, {slog.LevelWarn, "a", "x", 0},
+			},
+			want: []string{"a", "a", "a"},
+		},
+		{
+			name: "grouped by message and op",
+			records: []record{
+				{slog.LevelError, "a", "x", 0}, {slog.LevelError, "a", "x", 0}, {slog.LevelError, "a", "x", 0},
+				{slog.LevelError, "b", "x", 0}, {slog.LevelError, "a", "y", 0},
+			},
+			want: []string{"a", "a", "b", "a"},
+		},
+		{
+			name: "dropped reported in the next interval",
+			records: []record{
+				{slog.LevelError, "a", "x", 0}, {slog.LevelError, "a", "x", 0},
+				{slog.LevelError, "a", "x", time.Second}, {slog.LevelError, "a", "x", 2 * time.Second},
+				{slog.LevelError, "a", "x", time.Minute},
+			},
+			want: []string{"a", "a", "a dropped=2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingHandler{}
+			h := newSamplingHandler(rec, utils.LogSampling{Burst: 2, Interval: time.Minute})
+
+			start := time.Now()
+
+			for _, r := range tt.records {
+				record := slog.NewRecord(start.Add(r.at), r.level, r.msg, 0)
+				record.AddAttrs(slog.String("op", r.op))
+
+				if err := h.Handle(context.Background(), record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(rec.records) != len(tt.want) {
+				t.Fatalf("records = %q, want %q", rec.records, tt.want)
+			}
+			for i := range tt.want {
+				if rec.records[i] != tt.want[i] {
+					t.Fatalf("records = %q, want %q", rec.records, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSamplingHandlerWithAttrs(t *testing.T) {
+	rec := &recordingHandler{}
+	log := slog.New(newSamplingHandler(rec, utils.LogSampling{Burst: 1, Interval: time.Minute}))
+
+	// The op of the derived loggers groups their records, and the state is shared with them.
+	x, y := log.With(slog.String("op", "x")), log.With(slog.String("op", "y"))
+
+	x.Error("a")
+	x.Error("a")
+	y.Error("a")
+	log.With(slog.String("op", "x")).Error("a")
+
+	if len(rec.records) != 2 {
+		t.Errorf("records = %q, want one per op", rec.records)
+	}
+}
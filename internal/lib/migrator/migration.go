@@ -0,0 +1,358 @@
+package migrator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+)
+
+var (
+	ErrBadFileName      = fmt.Errorf("migration file name must be <version>_<name>.json or <version>_<name>.ndjson")
+	ErrDuplicateVersion = fmt.Errorf("duplicate migration version")
+	ErrBadOperation     = fmt.Errorf("operation must have exactly one of create_index, delete_index, put_mapping or put_settings with an index or a definition")
+	ErrIrreversible     = fmt.Errorf("migration can't be rolled back")
+)
+
+// Kind of a migration, given by the extension of its file.
+type Kind string
+
+const (
+	// KindIndex is a .json file with the index operations to apply and to roll back.
+	KindIndex Kind = "index"
+	// KindData is a .ndjson file in the format of the bulk API, rolled back by deleting the indexed documents.
+	KindData Kind = "data"
+)
+
+// Names of the migration files: the version, the name and the extension, e.g. 0001_create_products.json.
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(json|ndjson)$`)
+
+// Migration struct represents a migration file.
+type Migration struct {
+	Version  int
+	Name     string
+	Kind     Kind
+	Path     string
+	Checksum string
+}
+
+// String() returns the version and the name of the migration, e.g. "0001_create_products".
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Operations struct represents the content of an index migration: the operations applied by "up",
+// and the ones applied by "down" to roll them back. Empty "down" operations roll back nothing,
+// e.g. for a new field in the mapping, which can't be removed from an index.
+type Operations struct {
+	Up   []Operation `json:"up"`
+	Down []Operation `json:"down"`
+}
+
+// Operation struct represents a single index operation. Exactly one of its fields is set.
+type Operation struct {
+	CreateIndex *IndexOperation `json:"create_index,omitempty"`
+	DeleteIndex *IndexOperation `json:"delete_index,omitempty"`
+	PutMapping  *IndexOperation `json:"put_mapping,omitempty"`
+	PutSettings *IndexOperation `json:"put_settings,omitempty"`
+}
+
+// IndexOperation struct represents the index an operation applies to, with the body of its request:
+// the definition of a created index, or the mapping or the settings put.
+//
+// Instead of the index and the body, the operation can name the file of an index definition, relative to the
+// migration file. create_index then creates the first version of the index, <name>_v1, behind the alias <name>,
+// with the aliases, settings and mappings of the definition. put_mapping puts its mappings through the alias,
+// and delete_index deletes every version of the index. The definition is part of the checksum of the migration, so it
+// is versioned with the migrations using it (e.g. definitions/0001_products.json), apart from the current definition
+// of the index (ES_INDEX), which is changed by a new migration with its own copy, or by a reindex.
+type IndexOperation struct {
+	Index      string          `json:"index,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Definition string          `json:"definition,omitempty"`
+}
+
+// Load() reads the migrations in the directory, ordered by their versions.
+//
+// The .json files are index migrations and the .ndjson files are data migrations, the other files are ignored.
+// The index migrations are validated, so a malformed one is found before anything is applied.
+func Load(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	var migrations []Migration
+	versions := map[int]string{}
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".json" && ext != ".ndjson") {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			return []Migration{}, fmt.Errorf("%s: %w", e.Name(), ErrBadFileName)
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return []Migration{}, fmt.Errorf("%s: %w", e.Name(), ErrBadFileName)
+		}
+		if other, ok := versions[version]; ok {
+			return []Migration{}, fmt.Errorf("%w %d: %s and %s", ErrDuplicateVersion, version, other, e.Name())
+		}
+		versions[version] = e.Name()
+
+		m := Migration{
+			Version: version,
+			Name:    match[2],
+			Kind:    KindIndex,
+			Path:    filepath.Join(dir, e.Name()),
+		}
+		if match[3] == "ndjson" {
+			m.Kind = KindData
+		}
+
+		data, err := os.ReadFile(m.Path)
+		if err != nil {
+			return []Migration{}, err
+		}
+
+		h := sha256.New()
+		h.Write(data)
+
+		if m.Kind == KindIndex {
+			ops, err := parseOperations(data, dir)
+			if err != nil {
+				return []Migration{}, fmt.Errorf("%s: %w", e.Name(), err)
+			}
+
+			// The definitions are part of the migration, so a change to them is refused as a change to its file is.
+			for _, path := range ops.definitions() {
+				definition, err := os.ReadFile(filepath.Join(dir, path))
+				if err != nil {
+					return []Migration{}, fmt.Errorf("%s: %w", e.Name(), err)
+				}
+				h.Write(definition)
+			}
+		}
+
+		m.Checksum = hex.EncodeToString(h.Sum(nil))
+
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Operations() reads the operations of an index migration.
+func (m Migration) Operations() (Operations, error) {
+	data, err := os.ReadFile(m.Path)
+	if err != nil {
+		return Operations{}, err
+	}
+	return parseOperations(data, filepath.Dir(m.Path))
+}
+
+// DocumentIDs() reads the indices and the IDs of the documents indexed by a data migration, used to roll it back.
+//
+// It returns ErrIrreversible if an action has no _id, as the ID of its document is generated by Elasticsearch,
+// or if it updates or deletes a document, as the previous version of the document is unknown.
+func (m Migration) DocumentIDs() ([][2]string, error) {
+	var ids [][2]string
+
+	err := m.actions(func(a action) error {
+		if a.Op != "index" && a.Op != "create" {
+			return fmt.Errorf("%s: %w: it has a %s action", m, ErrIrreversible, a.Op)
+		}
+		if a.ID == "" {
+			return fmt.Errorf("%s: %w: a document has no _id", m, ErrIrreversible)
+		}
+
+		ids = append(ids, [2]string{a.Index, a.ID})
+		return nil
+	})
+
+	return ids, err
+}
+
+// Action of a data migration: the operation, the index and the ID of the document, and its source,
+// which is empty for a delete.
+type action struct {
+	Op     string
+	Index  string
+	ID     string
+	Source json.RawMessage
+}
+
+// Reads the actions of a data migration in order, calling fn for each of them.
+func (m Migration) actions(fn func(action) error) error {
+	f, err := os.Open(m.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var meta map[string]struct {
+			Index string          `json:"_index"`
+			ID    json.RawMessage `json:"_id"`
+		}
+
+		err := json.Unmarshal(line, &meta)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m, err)
+		}
+
+		for op, md := range meta {
+			a := action{Op: op, Index: md.Index}
+
+			if len(md.ID) > 0 && string(md.ID) != "null" {
+				a.ID = strings.Trim(string(md.ID), `"`)
+			}
+			if op != "delete" {
+				scanner.Scan()
+				a.Source = json.RawMessage(bytes.Clone(bytes.TrimSpace(scanner.Bytes())))
+			}
+
+			err := fn(a)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Parses and validates the operations of an index migration, resolving their definitions relative to dir.
+func parseOperations(data []byte, dir string) (Operations, error) {
+	var ops Operations
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&ops)
+	if err != nil {
+		return Operations{}, err
+	}
+
+	for _, list := range [][]Operation{ops.Up, ops.Down} {
+		for _, op := range list {
+			set := 0
+			for _, o := range []*IndexOperation{op.CreateIndex, op.DeleteIndex, op.PutMapping, op.PutSettings} {
+				if o != nil {
+					set++
+				}
+			}
+			if set != 1 {
+				return Operations{}, ErrBadOperation
+			}
+
+			err := resolve(op, dir)
+			if err != nil {
+				return Operations{}, err
+			}
+		}
+	}
+
+	return ops, nil
+}
+
+// Returns the definitions of the operations, relative to the migration file, without duplicates.
+func (ops Operations) definitions() []string {
+	var paths []string
+
+	for _, op := range append(slices.Clone(ops.Up), ops.Down...) {
+		if o := op.target(); o.Definition != "" && !slices.Contains(paths, o.Definition) {
+			paths = append(paths, o.Definition)
+		}
+	}
+	return paths
+}
+
+// Returns the field of the operation that is set.
+func (op Operation) target() *IndexOperation {
+	switch {
+	case op.CreateIndex != nil:
+		return op.CreateIndex
+	case op.DeleteIndex != nil:
+		return op.DeleteIndex
+	case op.PutMapping != nil:
+		return op.PutMapping
+	default:
+		return op.PutSettings
+	}
+}
+
+// Sets the index and the body of the operation from its definition, if it has one.
+func resolve(op Operation, dir string) error {
+	o := op.target()
+
+	// The static settings of a definition, e.g. the number of shards, can't be put on an existing index.
+	if op.PutSettings != nil && o.Definition != "" {
+		return fmt.Errorf("%w: put_settings takes a body, not a definition", ErrBadOperation)
+	}
+
+	if o.Definition == "" {
+		if o.Index == "" {
+			return ErrBadOperation
+		}
+		return nil
+	}
+	if o.Index != "" || len(o.Body) > 0 {
+		return fmt.Errorf("%w: a definition replaces the index and the body", ErrBadOperation)
+	}
+
+	d, err := indexdef.Load(filepath.Join(dir, o.Definition))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case op.CreateIndex != nil:
+		aliased, err := d.Aliased()
+		if err != nil {
+			return err
+		}
+		o.Index = d.Index(1)
+		o.Body, err = aliased.Body()
+		if err != nil {
+			return err
+		}
+
+	case op.DeleteIndex != nil:
+		// Every version, the pattern is expanded when the operation is performed.
+		o.Index = d.Name + "_v*"
+
+	default:
+		o.Index, o.Body = d.Name, d.Mappings
+	}
+
+	return nil
+}
@@ -0,0 +1,609 @@
+package migrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StateIndex is the name of the index recording the applied migrations, one document per version.
+const StateIndex = "esmigrator_migrations"
+
+// Definition of the state index.
+const stateIndexDefinition = `{
+  "mappings": {
+    "properties": {
+      "version": { "type": "integer" },
+      "name": { "type": "keyword" },
+      "checksum": { "type": "keyword" },
+      "applied_at": { "type": "date" }
+    }
+  }
+}`
+
+var (
+	ErrChecksumMismatch = fmt.Errorf("applied migration was modified")
+	ErrMissingMigration = fmt.Errorf("applied migration is missing")
+	ErrOutOfOrder       = fmt.Errorf("pending migration is older than the last applied one")
+	ErrUnknownVersion   = fmt.Errorf("unknown migration version")
+	ErrBulkFailed       = fmt.Errorf("bulk items failed")
+)
+
+// ResponseError is returned when Elasticsearch responds to a migration request with an error status.
+type ResponseError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s %s: elasticsearch responded with status %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// Config struct represents the connection to Elasticsearch used by the Migrator.
+//
+// The Client carries the TLS settings and the API key or service token, the username and password are sent
+// as basic authentication. The migrations are applied through a single node at Address.
+type Config struct {
+	Client   *http.Client
+	Address  string
+	Username string
+	Password string
+}
+
+// Migrator struct represents the versioned migrations of an Elasticsearch cluster.
+//
+// The applied migrations are recorded in StateIndex with the checksums of their files. The Migrator refuses to do
+// anything if an applied migration was modified or removed, or if a pending one is older than the last applied one,
+// as the cluster would no longer match the migration files.
+type Migrator struct {
+	config     Config
+	migrations []Migration
+}
+
+// Applied struct represents an applied migration, as recorded in StateIndex.
+type Applied struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Status struct represents the state of a migration: pending if Applied is nil, and Modified if its file
+// changed since it was applied. Missing migrations were applied, but their files are gone.
+type Status struct {
+	Migration Migration
+	Applied   *Applied
+	Modified  bool
+	Missing   bool
+}
+
+// New creates a new Migrator of the migrations, loaded with Load().
+func New(cfg Config, migrations []Migration) *Migrator {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	return &Migrator{
+		config:     cfg,
+		migrations: migrations,
+	}
+}
+
+// Status() returns the state of every migration, ordered by the versions.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return []Status{}, err
+	}
+
+	var statuses []Status
+
+	for _, mg := range m.migrations {
+		s := Status{Migration: mg}
+
+		if a, ok := applied[mg.Version]; ok {
+			s.Applied = &a
+			s.Modified = a.Checksum != mg.Checksum
+			delete(applied, mg.Version)
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	for _, a := range applied {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: a.Version, Name: a.Name, Checksum: a.Checksum},
+			Applied:   &a,
+			Missing:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Migration.Version < statuses[j].Migration.Version
+	})
+
+	return statuses, nil
+}
+
+// Up() applies all the pending migrations, returning the applied ones.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return []Migration{}, nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down() rolls back the last applied migration, returning it, or nothing if no migration is applied.
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	versions := sortedVersions(applied)
+	if len(versions) == 0 {
+		return []Migration{}, nil
+	}
+
+	target := 0
+	if len(versions) > 1 {
+		target = versions[len(versions)-2]
+	}
+	return m.To(ctx, target)
+}
+
+// To() applies or rolls back the migrations, so the version is the last applied one, returning the migrations
+// applied or rolled back, in the order they were. Version 0 rolls back all the migrations.
+//
+// Every migration is recorded as soon as it is applied, so a failure leaves the state consistent with the cluster,
+// up to the failed migration, which is left partially applied.
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	err = m.verify(applied)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	if version != 0 && m.find(version) == nil {
+		return []Migration{}, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	versions := sortedVersions(applied)
+	last := 0
+	if len(versions) > 0 {
+		last = versions[len(versions)-1]
+	}
+
+	var done []Migration
+
+	// Rolling back the migrations after the version, the last first.
+	for i := len(versions) - 1; i >= 0 && versions[i] > version; i-- {
+		mg := m.find(versions[i])
+
+		err := m.rollback(ctx, *mg)
+		if err != nil {
+			return done, fmt.Errorf("rolling back %s: %w", mg, err)
+		}
+		done = append(done, *mg)
+	}
+
+	// Applying the pending migrations up to the version.
+	for _, mg := range m.migrations {
+		if mg.Version > version {
+			break
+		}
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		if mg.Version < last {
+			return done, fmt.Errorf("%w: %s, the last applied is %d", ErrOutOfOrder, mg, last)
+		}
+
+		err := m.apply(ctx, mg)
+		if err != nil {
+			return done, fmt.Errorf("applying %s: %w", mg, err)
+		}
+		done = append(done, mg)
+	}
+
+	return done, nil
+}
+
+// Baseline() records the pending migrations up to the version as applied, without running them, returning
+// the recorded ones.
+//
+// It is how an existing deployment adopts the migrations: its products index was created and loaded before
+// the Migrator, so running the first migrations would fail on the existing index. Once they are recorded,
+// "up" applies only the later ones.
+func (m *Migrator) Baseline(ctx context.Context, version int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	err = m.verify(applied)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	if m.find(version) == nil {
+		return []Migration{}, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	var done []Migration
+
+	for _, mg := range m.migrations {
+		if mg.Version > version {
+			break
+		}
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+
+		err := m.record(ctx, Applied{
+			Version:   mg.Version,
+			Name:      mg.Name,
+			Checksum:  mg.Checksum,
+			AppliedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return done, fmt.Errorf("recording %s: %w", mg, err)
+		}
+		done = append(done, mg)
+	}
+
+	return done, nil
+}
+
+// Checks that every applied migration still has its file, unchanged.
+func (m *Migrator) verify(applied map[int]Applied) error {
+	for _, v := range sortedVersions(applied) {
+		a := applied[v]
+
+		mg := m.find(v)
+		if mg == nil {
+			return fmt.Errorf("%w: %04d_%s", ErrMissingMigration, a.Version, a.Name)
+		}
+		if mg.Checksum != a.Checksum {
+			return fmt.Errorf("%w: %s, checksum %s, applied with %s", ErrChecksumMismatch, mg, mg.Checksum, a.Checksum)
+		}
+	}
+	return nil
+}
+
+// Returns the migration of the version, or nil.
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// Applies the migration and records it.
+func (m *Migrator) apply(ctx context.Context, mg Migration) error {
+	switch mg.Kind {
+	case KindData:
+		f, err := os.Open(mg.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		err = m.bulk(ctx, f)
+		if err != nil {
+			return err
+		}
+
+	default:
+		ops, err := mg.Operations()
+		if err != nil {
+			return err
+		}
+
+		err = m.operations(ctx, ops.Up)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.record(ctx, Applied{
+		Version:   mg.Version,
+		Name:      mg.Name,
+		Checksum:  mg.Checksum,
+		AppliedAt: time.Now().UTC(),
+	})
+}
+
+// Rolls back the migration and removes its record.
+func (m *Migrator) rollback(ctx context.Context, mg Migration) error {
+	switch mg.Kind {
+	case KindData:
+		ids, err := mg.DocumentIDs()
+		if err != nil {
+			return err
+		}
+
+		var body bytes.Buffer
+
+		for _, id := range ids {
+			action, err := json.Marshal(map[string]any{"delete": map[string]string{"_index": id[0], "_id": id[1]}})
+			if err != nil {
+				return err
+			}
+			body.Write(action)
+			body.WriteByte('\n')
+		}
+
+		if body.Len() > 0 {
+			err = m.bulk(ctx, &body)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		ops, err := mg.Operations()
+		if err != nil {
+			return err
+		}
+
+		err = m.operations(ctx, ops.Down)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := m.do(ctx, http.MethodDelete, "/"+StateIndex+"/_doc/"+strconv.Itoa(mg.Version)+"?refresh=true", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Performs the index operations.
+func (m *Migrator) operations(ctx context.Context, ops []Operation) error {
+	for _, op := range ops {
+		var (
+			method = http.MethodPut
+			o      *IndexOperation
+			suffix string
+		)
+
+		switch {
+		case op.CreateIndex != nil:
+			o = op.CreateIndex
+		case op.DeleteIndex != nil:
+			o, method = op.DeleteIndex, http.MethodDelete
+		case op.PutMapping != nil:
+			o, suffix = op.PutMapping, "/_mapping"
+		case op.PutSettings != nil:
+			o, suffix = op.PutSettings, "/_settings"
+		default:
+			return ErrBadOperation
+		}
+
+		indices := []string{o.Index}
+
+		// A pattern, e.g. the versions of an index deleted with its definition, is expanded to the existing indices,
+		// as Elasticsearch refuses to delete indices by a wildcard.
+		if strings.HasSuffix(o.Index, "*") {
+			var err error
+
+			indices, err = m.indices(ctx, o.Index)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, index := range indices {
+			var body io.Reader
+			if len(o.Body) > 0 {
+				body = bytes.NewReader(o.Body)
+			}
+
+			resp, err := m.do(ctx, method, "/"+url.PathEscape(index)+suffix, body)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+// Returns the sorted names of the indices matching the pattern.
+func (m *Migrator) indices(ctx context.Context, pattern string) ([]string, error) {
+	resp, err := m.do(ctx, http.MethodGet, "/"+pattern, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result map[string]json.RawMessage
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result))
+	for name := range result {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Performs the bulk request, returning ErrBulkFailed if any of its actions failed.
+func (m *Migrator) bulk(ctx context.Context, body io.Reader) error {
+	resp, err := m.do(ctx, http.MethodPost, "/_bulk?refresh=true", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	var (
+		failed int
+		first  string
+	)
+
+	for _, item := range result.Items {
+		for action, r := range item {
+			if len(r.Error) == 0 {
+				continue
+			}
+			if failed == 0 {
+				first = fmt.Sprintf("%s %s: %s", action, r.ID, r.Error)
+			}
+			failed++
+		}
+	}
+
+	return fmt.Errorf("%w: %d of %d, first: %s", ErrBulkFailed, failed, len(result.Items), first)
+}
+
+// Returns the applied migrations by their versions. No migration is applied if the state index doesn't exist.
+func (m *Migrator) applied(ctx context.Context) (map[int]Applied, error) {
+	resp, err := m.do(ctx, http.MethodPost, "/"+StateIndex+"/_search", strings.NewReader(`{"query": {"match_all": {}}, "size": 10000}`))
+	if err != nil {
+		var re *ResponseError
+		if errors.As(err, &re) && re.StatusCode == http.StatusNotFound {
+			return map[int]Applied{}, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source Applied `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Applied{}
+	for _, h := range result.Hits.Hits {
+		applied[h.Source.Version] = h.Source
+	}
+
+	return applied, nil
+}
+
+// Records the applied migration, creating the state index if needed.
+func (m *Migrator) record(ctx context.Context, a Applied) error {
+	resp, err := m.do(ctx, http.MethodHead, "/"+StateIndex, nil)
+	if err != nil {
+		var re *ResponseError
+		if !errors.As(err, &re) || re.StatusCode != http.StatusNotFound {
+			return err
+		}
+
+		resp, err = m.do(ctx, http.MethodPut, "/"+StateIndex, strings.NewReader(stateIndexDefinition))
+		if err != nil {
+			return err
+		}
+	}
+	resp.Body.Close()
+
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err = m.do(ctx, http.MethodPut, "/"+StateIndex+"/_doc/"+strconv.Itoa(a.Version)+"?refresh=true", bytes.NewReader(doc))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Performs the request, returning a *ResponseError if Elasticsearch responds with an error status.
+//
+// The bodies of the _bulk requests are sent as NDJSON, the other ones as JSON.
+func (m *Migrator) do(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(m.config.Address, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/_bulk") {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+	}
+	if m.config.Username != "" {
+		req.SetBasicAuth(m.config.Username, m.config.Password)
+	}
+
+	resp, err := m.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return nil, &ResponseError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(data)),
+		}
+	}
+
+	return resp, nil
+}
+
+// Returns the versions of the applied migrations in ascending order.
+func sortedVersions(applied map[int]Applied) []int {
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
@@ -0,0 +1,410 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/fakees"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+)
+
+const (
+	createIndex = `{
+  "up": [{ "create_index": { "index": "products", "body": { "mappings": { "properties": { "category": { "type": "keyword" } } } } } }],
+  "down": [{ "delete_index": { "index": "products" } }]
+}`
+	products = `{"index": {"_index": "products", "_id": "1"}}
+{"name": "Apple MacBook Air", "category": "laptop"}
+{"index": {"_index": "products", "_id": "2"}}
+{"name": "Apple iPhone", "category": "smartphone"}
+`
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func newTestMigrator(t *testing.T, address string, dir string) *Migrator {
+	t.Helper()
+
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(Config{Address: address}, migrations)
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   error
+	}{
+		{"bad file name", map[string]string{"products.json": createIndex}, ErrBadFileName},
+		{"duplicate version", map[string]string{"1_a.json": createIndex, "01_b.ndjson": products}, ErrDuplicateVersion},
+		{"bad operation", map[string]string{"1_a.json": `{"up": [{"create_index": {}}]}`}, ErrBadOperation},
+		{"definition and index", map[string]string{"1_a.json": `{"up": [{"create_index": {"index": "a", "definition": "a.json"}}]}`}, ErrBadOperation},
+		{"settings definition", map[string]string{"1_a.json": `{"up": [{"put_settings": {"definition": "a.json"}}]}`}, ErrBadOperation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeMigrations(t, tt.files))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadDefinition(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"products.yaml": "name: products\nmappings:\n  properties:\n    category:\n      type: keyword\n",
+		"0001_create_products.json": `{
+  "up": [{ "create_index": { "definition": "products.yaml" } }],
+  "down": [{ "delete_index": { "definition": "products.yaml" } }]
+}`,
+	})
+
+	migrations, err := Load(dir)
+	if err != nil || len(migrations) != 1 {
+		t.Fatalf("Load() = %v, %v, want the index migration alone", migrations, err)
+	}
+
+	ops, err := migrations[0].Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"aliases":{"products":{}},"mappings":{"properties":{"category":{"type":"keyword"}}}}`
+	if o := ops.Up[0].CreateIndex; o.Index != "products_v1" || string(o.Body) != want {
+		t.Errorf("create_index = %s %s, want products_v1 %s", o.Index, o.Body, want)
+	}
+	if o := ops.Down[0].DeleteIndex; o.Index != "products_v*" || len(o.Body) != 0 {
+		t.Errorf("delete_index = %s %s, want every version of products without a body", o.Index, o.Body)
+	}
+
+	// The definition is part of the checksum, so editing it once applied stops the Migrator.
+	srv := httptest.NewServer(fakees.New())
+	t.Cleanup(srv.Close)
+
+	_, err = New(Config{Address: srv.URL}, migrations).Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "products.yaml"), []byte("name: products\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newTestMigrator(t, srv.URL, dir).Up(context.Background())
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Up() error = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(fakees.New())
+	t.Cleanup(srv.Close)
+
+	dir := writeMigrations(t, map[string]string{
+		"0001_create_products.json": createIndex,
+		"0002_products.ndjson":      products,
+	})
+	m := newTestMigrator(t, srv.URL, dir)
+
+	done, err := m.Up(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Up() = %v, %v, want both migrations", done, err)
+	}
+
+	done, err = m.Up(ctx)
+	if err != nil || len(done) != 0 {
+		t.Fatalf("Up() = %v, %v, want nothing to do", done, err)
+	}
+
+	done, err = m.Down(ctx)
+	if err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("Down() = %v, %v, want 0002_products", done, err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 2 || statuses[0].Applied == nil || statuses[1].Applied != nil {
+		t.Fatalf("Status() = %+v, %v, want 0001 applied and 0002 pending", statuses, err)
+	}
+
+	// A modified applied migration stops the Migrator.
+	err = os.WriteFile(filepath.Join(dir, "0001_create_products.json"), []byte(createIndex+"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newTestMigrator(t, srv.URL, dir).Up(ctx)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Up() error = %v, want %v", err, ErrChecksumMismatch)
+	}
+
+	// So does a pending migration older than the last applied one.
+	err = os.WriteFile(filepath.Join(dir, "0001_create_products.json"), []byte(createIndex), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(filepath.Join(dir, "0002_products.ndjson"), filepath.Join(dir, "0003_products.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err = newTestMigrator(t, srv.URL, dir).Up(ctx)
+	if err != nil || len(done) != 1 || done[0].Version != 3 {
+		t.Fatalf("Up() = %v, %v, want 0003_products", done, err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "0002_more_products.ndjson"), []byte(products), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = newTestMigrator(t, srv.URL, dir)
+
+	_, err = m.Up(ctx)
+	if !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("Up() error = %v, want %v", err, ErrOutOfOrder)
+	}
+
+	done, err = m.To(ctx, 0)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("To(0) = %v, %v, want both applied migrations rolled back", done, err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(fakees.New())
+	t.Cleanup(srv.Close)
+
+	dir := writeMigrations(t, map[string]string{
+		"0001_create_products.json": createIndex,
+		"0002_products.ndjson":      products,
+		"0003_more_products.ndjson": `{"index": {"_index": "products", "_id": "3"}}` + "\n" + `{"name": "Apple Watch", "category": "watch"}` + "\n",
+	})
+	m := newTestMigrator(t, srv.URL, dir)
+
+	_, err := m.Baseline(ctx, 4)
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("Baseline(4) error = %v, want %v", err, ErrUnknownVersion)
+	}
+
+	done, err := m.Baseline(ctx, 2)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Baseline(2) = %v, %v, want 0001 and 0002 recorded", done, err)
+	}
+
+	// Nothing was run, the index doesn't exist.
+	_, exists, err := m.liveIndex(ctx, "products")
+	if err != nil || exists {
+		t.Fatalf("products exists = %v, %v, want false", exists, err)
+	}
+
+	done, err = m.Baseline(ctx, 2)
+	if err != nil || len(done) != 0 {
+		t.Fatalf("Baseline(2) = %v, %v, want nothing to do", done, err)
+	}
+
+	done, err = m.Up(ctx)
+	if err != nil || len(done) != 1 || done[0].Version != 3 {
+		t.Fatalf("Up() = %v, %v, want 0003_more_products alone", done, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(fakees.New())
+	t.Cleanup(srv.Close)
+
+	definition := indexdef.Definition{
+		Name:     "products",
+		Mappings: json.RawMessage(`{"properties": {"category": {"type": "keyword"}, "name": {"type": "text"}}}`),
+	}
+
+	dir := writeMigrations(t, map[string]string{
+		"0001_create_products.json": createIndex,
+		"0002_products.ndjson":      products,
+	})
+
+	_, err := newTestMigrator(t, srv.URL, dir).Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "0003_more_products.ndjson"), []byte(
+		`{"index": {"_index": "products", "_id": "1"}}`+"\n"+`{"name": "Apple MacBook Air", "category": "laptop"}`+"\n"+
+			`{"index": {"_index": "products", "_id": "2"}}`+"\n"+`{"name": "Apple iPhone 15", "category": "smartphone"}`+"\n"+
+			`{"create": {"_index": "products", "_id": "2"}}`+"\n"+`{"name": "Apple iPhone", "category": "smartphone"}`+"\n"+
+			`{"index": {"_index": "products", "_id": "3"}}`+"\n"+`{"name": "Apple Watch", "category": "watch"}`+"\n"+
+			`{"delete": {"_index": "products", "_id": "3"}}`+"\n",
+	), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newTestMigrator(t, srv.URL, dir).Plan(ctx, definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Exists || len(p.Changes) != 1 || p.Changes[0].Name != "name" || p.Changes[0].Kind != indexdef.Added {
+		t.Errorf("Plan() changes = %v, want the name field added", p.Changes)
+	}
+	if len(p.Pending) != 1 || len(p.Data) != 1 {
+		t.Fatalf("Plan() = %+v, want 0003_more_products pending", p)
+	}
+
+	want := DataPlan{Migration: p.Pending[0], Create: 1, Update: 1, Delete: 1, Unchanged: 1, Conflicts: 1}
+	if p.Data[0] != want {
+		t.Errorf("Plan() data = %+v, want %+v", p.Data[0], want)
+	}
+
+	// Nothing was written.
+	statuses, err := newTestMigrator(t, srv.URL, dir).Status(ctx)
+	if err != nil || statuses[2].Applied != nil {
+		t.Errorf("Status() = %+v, %v, want 0003_more_products pending", statuses, err)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(fakees.New())
+	t.Cleanup(srv.Close)
+
+	dir := writeMigrations(t, map[string]string{
+		"products.yaml": "name: products\nmappings:\n  properties:\n    category:\n      type: keyword\n",
+		"0001_create_products.json": `{
+  "up": [{ "create_index": { "definition": "products.yaml" } }],
+  "down": [{ "delete_index": { "definition": "products.yaml" } }]
+}`,
+		"0002_products.ndjson": products,
+	})
+	m := newTestMigrator(t, srv.URL, dir)
+
+	_, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definition, err := indexdef.Load(filepath.Join(dir, "products.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := m.Reindex(ctx, definition, `ctx._source.stock = 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Reindex{Alias: "products", From: "products_v1", To: "products_v2", Documents: 2}
+	if r != want {
+		t.Errorf("Reindex() = %+v, want %+v", r, want)
+	}
+
+	live, _, err := m.liveIndex(ctx, "products")
+	if err != nil || live.Name != "products_v2" {
+		t.Fatalf("products points to %s, %v, want products_v2", live.Name, err)
+	}
+
+	from, err := m.SwapAlias(ctx, definition, 1)
+	if err != nil || from != "products_v2" {
+		t.Fatalf("SwapAlias(1) = %s, %v, want products_v2", from, err)
+	}
+
+	versions, current, err := m.Versions(ctx, definition)
+	if err != nil || len(versions) != 2 || current != "products_v1" {
+		t.Fatalf("Versions() = %v, %s, %v, want both versions with products_v1 live", versions, current, err)
+	}
+
+	_, err = m.SwapAlias(ctx, definition, 3)
+	if !errors.Is(err, ErrUnknownIndex) {
+		t.Fatalf("SwapAlias(3) error = %v, want %v", err, ErrUnknownIndex)
+	}
+
+	// Rolling back the migrations deletes every version of the index.
+	_, err = m.To(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, current, err = m.Versions(ctx, definition)
+	if err != nil || len(versions) != 0 || current != "" {
+		t.Fatalf("Versions() = %v, %s, %v, want no index", versions, current, err)
+	}
+}
+
+func TestReindexLegacyIndex(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(fakees.New())
+	t.Cleanup(srv.Close)
+
+	// The index created before the indices were versioned, named like the alias.
+	dir := writeMigrations(t, map[string]string{
+		"0001_create_products.json": createIndex,
+		"0002_products.ndjson":      products,
+	})
+	m := newTestMigrator(t, srv.URL, dir)
+
+	_, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definition := indexdef.Definition{
+		Name:     "products",
+		Mappings: json.RawMessage(`{"properties": {"category": {"type": "keyword"}}}`),
+	}
+
+	r, err := m.Reindex(ctx, definition, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Reindex{Alias: "products", From: "products", To: "products_v1", Documents: 2, Backup: "products_v0"}
+	if r != want {
+		t.Errorf("Reindex() = %+v, want %+v", r, want)
+	}
+
+	// The original data is kept in the backup, which can be rolled back to and written to.
+	from, err := m.SwapAlias(ctx, definition, 0)
+	if err != nil || from != "products_v1" {
+		t.Fatalf("SwapAlias(0) = %s, %v, want products_v1", from, err)
+	}
+
+	n, err := m.count(ctx, "products")
+	if err != nil || n != 2 {
+		t.Fatalf("products has %d documents, %v, want 2", n, err)
+	}
+
+	err = m.bulk(ctx, strings.NewReader(`{"index": {"_index": "products", "_id": "3"}}`+"\n"+`{"name": "Apple Watch"}`+"\n"))
+	if err != nil {
+		t.Fatalf("writing to the backup: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package migrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+)
+
+// Number of documents fetched by a single _mget request of the plan.
+const mgetBatch = 1000
+
+// Plan struct represents what "up" would do, computed without writing anything.
+//
+// Index is the live index of the definition, with the Changes the definition makes to it, if it Exists.
+// Pending are the migrations "up" would apply, and Data counts the documents changed by the pending data migrations.
+type Plan struct {
+	Index   string
+	Exists  bool
+	Changes []indexdef.Change
+	Pending []Migration
+	Data    []DataPlan
+}
+
+// Reindex() reports whether any of the changes can't be applied to the live index.
+func (p Plan) Reindex() bool {
+	for _, c := range p.Changes {
+		if c.Reindex {
+			return true
+		}
+	}
+	return false
+}
+
+// DataPlan struct represents the documents a pending data migration would create, update, delete or leave untouched.
+//
+// A document is Unchanged if it would be indexed with the same source, or if it would be deleted but doesn't exist.
+// Conflicts are the create actions of existing documents, which would fail. An update action is counted as an update
+// if its document exists, and as a conflict otherwise.
+type DataPlan struct {
+	Migration Migration
+	Create    int
+	Update    int
+	Delete    int
+	Unchanged int
+	Conflicts int
+}
+
+// Plan() compares the live index with its definition and counts the documents the pending data migrations would change.
+//
+// It makes only read requests. Like "up", it fails if an applied migration was modified or removed, or if a pending
+// migration is older than the last applied one. The documents of a data migration are compared with the live ones,
+// as changed by the pending data migrations before it.
+func (m *Migrator) Plan(ctx context.Context, definition indexdef.Definition) (Plan, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	err = m.verify(applied)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	p := Plan{Index: definition.Name}
+
+	live, exists, err := m.liveIndex(ctx, definition.Name)
+	if err != nil {
+		return Plan{}, err
+	}
+	if exists {
+		p.Index, p.Exists = live.Name, true
+
+		// A version of the index has the name of the definition among its aliases.
+		desired := definition
+		if live.Name != definition.Name {
+			desired, err = definition.Aliased()
+			if err != nil {
+				return Plan{}, err
+			}
+		}
+
+		p.Changes, err = indexdef.Diff(live, desired)
+		if err != nil {
+			return Plan{}, err
+		}
+	}
+
+	versions := sortedVersions(applied)
+	last := 0
+	if len(versions) > 0 {
+		last = versions[len(versions)-1]
+	}
+
+	// Sources of the documents changed by the pending data migrations, nil for the deleted ones.
+	planned := map[[2]string]json.RawMessage{}
+
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		if mg.Version < last {
+			return Plan{}, fmt.Errorf("%w: %s, the last applied is %d", ErrOutOfOrder, mg, last)
+		}
+
+		p.Pending = append(p.Pending, mg)
+
+		if mg.Kind != KindData {
+			continue
+		}
+
+		dp, err := m.planData(ctx, mg, planned)
+		if err != nil {
+			return Plan{}, fmt.Errorf("planning %s: %w", mg, err)
+		}
+		p.Data = append(p.Data, dp)
+	}
+
+	return p, nil
+}
+
+// Returns the live index, or the index behind the alias, with its aliases, settings and mappings.
+func (m *Migrator) liveIndex(ctx context.Context, name string) (indexdef.Definition, bool, error) {
+	resp, err := m.do(ctx, http.MethodGet, "/"+url.PathEscape(name), nil)
+	if err != nil {
+		var re *ResponseError
+		if errors.As(err, &re) && re.StatusCode == http.StatusNotFound {
+			return indexdef.Definition{}, false, nil
+		}
+		return indexdef.Definition{}, false, err
+	}
+	defer resp.Body.Close()
+
+	var result map[string]indexdef.Definition
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return indexdef.Definition{}, false, err
+	}
+
+	for index, d := range result {
+		d.Name = index
+		return d, true, nil
+	}
+	return indexdef.Definition{}, false, nil
+}
+
+// Counts the documents the data migration would change, recording their new sources in planned.
+func (m *Migrator) planData(ctx context.Context, mg Migration, planned map[[2]string]json.RawMessage) (DataPlan, error) {
+	dp := DataPlan{Migration: mg}
+
+	var batch []action
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		current, err := m.currentSources(ctx, batch, planned)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range batch {
+			key := [2]string{a.Index, a.ID}
+			source, exists := current[key]
+
+			switch {
+			case a.Op == "delete" && !exists:
+				dp.Unchanged++
+			case a.Op == "delete":
+				dp.Delete++
+				planned[key] = nil
+				delete(current, key)
+			case a.Op == "update" && !exists, a.Op == "create" && exists:
+				dp.Conflicts++
+			case a.Op == "update":
+				// The partial document isn't merged, the next actions of the document see its previous source.
+				dp.Update++
+			case exists && sameJSON(source, a.Source):
+				dp.Unchanged++
+			default:
+				if exists {
+					dp.Update++
+				} else {
+					dp.Create++
+				}
+				planned[key] = a.Source
+				current[key] = a.Source
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	err := mg.actions(func(a action) error {
+		// The documents without an ID are always created, with an ID generated by Elasticsearch.
+		if a.ID == "" {
+			if a.Op == "index" || a.Op == "create" {
+				dp.Create++
+			} else {
+				dp.Conflicts++
+			}
+			return nil
+		}
+
+		batch = append(batch, a)
+		if len(batch) < mgetBatch {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return DataPlan{}, err
+	}
+
+	return dp, flush()
+}
+
+// Returns the current sources of the documents of the actions: the planned ones, or the live ones fetched with _mget.
+func (m *Migrator) currentSources(ctx context.Context, batch []action, planned map[[2]string]json.RawMessage) (map[[2]string]json.RawMessage, error) {
+	current := map[[2]string]json.RawMessage{}
+
+	type doc struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id"`
+	}
+
+	var docs []doc
+
+	for _, a := range batch {
+		key := [2]string{a.Index, a.ID}
+
+		if source, ok := planned[key]; ok {
+			if source != nil {
+				current[key] = source
+			}
+			continue
+		}
+		docs = append(docs, doc{Index: a.Index, ID: a.ID})
+	}
+
+	if len(docs) == 0 {
+		return current, nil
+	}
+
+	body, err := json.Marshal(map[string]any{"docs": docs})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.do(ctx, http.MethodPost, "/_mget", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Docs []struct {
+			Found  bool            `json:"found"`
+			Source json.RawMessage `json:"_source"`
+		} `json:"docs"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	// The documents of a missing index aren't found, they come with an error instead.
+	for i, d := range result.Docs {
+		if d.Found && i < len(docs) {
+			current[[2]string{docs[i].Index, docs[i].ID}] = d.Source
+		}
+	}
+
+	return current, nil
+}
+
+// Reports whether both JSON documents are equal, whatever the order of their keys.
+func sameJSON(a json.RawMessage, b json.RawMessage) bool {
+	var va, vb any
+
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
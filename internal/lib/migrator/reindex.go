@@ -0,0 +1,387 @@
+package migrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+)
+
+var (
+	ErrNoIndex       = fmt.Errorf("index doesn't exist, apply the migrations first")
+	ErrReindexFailed = fmt.Errorf("reindex failed")
+	ErrCountMismatch = fmt.Errorf("document counts differ after the reindex")
+	ErrUnknownIndex  = fmt.Errorf("no such version of the index")
+	ErrNotVersioned  = fmt.Errorf("the live index isn't a version of the index, it is replaced by the first reindex")
+)
+
+// Interval between two polls of the reindex task.
+const pollPeriod = time.Second
+
+// Reindex struct represents a completed reindex: the documents were copied From the previous index To the new one,
+// and the Alias, the name of the definition, was moved to it with the other aliases of the definition.
+//
+// Backup is set if the previous index was the one named like the alias, created before the indices were versioned.
+// It is deleted in the swap, as the alias takes its name, so it was cloned to Backup, version 0 of the index, first.
+// SwapAlias() rolls back to the backup like to any other version.
+type Reindex struct {
+	Alias     string
+	From      string
+	To        string
+	Documents int
+	Backup    string
+}
+
+// Reindex() copies the documents of the live index to the next version of the index, and moves the aliases to it.
+//
+// The new index is created from the definition, so its settings and mappings can be changed in any way, e.g. the type
+// of a field or an analyzer. The optional Painless script transforms every document copied. The copy runs as a task
+// on the cluster, polled until it completes. The alias is moved atomically once the document counts of both indices
+// are equal, so the searches never see a partial index. The previous index is kept, SwapAlias() rolls back to it.
+// The index created before the indices were versioned is deleted by the swap instead, so it is backed up first.
+//
+// If the copy fails or the counts differ, the alias is left on the previous index and the new one is kept for inspection.
+// The documents written through the alias during the copy aren't carried over, the data migrations must not run meanwhile.
+func (m *Migrator) Reindex(ctx context.Context, definition indexdef.Definition, script string) (Reindex, error) {
+	live, exists, err := m.liveIndex(ctx, definition.Name)
+	if err != nil {
+		return Reindex{}, err
+	}
+	if !exists {
+		return Reindex{}, fmt.Errorf("%w: %s", ErrNoIndex, definition.Name)
+	}
+
+	versions, err := m.versions(ctx, definition)
+	if err != nil {
+		return Reindex{}, err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+
+	r := Reindex{
+		Alias: definition.Name,
+		From:  live.Name,
+		To:    definition.Index(next),
+	}
+
+	if live.Name == definition.Name {
+		r.Backup = definition.Index(0)
+
+		err = m.backup(ctx, live.Name, r.Backup, slices.Contains(versions, 0))
+		if err != nil {
+			return r, err
+		}
+	}
+
+	// The aliases are added by the swap, so the searches don't see both indices meanwhile.
+	body, err := indexdef.Definition{Settings: definition.Settings, Mappings: definition.Mappings}.Body()
+	if err != nil {
+		return Reindex{}, err
+	}
+
+	resp, err := m.do(ctx, http.MethodPut, "/"+url.PathEscape(r.To), bytes.NewReader(body))
+	if err != nil {
+		return Reindex{}, fmt.Errorf("creating %s: %w", r.To, err)
+	}
+	resp.Body.Close()
+
+	err = m.copyDocuments(ctx, r.From, r.To, script)
+	if err != nil {
+		return r, fmt.Errorf("%w: %s kept for inspection: %w", ErrReindexFailed, r.To, err)
+	}
+
+	resp, err = m.do(ctx, http.MethodPost, "/"+url.PathEscape(r.To)+"/_refresh", nil)
+	if err != nil {
+		return r, err
+	}
+	resp.Body.Close()
+
+	from, err := m.count(ctx, r.From)
+	if err != nil {
+		return r, err
+	}
+	to, err := m.count(ctx, r.To)
+	if err != nil {
+		return r, err
+	}
+	if from != to {
+		return r, fmt.Errorf("%w: %s has %d, %s has %d, the alias wasn't moved", ErrCountMismatch, r.From, from, r.To, to)
+	}
+	r.Documents = to
+
+	err = m.moveAliases(ctx, definition, live, r.To)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// SwapAlias() moves the aliases of the definition to a version of the index, e.g. the previous one to roll back
+// a reindex. It returns the index the aliases were moved from, the same as the version's if nothing was done.
+func (m *Migrator) SwapAlias(ctx context.Context, definition indexdef.Definition, version int) (string, error) {
+	live, exists, err := m.liveIndex(ctx, definition.Name)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrNoIndex, definition.Name)
+	}
+	if live.Name == definition.Name {
+		return "", fmt.Errorf("%w: %s", ErrNotVersioned, definition.Name)
+	}
+
+	versions, err := m.versions(ctx, definition)
+	if err != nil {
+		return "", err
+	}
+	if i := sort.SearchInts(versions, version); i == len(versions) || versions[i] != version {
+		return "", fmt.Errorf("%w: %s", ErrUnknownIndex, definition.Index(version))
+	}
+
+	target := definition.Index(version)
+	if live.Name == target {
+		return live.Name, nil
+	}
+
+	return live.Name, m.moveAliases(ctx, definition, live, target)
+}
+
+// Versions() returns the versions of the index in ascending order, and the live one, the index behind the alias.
+// The live index is the name of the definition itself if the indices aren't versioned yet, and empty if it doesn't exist.
+func (m *Migrator) Versions(ctx context.Context, definition indexdef.Definition) ([]int, string, error) {
+	live, exists, err := m.liveIndex(ctx, definition.Name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	versions, err := m.versions(ctx, definition)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !exists {
+		return versions, "", nil
+	}
+	return versions, live.Name, nil
+}
+
+// Clones the index to the backup, so it can be rolled back to once the swap deletes it. A backup left by a failed
+// reindex is replaced, as the index is still live. Elasticsearch clones only the write-blocked indices, so the writes
+// are blocked meanwhile, then unblocked on both indices.
+func (m *Migrator) backup(ctx context.Context, index string, backup string, exists bool) error {
+	if exists {
+		resp, err := m.do(ctx, http.MethodDelete, "/"+url.PathEscape(backup), nil)
+		if err != nil {
+			return fmt.Errorf("deleting the previous backup %s: %w", backup, err)
+		}
+		resp.Body.Close()
+	}
+
+	err := m.blockWrites(ctx, index, true)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.do(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_clone/"+url.PathEscape(backup), nil)
+	if err == nil {
+		resp.Body.Close()
+		err = m.blockWrites(ctx, backup, false)
+	}
+
+	unblockErr := m.blockWrites(ctx, index, false)
+	if err != nil {
+		return fmt.Errorf("backing up %s to %s: %w", index, backup, err)
+	}
+	return unblockErr
+}
+
+// Blocks or unblocks the writes to the index.
+func (m *Migrator) blockWrites(ctx context.Context, index string, block bool) error {
+	value := "null"
+	if block {
+		value = "true"
+	}
+
+	resp, err := m.do(ctx, http.MethodPut, "/"+url.PathEscape(index)+"/_settings", strings.NewReader(`{"index.blocks.write": `+value+`}`))
+	if err != nil {
+		return fmt.Errorf("setting the write block of %s: %w", index, err)
+	}
+	return resp.Body.Close()
+}
+
+// Returns the existing versions of the index in ascending order.
+func (m *Migrator) versions(ctx context.Context, definition indexdef.Definition) ([]int, error) {
+	names, err := m.indices(ctx, definition.Name+"_v*")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, name := range names {
+		if v, ok := definition.Version(name); ok {
+			versions = append(versions, v)
+		}
+	}
+	sort.Ints(versions)
+
+	return versions, nil
+}
+
+// Copies the documents with a reindex task, waiting for it to complete.
+func (m *Migrator) copyDocuments(ctx context.Context, from string, to string, script string) error {
+	request := map[string]any{
+		"source": map[string]any{"index": from},
+		"dest":   map[string]any{"index": to},
+	}
+	if script != "" {
+		request["script"] = map[string]any{"source": script, "lang": "painless"}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.do(ctx, http.MethodPost, "/_reindex?wait_for_completion=false", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var started struct {
+		Task string `json:"task"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&started)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	for {
+		var task struct {
+			Completed bool            `json:"completed"`
+			Error     json.RawMessage `json:"error"`
+			Response  struct {
+				Failures []json.RawMessage `json:"failures"`
+			} `json:"response"`
+		}
+
+		resp, err := m.do(ctx, http.MethodGet, "/_tasks/"+url.PathEscape(started.Task), nil)
+		if err != nil {
+			return err
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&task)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case len(task.Error) > 0:
+			return fmt.Errorf("task %s: %s", started.Task, task.Error)
+		case task.Completed && len(task.Response.Failures) > 0:
+			return fmt.Errorf("task %s: %d documents failed, first: %s", started.Task, len(task.Response.Failures), task.Response.Failures[0])
+		case task.Completed:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollPeriod):
+		}
+	}
+}
+
+// Returns the number of documents in the index.
+func (m *Migrator) count(ctx context.Context, index string) (int, error) {
+	resp, err := m.do(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_count", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Count int `json:"count"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result.Count, err
+}
+
+// Moves the alias named like the definition and its other aliases from the live index to the target one, atomically.
+// The live index is deleted in the same request if it is named like the alias.
+func (m *Migrator) moveAliases(ctx context.Context, definition indexdef.Definition, live indexdef.Definition, target string) error {
+	aliased, err := definition.Aliased()
+	if err != nil {
+		return err
+	}
+
+	var desired, current map[string]json.RawMessage
+
+	err = json.Unmarshal(aliased.Aliases, &desired)
+	if err != nil {
+		return err
+	}
+	if len(live.Aliases) > 0 {
+		err = json.Unmarshal(live.Aliases, &current)
+		if err != nil {
+			return err
+		}
+	}
+
+	var actions []map[string]any
+
+	if live.Name == definition.Name {
+		actions = append(actions, map[string]any{"remove_index": map[string]any{"index": live.Name}})
+	}
+
+	for _, alias := range sortedKeys(desired) {
+		if _, ok := current[alias]; ok && live.Name != definition.Name {
+			actions = append(actions, map[string]any{"remove": map[string]any{"index": live.Name, "alias": alias}})
+		}
+
+		add := map[string]any{}
+		err := json.Unmarshal(desired[alias], &add)
+		if err != nil {
+			return err
+		}
+		add["index"], add["alias"] = target, alias
+
+		actions = append(actions, map[string]any{"add": add})
+	}
+
+	body, err := json.Marshal(map[string]any{"actions": actions})
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.do(ctx, http.MethodPost, "/_aliases", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("moving the aliases to %s: %w", target, err)
+	}
+	return resp.Body.Close()
+}
+
+// Returns the keys of the map, sorted.
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Limiter is a fixed window rate limiter counting the requests of every client.
+//
+// A client can make a number of requests per window, the window starting with its first request.
+// The limit can be changed at any time, the windows already started are kept. Zero requests disable the limit.
+type Limiter struct {
+	mu       sync.Mutex
+	requests int
+	window   time.Duration
+	clients  map[string]*window
+	sweptAt  time.Time
+}
+
+type window struct {
+	start time.Time
+	n     int
+}
+
+// New() creates a rate limiter with the limit of the config.
+func New(cfg utils.RateLimit) *Limiter {
+	l := &Limiter{clients: make(map[string]*window)}
+	l.SetLimit(cfg)
+
+	return l
+}
+
+// SetLimit() replaces the limit, e.g. on reload.
+func (l *Limiter) SetLimit(cfg utils.RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.requests = cfg.Requests
+	l.window = cfg.Window
+}
+
+// Allow() reports whether the client can make a request at time now. If it can't, it returns how long the client
+// has to wait for its window to end.
+func (l *Limiter) Allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.requests <= 0 {
+		return true, 0
+	}
+
+	// Forget the clients of the past windows, so the map doesn't grow with every client ever seen.
+	if now.Sub(l.sweptAt) >= l.window {
+		for c, w := range l.clients {
+			if now.Sub(w.start) >= l.window {
+				delete(l.clients, c)
+			}
+		}
+		l.sweptAt = now
+	}
+
+	w, ok := l.clients[client]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &window{start: now}
+		l.clients[client] = w
+	}
+
+	if w.n >= l.requests {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+
+	w.n++
+	return true, 0
+}
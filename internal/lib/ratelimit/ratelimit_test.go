@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+
+	l := New(utils.RateLimit{Requests: 2, Window: time.Minute})
+
+	for i, want := range []bool{true, true, false} {
+		if ok, _ := l.Allow("a", now); ok != want {
+			t.Fatalf("request %d of a allowed = %v, want %v", i+1, ok, want)
+		}
+	}
+
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Errorf("b is limited by the requests of a")
+	}
+
+	ok, wait := l.Allow("a", now.Add(20*time.Second))
+	if ok || wait != 40*time.Second {
+		t.Errorf("Allow() = %v, %v, want the rest of the window to wait", ok, wait)
+	}
+
+	if ok, _ := l.Allow("a", now.Add(time.Minute)); !ok {
+		t.Errorf("a is limited in the next window")
+	}
+
+	// Raising the limit applies to the windows already started.
+	l.SetLimit(utils.RateLimit{Requests: 3, Window: time.Minute})
+
+	if ok, _ := l.Allow("b", now.Add(time.Second)); !ok {
+		t.Errorf("b is limited after the limit was raised")
+	}
+
+	l.SetLimit(utils.RateLimit{})
+
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.Allow("a", now.Add(time.Minute)); !ok {
+			t.Fatalf("a is limited with the limit disabled")
+		}
+	}
+}
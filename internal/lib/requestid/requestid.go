@@ -0,0 +1,46 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header that carries the request ID.
+const Header = "X-Request-ID"
+
+// Maximum length of a request ID accepted from a client.
+const maxLength = 128
+
+type ctxKey struct{}
+
+// New() generates a new random request ID.
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid() reports whether an ID received from a client can be used as is.
+//
+// Only non-empty IDs of printable ASCII characters up to 128 bytes are accepted, so they are safe to log and echo back.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// WithContext() returns a copy of ctx that carries the request ID.
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext() returns the request ID stored in ctx, or an empty string if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
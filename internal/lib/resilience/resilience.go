@@ -0,0 +1,204 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+var (
+	ErrCircuitOpen = fmt.Errorf("circuit breaker is open, the search engine is unavailable")
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// Open fails every call fast.
+	Open
+	// HalfOpen lets a single probing call through.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is a circuit breaker counting the consecutive failed calls.
+//
+// It opens after the failure threshold is reached and fails the calls fast until the open timeout passes.
+// Then it half-opens and lets a single call through: its success closes the breaker, its failure opens it again.
+type Breaker struct {
+	threshold     int
+	openTimeout   time.Duration
+	onStateChange func(from State, to State)
+	now           func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker() creates a closed circuit breaker.
+//
+// onStateChange, if not nil, is called on every state transition, e.g. to log it. It must not call the breaker.
+func NewBreaker(cfg utils.CircuitBreaker, onStateChange func(from State, to State)) *Breaker {
+	return &Breaker{
+		threshold:     cfg.FailureThreshold,
+		openTimeout:   cfg.OpenTimeout,
+		onStateChange: onStateChange,
+		now:           time.Now,
+	}
+}
+
+// Allow() reports whether a call can be made, returning ErrCircuitOpen otherwise.
+//
+// Every allowed call must be followed by exactly one of Success(), Failure() or Cancel().
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(HalfOpen)
+	}
+
+	switch b.state {
+	case Open:
+		return ErrCircuitOpen
+	case HalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success() records a successful call, closing the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures = 0
+
+	if b.state != Closed {
+		b.setState(Closed)
+	}
+}
+
+// Failure() records a failed call, opening the breaker if the threshold is reached or the probing call failed.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+		b.openedAt = b.now()
+		b.setState(Open)
+	}
+}
+
+// Cancel() records a call that tells nothing about the health of the callee, e.g. the one abandoned by the client.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State() returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Must be called with the mutex held.
+func (b *Breaker) setState(to State) {
+	from := b.state
+	b.state = to
+
+	if b.onStateChange != nil {
+		b.onStateChange(from, to)
+	}
+}
+
+// Backoff returns the delay before the given retry (starting from 1), using the exponential backoff with full jitter.
+//
+// The delay is picked at random between zero and the initial backoff doubled with every retry, capped by the max backoff.
+// The jitter keeps the clients that failed together from retrying together.
+func Backoff(cfg utils.Retry, retry int) time.Duration {
+	ceiling := cfg.MaxBackoff
+
+	if retry-1 < 62 {
+		if d := cfg.InitialBackoff << (retry - 1); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return rand.N(ceiling + 1)
+}
+
+// Sleep() waits for the duration or until the context is done, returning the context error in the latter case.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Retryable() reports whether the error is transient, so the call is worth retrying.
+//
+// The errors telling so themselves with a Retryable() method (e.g. the responses with the 429 or 503 status),
+// the refused and reset connections, and the connections closed halfway are transient. The context errors are not.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
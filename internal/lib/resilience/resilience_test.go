@@ -0,0 +1,183 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		action  string // "allow", "success", "failure", "cancel" or "wait"
+		err     error
+		state   State
+		advance time.Duration
+	}
+
+	tests := []struct {
+		name        string
+		steps       []step
+		transitions []State
+	}{
+		{
+			name: "opens at the threshold",
+			steps: []step{
+				{action: "allow"}, {action: "failure", state: Closed},
+				{action: "allow"}, {action: "success", state: Closed},
+				{action: "allow"}, {action: "failure", state: Closed},
+				{action: "allow"}, {action: "failure", state: Open},
+				{action: "allow", err: ErrCircuitOpen, state: Open},
+			},
+			transitions: []State{Open},
+		},
+		{
+			name: "probe closes",
+			steps: []step{
+				{action: "allow"}, {action: "failure"}, {action: "allow"}, {action: "failure", state: Open},
+				{action: "wait", advance: 9 * time.Second},
+				{action: "allow", err: ErrCircuitOpen, state: Open},
+				{action: "wait", advance: time.Second},
+				{action: "allow", state: HalfOpen},
+				{action: "allow", err: ErrCircuitOpen, state: HalfOpen},
+				{action: "success", state: Closed},
+				{action: "allow", state: Closed},
+			},
+			transitions: []State{Open, HalfOpen, Closed},
+		},
+		{
+			name: "probe fails",
+			steps: []step{
+				{action: "allow"}, {action: "failure"}, {action: "allow"}, {action: "failure", state: Open},
+				{action: "wait", advance: 10 * time.Second},
+				{action: "allow", state: HalfOpen},
+				{action: "failure", state: Open},
+				{action: "allow", err: ErrCircuitOpen, state: Open},
+			},
+			transitions: []State{Open, HalfOpen, Open},
+		},
+		{
+			name: "canceled probe lets another one through",
+			steps: []step{
+				{action: "allow"}, {action: "failure"}, {action: "allow"}, {action: "failure", state: Open},
+				{action: "wait", advance: 10 * time.Second},
+				{action: "allow", state: HalfOpen},
+				{action: "cancel", state: HalfOpen},
+				{action: "allow", state: HalfOpen},
+				{action: "success", state: Closed},
+			},
+			transitions: []State{Open, HalfOpen, Closed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			var transitions []State
+
+			b := NewBreaker(utils.CircuitBreaker{FailureThreshold: 2, OpenTimeout: 10 * time.Second}, func(_ State, to State) {
+				transitions = append(transitions, to)
+			})
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				switch s.action {
+				case "allow":
+					if err := b.Allow(); !errors.Is(err, s.err) {
+						t.Fatalf("step %d: Allow() = %v, want %v", i, err, s.err)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure()
+				case "cancel":
+					b.Cancel()
+				case "wait":
+					now = now.Add(s.advance)
+					continue
+				}
+
+				if got := b.State(); got != s.state {
+					t.Fatalf("step %d (%s): state = %s, want %s", i, s.action, got, s.state)
+				}
+			}
+
+			if fmt.Sprint(transitions) != fmt.Sprint(tt.transitions) {
+				t.Errorf("transitions = %v, want %v", transitions, tt.transitions)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := utils.Retry{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		retry   int
+		ceiling time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 100 {
+			if d := Backoff(cfg, tt.retry); d < 0 || d > tt.ceiling {
+				t.Fatalf("Backoff(%d) = %s, want within [0, %s]", tt.retry, d, tt.ceiling)
+			}
+		}
+	}
+
+	if d := Backoff(utils.Retry{}, 1); d != 0 {
+		t.Errorf("Backoff() without the backoff = %s, want 0", d)
+	}
+}
+
+type retryableError bool
+
+func (e retryableError) Error() string   { return "status" }
+func (e retryableError) Retryable() bool { return bool(e) }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("search: %w", context.DeadlineExceeded), false},
+		{"retryable status", fmt.Errorf("search: %w", retryableError(true)), true},
+		{"other status", retryableError(false), false},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"closed halfway", io.ErrUnexpectedEOF, true},
+		{"network timeout", timeoutError{}, true},
+		{"other", errors.New("bad request"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
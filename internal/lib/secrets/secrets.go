@@ -0,0 +1,210 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrInvalidKey       = fmt.Errorf("the key must be 32 hex encoded bytes")
+	ErrDecryptingSecret = fmt.Errorf("can't decrypt the secrets file")
+)
+
+// Provider interface defines the contract for the sources of secrets.
+//
+// Lookup returns the secret with the given name (e.g. "ES_PASSWORD"), and false if the provider doesn't have it.
+type Provider interface {
+	Lookup(name string) (string, bool, error)
+}
+
+// Env is the Provider that reads the secrets from the environment.
+//
+// For a secret NAME it first looks for NAME_FILE and reads the secret from the file it points to,
+// and then for NAME itself. The _FILE variant keeps the secret out of `docker run` command lines and process listings.
+type Env struct{}
+
+func (Env) Lookup(name string) (string, bool, error) {
+	if path, ok := os.LookupEnv(name + "_FILE"); ok && path != "" {
+		value, err := readFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return value, true, nil
+	}
+
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// File is the Provider that reads every secret from its own file in a directory.
+//
+// The secret NAME is read from Dir/NAME, which matches the layout of Docker and Kubernetes mounted secrets (e.g. /run/secrets).
+type File struct {
+	Dir string
+}
+
+func (p File) Lookup(name string) (string, bool, error) {
+	value, err := readFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// EncryptedFile is the Provider that reads the secrets from a local file encrypted with AES-256-GCM.
+//
+// The plaintext is a JSON object mapping the names to the secrets. The file holds the nonce followed by the ciphertext.
+type EncryptedFile struct {
+	secrets map[string]string
+}
+
+// NewEncryptedFile() decrypts the secrets file with the key from keyFile.
+//
+// The key file holds 32 hex encoded bytes, as written by GenerateKey().
+func NewEncryptedFile(path string, keyFile string) (*EncryptedFile, error) {
+	key, err := readKey(keyFile)
+	if err != nil {
+		return &EncryptedFile{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &EncryptedFile{}, err
+	}
+
+	secrets, err := Decrypt(key, data)
+	if err != nil {
+		return &EncryptedFile{}, err
+	}
+
+	return &EncryptedFile{secrets: secrets}, nil
+}
+
+func (p *EncryptedFile) Lookup(name string) (string, bool, error) {
+	value, ok := p.secrets[name]
+	return value, ok, nil
+}
+
+// Chain is the Provider that asks the providers in order and returns the first secret found.
+type Chain []Provider
+
+func (c Chain) Lookup(name string) (string, bool, error) {
+	for _, p := range c {
+		value, ok, err := p.Lookup(name)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return "", false, nil
+}
+
+// GenerateKey() returns a new random key in the format expected by NewEncryptedFile().
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// Encrypt() encrypts the secrets with the key into the format read by NewEncryptedFile().
+func Encrypt(key []byte, secrets map[string]string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt() decrypts the secrets encrypted with Encrypt().
+func Decrypt(key []byte, data []byte) (map[string]string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecryptingSecret
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryptingSecret
+	}
+
+	var secrets map[string]string
+
+	err = json.Unmarshal(plaintext, &secrets)
+	if err != nil {
+		return nil, ErrDecryptingSecret
+	}
+	return secrets, nil
+}
+
+// Reads the hex encoded key from the file.
+func readKey(path string) ([]byte, error) {
+	s, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(s)
+}
+
+// ParseKey() decodes the hex encoded key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Creates the AES-256-GCM cipher for the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Reads a secret from the file, dropping the trailing newline most editors and `echo` add.
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
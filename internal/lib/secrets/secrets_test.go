@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	hexKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(hexKey + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := map[string]string{"ES_PASSWORD": "changeme", "ADMIN_TOKEN": "token"}
+
+	data, err := Encrypt(key, secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decrypt(key, data)
+	if err != nil || !maps.Equal(got, secrets) {
+		t.Fatalf("Decrypt() = %v, %v, want %v", got, err, secrets)
+	}
+
+	other, _ := GenerateKey()
+	otherKey, _ := ParseKey(other)
+
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		key  []byte
+		data []byte
+		err  error
+	}{
+		{"wrong key", otherKey, data, ErrDecryptingSecret},
+		{"tampered", key, tampered, ErrDecryptingSecret},
+		{"truncated", key, data[:4], ErrDecryptingSecret},
+		{"short key", key[:16], data, ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(tt.key, tt.data); !errors.Is(err, tt.err) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, s := range []string{"", "zz", "abcd"} {
+		if _, err := ParseKey(s); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParseKey(%q) error = %v, want %v", s, err, ErrInvalidKey)
+		}
+	}
+}
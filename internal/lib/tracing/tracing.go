@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Name is the instrumentation name used by every tracer of the application.
+const Name = "github.com/xoticdsign/go-simplesearch"
+
+var (
+	ErrUnknownExporter = fmt.Errorf("unknown tracing exporter")
+)
+
+// Tracer() returns the application tracer from the global TracerProvider.
+//
+// Until New() is called the global provider is a no-op, so the spans cost nothing.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// New() sets up the global TracerProvider and the W3C TraceContext propagator.
+//
+// The exporter is chosen by cfg.Tracing.Exporter. With "none" (or an empty value) only the propagator is
+// installed, so incoming traceparent headers are still honoured. The returned function flushes and stops the provider.
+func New(cfg utils.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter, closer, err := newExporter(cfg.Tracing)
+	if err != nil {
+		return func(context.Context) error { return nil }, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+		),
+	)
+	if err != nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	ratio := cfg.Tracing.SampleRatio
+	if ratio < 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+// Creates the span exporter described by the config.
+//
+// The returned io.Closer is not nil only when the exporter owns a file that must be closed after the provider shuts down.
+func newExporter(cfg utils.Tracing) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.Exporter {
+	case "", "none":
+		return nil, nil, nil
+
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exp, nil, err
+
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exp, f, nil
+
+	case "otlp":
+		opts := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err := otlptracehttp.New(context.Background(), opts...)
+		return exp, nil, err
+
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownExporter, cfg.Exporter)
+	}
+}
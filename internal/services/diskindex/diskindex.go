@@ -0,0 +1,159 @@
+package diskindex
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/services/memory"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+const op = "service.DiskIndex."
+
+// Service struct represents the search engine backed by the embedded on-disk index.
+//
+// The ranking settings and their reload are handled by the embedded Rankings.
+type Service struct {
+	search.Rankings
+
+	Index *Index
+
+	log    *slog.Logger
+	config utils.Config
+}
+
+// New creates a new instance of the DiskIndex Service with the index in cfg.Backend.IndexDir.
+//
+// The index is rebuilt from the NDJSON migration file in cfg.Backend.File whenever it is missing,
+// was built from another version of the file or by another version of the app, or is corrupted.
+func New(log *slog.Logger, cfg utils.Config) (*Service, error) {
+	const fu = "New()"
+
+	source, err := checksum(cfg.Backend.File)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	index, err := Open(cfg.Backend.IndexDir, source)
+	if err != nil {
+		log.Info(
+			"rebuilding the index",
+			slog.String("op", op+fu),
+			slog.String("dir", cfg.Backend.IndexDir),
+			slog.String("reason", err.Error()),
+		)
+
+		products, err := memory.Load(cfg.Backend.File)
+		if err != nil {
+			return &Service{}, err
+		}
+
+		err = Build(cfg.Backend.IndexDir, source, products)
+		if err != nil {
+			return &Service{}, err
+		}
+
+		index, err = Open(cfg.Backend.IndexDir, source)
+		if err != nil {
+			return &Service{}, err
+		}
+	}
+
+	log.Info(
+		"index opened",
+		slog.String("op", op+fu),
+		slog.String("dir", cfg.Backend.IndexDir),
+		slog.Int("products", index.Len()),
+	)
+
+	s := &Service{
+		Index: index,
+
+		log:    log,
+		config: cfg,
+	}
+	s.Reload(cfg)
+
+	return s, nil
+}
+
+// MakeSearch searches the index with the same semantics as the Elasticsearch query.
+//
+// The search text is matched against the fields with a positive boost, the products out of stock, outside of the
+// price range or, if the category filter is set, of another category are filtered out. The 10 best ones are returned.
+func (s *Service) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error) {
+	const fu = "MakeSearch()"
+
+	_, span := tracing.Tracer().Start(ctx, "diskindex.search")
+	defer span.End()
+
+	log := logger.FromContext(ctx, s.log)
+	ranking := s.Ranking()
+
+	hits, err := s.Index.Search(Query{
+		Text: req.SearchFor,
+		Boosts: map[string]float64{
+			FieldName:        ranking.NameBoost,
+			FieldDescription: ranking.DescriptionBoost,
+			FieldCategory:    ranking.CategoryBoost,
+		},
+		Price:    Range{Min: &req.Filters.PriceBottom, Max: &req.Filters.PriceTop},
+		InStock:  true,
+		Category: req.Filters.Category,
+		Size:     search.Size,
+	})
+	if err != nil {
+		log.Error(
+			"can't search the index",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return []search.Product{}, err
+	}
+
+	span.SetAttributes(attribute.Int("diskindex.hits", len(hits)))
+
+	if len(hits) == 0 {
+		return []search.Product{}, search.ErrNoHits
+	}
+
+	products := make([]search.Product, 0, len(hits))
+	for _, h := range hits {
+		products = append(products, h.Product)
+	}
+
+	return products, nil
+}
+
+// Returns the hex encoded SHA-256 checksum of the file.
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,138 @@
+package diskindex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/services/memory"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// The products of the migration, searched by the recorded Elasticsearch fixtures.
+const productsFile = "../../../migrations/elasticsearch/0002_products.ndjson"
+
+func newTestService(t *testing.T, cfg utils.Config) *Service {
+	t.Helper()
+
+	s, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Index.Close() })
+
+	return s
+}
+
+func TestNewRebuildsOnChange(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := utils.Config{
+		Backend: utils.Backend{File: filepath.Join(dir, "products.ndjson"), IndexDir: filepath.Join(dir, "index")},
+		Ranking: utils.Ranking{NameBoost: 1},
+	}
+	req := ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}}
+
+	for _, name := range []string{"Apple MacBook Air", "Apple iPhone"} {
+		write(t, cfg.Backend.File, []byte(`{"index": {"_id": "1"}}`+"\n"+`{"name": "`+name+`", "stock": 1}`+"\n"))
+
+		products, err := newTestService(t, cfg).MakeSearch(context.Background(), req)
+		if err != nil || len(products) != 1 || products[0].Name != name {
+			t.Fatalf("MakeSearch() = %v, %v, want %s from the rebuilt index", products, err, name)
+		}
+	}
+}
+
+// The searches of the Elasticsearch service tests must find the products of its recorded responses,
+// and the same ones as the in-memory backend.
+func TestMakeSearchParity(t *testing.T) {
+	cfg := utils.Config{
+		Backend: utils.Backend{File: productsFile, IndexDir: t.TempDir()},
+		Ranking: utils.Ranking{NameBoost: 3, DescriptionBoost: 1},
+	}
+
+	s := newTestService(t, cfg)
+
+	m, err := memory.New(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  ssv1.MakeSearchRequest
+	}{
+		{"text", ssv1.MakeSearchRequest{SearchFor: "apple macbook", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}}},
+		{"price range", ssv1.MakeSearchRequest{SearchFor: "apple macbook", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 500}}},
+		{"category", ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000, Category: "laptop"}}},
+		{"no hits", ssv1.MakeSearchRequest{SearchFor: "typewriter", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := recordedNames(t, tt.name)
+
+			for backend, searcher := range map[string]interface {
+				MakeSearch(context.Context, ssv1.MakeSearchRequest) ([]search.Product, error)
+			}{"disk": s, "memory": m} {
+				products, err := searcher.MakeSearch(context.Background(), tt.req)
+				if err != nil && !(errors.Is(err, search.ErrNoHits) && len(want) == 0) {
+					t.Fatalf("%s MakeSearch() error = %v", backend, err)
+				}
+
+				var names []string
+				for _, p := range products {
+					names = append(names, p.Name)
+				}
+
+				if !slices.Equal(names, want) {
+					t.Errorf("%s MakeSearch() = %q, Elasticsearch found %q", backend, names, want)
+				}
+			}
+		})
+	}
+}
+
+// Returns the names of the products found by Elasticsearch in the recorded fixture of its TestMakeSearch subtest.
+func recordedNames(t *testing.T, name string) []string {
+	t.Helper()
+
+	path := filepath.Join("..", "elasticsearch", "testdata", "fixtures", "TestMakeSearch", strings.ReplaceAll(name, " ", "_")+".json")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interactions []struct {
+		Response struct {
+			Body struct {
+				Hits struct {
+					Hits []struct {
+						Source search.Product `json:"_source"`
+					} `json:"hits"`
+				} `json:"hits"`
+			} `json:"body"`
+		} `json:"response"`
+	}
+
+	err = json.Unmarshal(data, &interactions)
+	if err != nil || len(interactions) == 0 {
+		t.Fatalf("%s: %v, want the recorded search", path, err)
+	}
+
+	var names []string
+	for _, h := range interactions[len(interactions)-1].Response.Body.Hits.Hits {
+		names = append(names, h.Source.Name)
+	}
+	return names
+}
@@ -0,0 +1,472 @@
+package diskindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/analyzer"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+)
+
+// Version of the index format. The indexes of other versions are rebuilt.
+const formatVersion = 1
+
+// Names of the index files in the index directory.
+const (
+	metaFile = "index.meta"
+	dataFile = "index.data"
+)
+
+// Parameters of the BM25 scoring, the same as the Elasticsearch defaults.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Names of the indexed fields.
+const (
+	FieldName        = "name"
+	FieldDescription = "description"
+	FieldCategory    = "category"
+)
+
+var (
+	ErrFormatMismatch = fmt.Errorf("index format mismatch")
+	ErrCorruptedIndex = fmt.Errorf("corrupted index")
+)
+
+// Index struct represents an inverted index opened from the disk.
+//
+// The term dictionaries, the field lengths and the numeric columns used for filtering are held in memory,
+// while the postings and the stored products are read from the data file on demand. The index is immutable,
+// so it is safe for concurrent use.
+type Index struct {
+	meta meta
+	data *os.File
+}
+
+// Metadata of the index, stored in the meta file.
+type meta struct {
+	Version  int
+	Source   string
+	DataSize int64
+	Fields   map[string]*field
+	Price    []float64
+	Stock    []int
+	Category []string
+	Stored   []extent
+}
+
+// Term dictionary and statistics of an indexed field.
+type field struct {
+	Terms     map[string]postings
+	Lengths   []uint32
+	AvgLength float64
+}
+
+// Location of the postings of a term in the data file, with its document frequency.
+type postings struct {
+	Extent extent
+	DF     int
+}
+
+// Location of a byte range in the data file.
+type extent struct {
+	Offset int64
+	Length int64
+}
+
+// Range struct represents an inclusive numeric range. Nil bounds are open.
+type Range struct {
+	Min *float64
+	Max *float64
+}
+
+// Contains() reports whether the value is within the range.
+func (r Range) Contains(v float64) bool {
+	return (r.Min == nil || v >= *r.Min) && (r.Max == nil || v <= *r.Max)
+}
+
+// Query struct represents a search in the index.
+//
+// The text is matched against the fields with their boosts. A product scores the best of its fields (like the
+// "best_fields" multi_match of Elasticsearch), each field scoring BM25. The category is a keyword field, matched
+// only by the whole text. Price and Stock filter out the products outside of the ranges. InStock, apart from them,
+// filters out the products with a zero stock, as the must_not clause of the Elasticsearch query does, so a negative
+// stock isn't filtered out. The filters don't affect the scores.
+type Query struct {
+	Text     string
+	Boosts   map[string]float64
+	Price    Range
+	Stock    Range
+	InStock  bool
+	Category string
+	Size     int
+}
+
+// Hit struct represents a found product with its score.
+type Hit struct {
+	Product search.Product
+	Score   float64
+}
+
+// Build() builds the index of the products in the directory, replacing the existing one.
+//
+// The source identifies the products (e.g. the checksum of the file they were loaded from), so Open() can tell
+// whether the index is up to date. The files are written aside and renamed into place, the meta file last.
+func Build(dir string, source string, products []search.Product) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.CreateTemp(dir, dataFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(data.Name())
+	defer data.Close()
+
+	bw := bufio.NewWriter(data)
+	w := &countingWriter{w: bw}
+
+	m := meta{
+		Version: formatVersion,
+		Source:  source,
+		Fields: map[string]*field{
+			FieldName:        {Terms: map[string]postings{}},
+			FieldDescription: {Terms: map[string]postings{}},
+			FieldCategory:    {Terms: map[string]postings{}},
+		},
+	}
+
+	// Postings per field and term, in the order of the documents.
+	inverted := map[string]map[string][]posting{
+		FieldName:        {},
+		FieldDescription: {},
+		FieldCategory:    {},
+	}
+
+	for doc, p := range products {
+		values := map[string][]string{
+			FieldName:        analyzer.Terms(p.Name),
+			FieldDescription: analyzer.Terms(p.Description),
+			FieldCategory:    {p.Category},
+		}
+		if p.Category == "" {
+			values[FieldCategory] = nil
+		}
+
+		for name, terms := range values {
+			f := m.Fields[name]
+			f.Lengths = append(f.Lengths, uint32(len(terms)))
+			f.AvgLength += float64(len(terms))
+
+			tf := map[string]int{}
+			for _, t := range terms {
+				tf[t]++
+			}
+			for t, n := range tf {
+				inverted[name][t] = append(inverted[name][t], posting{doc: doc, tf: n})
+			}
+		}
+
+		m.Price = append(m.Price, p.Price)
+		m.Stock = append(m.Stock, p.Stock)
+		m.Category = append(m.Category, p.Category)
+
+		stored, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+
+		m.Stored = append(m.Stored, extent{Offset: w.n, Length: int64(len(stored))})
+
+		_, err = w.Write(stored)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, terms := range inverted {
+		f := m.Fields[name]
+		if len(products) > 0 {
+			f.AvgLength /= float64(len(products))
+		}
+
+		for t, list := range terms {
+			start := w.n
+			prev := 0
+			buf := make([]byte, binary.MaxVarintLen64)
+
+			for _, p := range list {
+				for _, v := range []int{p.doc - prev, p.tf} {
+					_, err = w.Write(buf[:binary.PutUvarint(buf, uint64(v))])
+					if err != nil {
+						return err
+					}
+				}
+				prev = p.doc
+			}
+
+			f.Terms[t] = postings{
+				Extent: extent{Offset: start, Length: w.n - start},
+				DF:     len(list),
+			}
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+	m.DataSize = w.n
+
+	metaTmp, err := os.CreateTemp(dir, metaFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(metaTmp.Name())
+	defer metaTmp.Close()
+
+	err = gob.NewEncoder(metaTmp).Encode(m)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []*os.File{data, metaTmp} {
+		err = f.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(data.Name(), filepath.Join(dir, dataFile))
+	if err != nil {
+		return err
+	}
+	return os.Rename(metaTmp.Name(), filepath.Join(dir, metaFile))
+}
+
+// Open() opens the index in the directory, if it was built from the given source.
+//
+// It returns ErrFormatMismatch if the index was built by another version or from another source,
+// and ErrCorruptedIndex if the files don't match each other.
+func Open(dir string, source string) (*Index, error) {
+	f, err := os.Open(filepath.Join(dir, metaFile))
+	if err != nil {
+		return &Index{}, err
+	}
+	defer f.Close()
+
+	var m meta
+
+	err = gob.NewDecoder(f).Decode(&m)
+	if err != nil {
+		return &Index{}, fmt.Errorf("%w: %v", ErrCorruptedIndex, err)
+	}
+	if m.Version != formatVersion || m.Source != source {
+		return &Index{}, ErrFormatMismatch
+	}
+
+	data, err := os.Open(filepath.Join(dir, dataFile))
+	if err != nil {
+		return &Index{}, err
+	}
+
+	info, err := data.Stat()
+	if err != nil {
+		data.Close()
+		return &Index{}, err
+	}
+	if info.Size() != m.DataSize {
+		data.Close()
+		return &Index{}, fmt.Errorf("%w: data file size %d, expected %d", ErrCorruptedIndex, info.Size(), m.DataSize)
+	}
+
+	return &Index{meta: m, data: data}, nil
+}
+
+// Close() closes the data file of the index.
+func (ix *Index) Close() error {
+	return ix.data.Close()
+}
+
+// Len() returns the number of the indexed products.
+func (ix *Index) Len() int {
+	return len(ix.meta.Stored)
+}
+
+// Search() returns the best matching products for the query, ordered by their scores.
+//
+// The ties are broken by the order in which the products were indexed.
+func (ix *Index) Search(q Query) ([]Hit, error) {
+	scores := map[int]float64{}
+	terms := slices.Compact(sortedCopy(analyzer.Terms(q.Text)))
+
+	for name, boost := range q.Boosts {
+		f, ok := ix.meta.Fields[name]
+		if !ok || boost <= 0 {
+			continue
+		}
+
+		fieldTerms := terms
+		if name == FieldCategory {
+			fieldTerms = []string{q.Text}
+		}
+
+		fieldScores := map[int]float64{}
+
+		for _, t := range fieldTerms {
+			p, ok := f.Terms[t]
+			if !ok {
+				continue
+			}
+
+			list, err := ix.readPostings(p.Extent)
+			if err != nil {
+				return []Hit{}, err
+			}
+
+			idf := math.Log(1 + (float64(ix.Len())-float64(p.DF)+0.5)/(float64(p.DF)+0.5))
+
+			for _, post := range list {
+				tf := float64(post.tf)
+				norm := 1 - b + b*float64(f.Lengths[post.doc])/f.AvgLength
+
+				fieldScores[post.doc] += idf * tf * (k1 + 1) / (tf + k1*norm)
+			}
+		}
+
+		for doc, score := range fieldScores {
+			scores[doc] = max(scores[doc], score*boost)
+		}
+	}
+
+	var docs []int
+
+	for doc := range scores {
+		if !q.Price.Contains(ix.meta.Price[doc]) || !q.Stock.Contains(float64(ix.meta.Stock[doc])) {
+			continue
+		}
+		if q.InStock && ix.meta.Stock[doc] == 0 {
+			continue
+		}
+		if q.Category != "" && ix.meta.Category[doc] != q.Category {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		if scores[docs[i]] != scores[docs[j]] {
+			return scores[docs[i]] > scores[docs[j]]
+		}
+		return docs[i] < docs[j]
+	})
+
+	if q.Size > 0 && len(docs) > q.Size {
+		docs = docs[:q.Size]
+	}
+
+	hits := []Hit{}
+
+	for _, doc := range docs {
+		p, err := ix.readProduct(doc)
+		if err != nil {
+			return []Hit{}, err
+		}
+
+		hits = append(hits, Hit{Product: p, Score: scores[doc]})
+	}
+
+	return hits, nil
+}
+
+// Occurrence of a term in a document.
+type posting struct {
+	doc int
+	tf  int
+}
+
+// Reads the postings list at the extent of the data file.
+func (ix *Index) readPostings(e extent) ([]posting, error) {
+	buf := make([]byte, e.Length)
+
+	_, err := ix.data.ReadAt(buf, e.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		list []posting
+		doc  int
+	)
+
+	for len(buf) > 0 {
+		var values [2]uint64
+
+		for i := range values {
+			v, n := binary.Uvarint(buf)
+			if n <= 0 {
+				return nil, ErrCorruptedIndex
+			}
+			values[i] = v
+			buf = buf[n:]
+		}
+
+		doc += int(values[0])
+		list = append(list, posting{doc: doc, tf: int(values[1])})
+	}
+
+	return list, nil
+}
+
+// Reads the stored product of the document from the data file.
+func (ix *Index) readProduct(doc int) (search.Product, error) {
+	e := ix.meta.Stored[doc]
+	buf := make([]byte, e.Length)
+
+	_, err := ix.data.ReadAt(buf, e.Offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return search.Product{}, err
+	}
+
+	var p search.Product
+
+	err = json.Unmarshal(buf, &p)
+	if err != nil {
+		return search.Product{}, fmt.Errorf("%w: %v", ErrCorruptedIndex, err)
+	}
+
+	return p, nil
+}
+
+// Returns a sorted copy of the strings.
+func sortedCopy(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
+
+// Writer that counts the bytes written, to know the offsets in the data file.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,264 @@
+package diskindex
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+)
+
+var testProducts = []search.Product{
+	{Name: "Apple MacBook Air", Description: "Thin and light laptop", Price: 1200, Stock: 5, Category: "laptop"},
+	{Name: "Apple iPhone", Description: "Smartphone with a great camera", Price: 900, Stock: 10, Category: "smartphone"},
+	{Name: "Apple Watch", Description: "Smartwatch for the Apple iPhone", Price: 400, Stock: 0, Category: "watch"},
+	{Name: "Lenovo ThinkPad", Description: "Business laptop", Price: 1500, Stock: -1, Category: "laptop"},
+	{Name: "Apple Apple Apple Box", Description: "", Price: 10, Stock: 1},
+}
+
+// Builds the index of the products in a temporary directory and opens it.
+func buildTestIndex(t *testing.T, products []search.Product) (*Index, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	err := Build(dir, "source", products)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := Open(dir, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ix.Close() })
+
+	return ix, dir
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+func TestSearch(t *testing.T) {
+	ix, _ := buildTestIndex(t, testProducts)
+
+	if ix.Len() != len(testProducts) {
+		t.Fatalf("Len() = %d, want %d", ix.Len(), len(testProducts))
+	}
+
+	name := map[string]float64{FieldName: 1}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{
+			name:  "term frequency and length",
+			query: Query{Text: "apple", Boosts: name},
+			want:  []string{"Apple Apple Apple Box", "Apple iPhone", "Apple Watch", "Apple MacBook Air"},
+		},
+		{
+			name:  "rarer term first",
+			query: Query{Text: "apple thinkpad", Boosts: name},
+			want:  []string{"Lenovo ThinkPad", "Apple Apple Apple Box", "Apple iPhone", "Apple Watch", "Apple MacBook Air"},
+		},
+		{
+			name:  "best field",
+			query: Query{Text: "iphone", Boosts: map[string]float64{FieldName: 1, FieldDescription: 1}},
+			want:  []string{"Apple iPhone", "Apple Watch"},
+		},
+		{
+			name:  "zero boost",
+			query: Query{Text: "laptop", Boosts: map[string]float64{FieldName: 1, FieldDescription: 0}},
+		},
+		{
+			name:  "category keyword",
+			query: Query{Text: "laptop", Boosts: map[string]float64{FieldCategory: 1}},
+			want:  []string{"Apple MacBook Air", "Lenovo ThinkPad"},
+		},
+		{
+			name:  "price range",
+			query: Query{Text: "apple", Boosts: name, Price: Range{Min: ptr(400), Max: ptr(900)}},
+			want:  []string{"Apple iPhone", "Apple Watch"},
+		},
+		{
+			name:  "stock range",
+			query: Query{Text: "apple lenovo", Boosts: name, Stock: Range{Min: ptr(0), Max: ptr(5)}},
+			want:  []string{"Apple Apple Apple Box", "Apple Watch", "Apple MacBook Air"},
+		},
+		{
+			name:  "stock range in stock",
+			query: Query{Text: "apple lenovo", Boosts: name, Stock: Range{Max: ptr(5)}, InStock: true},
+			want:  []string{"Lenovo ThinkPad", "Apple Apple Apple Box", "Apple MacBook Air"},
+		},
+		{
+			name:  "in stock",
+			query: Query{Text: "apple lenovo", Boosts: name, InStock: true},
+			want:  []string{"Lenovo ThinkPad", "Apple Apple Apple Box", "Apple iPhone", "Apple MacBook Air"},
+		},
+		{
+			name:  "category filter",
+			query: Query{Text: "apple", Boosts: name, Category: "smartphone"},
+			want:  []string{"Apple iPhone"},
+		},
+		{
+			name:  "size",
+			query: Query{Text: "apple", Boosts: name, Size: 2},
+			want:  []string{"Apple Apple Apple Box", "Apple iPhone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := ix.Search(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, h := range hits {
+				names = append(names, h.Product.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Search() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchStoresProducts(t *testing.T) {
+	ix, _ := buildTestIndex(t, testProducts)
+
+	hits, err := ix.Search(Query{Text: "thinkpad", Boosts: map[string]float64{FieldName: 1}})
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("Search() = %v, %v, want the ThinkPad", hits, err)
+	}
+	if hits[0].Product != testProducts[3] {
+		t.Errorf("Search() = %+v, want %+v", hits[0].Product, testProducts[3])
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		corrupt func(t *testing.T, dir string)
+		wantErr error
+	}{
+		{
+			name:    "other source",
+			source:  "other",
+			wantErr: ErrFormatMismatch,
+		},
+		{
+			name:   "no index",
+			source: "source",
+			corrupt: func(t *testing.T, dir string) {
+				remove(t, filepath.Join(dir, metaFile))
+			},
+			wantErr: fs.ErrNotExist,
+		},
+		{
+			name:   "malformed meta",
+			source: "source",
+			corrupt: func(t *testing.T, dir string) {
+				write(t, filepath.Join(dir, metaFile), []byte("not gob"))
+			},
+			wantErr: ErrCorruptedIndex,
+		},
+		{
+			name:   "truncated data",
+			source: "source",
+			corrupt: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, dataFile)
+				write(t, path, read(t, path)[:10])
+			},
+			wantErr: ErrCorruptedIndex,
+		},
+		{
+			name:   "no data",
+			source: "source",
+			corrupt: func(t *testing.T, dir string) {
+				remove(t, filepath.Join(dir, dataFile))
+			},
+			wantErr: fs.ErrNotExist,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			err := Build(dir, "source", testProducts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.corrupt != nil {
+				tt.corrupt(t, dir)
+			}
+
+			_, err = Open(dir, tt.source)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The size of the data file is checked by Open(), its content only when it is read.
+func TestSearchCorruptedData(t *testing.T) {
+	_, dir := buildTestIndex(t, testProducts)
+
+	path := filepath.Join(dir, dataFile)
+
+	garbage := read(t, path)
+	for i := range garbage {
+		garbage[i] = 0xff
+	}
+	write(t, path, garbage)
+
+	ix, err := Open(dir, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+
+	_, err = ix.Search(Query{Text: "apple", Boosts: map[string]float64{FieldName: 1}})
+	if !errors.Is(err, ErrCorruptedIndex) {
+		t.Fatalf("Search() error = %v, want %v", err, ErrCorruptedIndex)
+	}
+}
+
+func read(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func write(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, data, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func remove(t *testing.T, path string) {
+	t.Helper()
+
+	err := os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package elasticsearch
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Minimal interval between two node discoveries triggered by failures.
+const discoveryCooldown = time.Second * 30
+
+// NodePool interface is implemented by the clients balancing the requests between the nodes of a cluster:
+// the Elasticsearch client and the transport underneath it.
+type NodePool interface {
+	DiscoverNodes() error
+	Metrics() (elastictransport.Metrics, error)
+}
+
+// Cluster struct holds what the services of the Elasticsearch and OpenSearch clusters share: the ranking settings,
+// the health of the nodes and their discovery after the failed requests. It is embedded in the services and logs
+// with the op of the service.
+type Cluster struct {
+	Rankings
+
+	pool          NodePool
+	log           *slog.Logger
+	op            string
+	onFailure     bool
+	lastDiscovery atomic.Int64
+}
+
+// NewCluster() creates the Cluster of the nodes in the pool, with the ranking and the discovery settings of cfg.
+func NewCluster(log *slog.Logger, op string, cfg utils.Config, pool NodePool) *Cluster {
+	c := &Cluster{
+		pool:      pool,
+		log:       log,
+		op:        op,
+		onFailure: cfg.ElasticSearch.Discovery.OnFailure,
+	}
+	c.Reload(cfg)
+
+	return c
+}
+
+// Health returns the state of every known node.
+//
+// The state is the one observed by the client on the previous requests, no requests are made to the nodes.
+func (c *Cluster) Health() []NodeHealth {
+	const fu = "Health()"
+
+	metrics, err := c.pool.Metrics()
+	if err != nil {
+		c.log.Error(
+			"can't get the client metrics",
+			slog.String("op", c.op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		return []NodeHealth{}
+	}
+
+	return NodesHealth(metrics)
+}
+
+// DiscoverOnFailure discovers the nodes of the cluster in the background after a failed request, if enabled.
+//
+// The discoveries are at least discoveryCooldown apart, so a failing cluster is not flooded with them.
+func (c *Cluster) DiscoverOnFailure() {
+	const fu = "DiscoverOnFailure()"
+
+	if !c.onFailure {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := c.lastDiscovery.Load()
+
+	if now-last < int64(discoveryCooldown) || !c.lastDiscovery.CompareAndSwap(last, now) {
+		return
+	}
+
+	go func() {
+		err := c.pool.DiscoverNodes()
+		if err != nil {
+			c.log.Warn(
+				"node discovery failed",
+				slog.String("op", c.op+fu),
+				slog.String("error", err.Error()),
+			)
+
+			return
+		}
+
+		c.log.Info(
+			"nodes discovered",
+			slog.String("op", c.op+fu),
+		)
+	}()
+}
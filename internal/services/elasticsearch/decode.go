@@ -0,0 +1,94 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+// ProductHits() takes an interface{} (typically the decoded Elasticsearch response),
+// extracts the 'hits' from the response, and unmarshals them into a slice of Product structs.
+// It returns a slice of Product structs and an error, or an empty slice and a specific error
+// if the conversion or unmarshaling process fails.
+//
+// The function expects the input to be in a format that contains a 'hits' field in the response,
+// which is a common structure in Elasticsearch and OpenSearch search results. Each hit is a product document
+// that is converted to a Product struct. If the structure doesn't match, or there are issues
+// with marshaling or unmarshaling, an appropriate error is returned.
+func ProductHits(v any) ([]Product, error) {
+	response, ok := v.(map[string]interface{})
+	if !ok {
+		return []Product{}, ErrInterfaceConversion
+	}
+
+	// Every level is checked, a malformed response (e.g. from a proxy) must not panic.
+	outer, ok := response["hits"].(map[string]interface{})
+	if !ok {
+		return []Product{}, ErrInterfaceConversion
+	}
+	hits, ok := outer["hits"].([]interface{})
+	if !ok {
+		return []Product{}, ErrInterfaceConversion
+	}
+	var products []Product
+
+	for _, hit := range hits {
+		doc, ok := hit.(map[string]interface{})
+		if !ok {
+			return []Product{}, ErrInterfaceConversion
+		}
+		source, ok := doc["_source"].(map[string]interface{})
+		if !ok {
+			return []Product{}, ErrInterfaceConversion
+		}
+		productJSON, err := json.Marshal(source)
+		if err != nil {
+			return []Product{}, ErrMarshalingJSON
+		}
+
+		var product Product
+
+		err = json.Unmarshal(productJSON, &product)
+		if err != nil {
+			return []Product{}, ErrUnmarshalingJSON
+		}
+
+		products = append(products, product)
+	}
+
+	return products, nil
+}
+
+// Took() returns the time the search took, in milliseconds, from the decoded response.
+func Took(v any) (int64, bool) {
+	response, ok := v.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	took, ok := response["took"].(float64)
+	return int64(took), ok
+}
+
+// NodesHealth() returns the state of every node from the metrics of the transport.
+//
+// It is shared by the clients built on elastictransport, i.e. the Elasticsearch and the OpenSearch ones.
+func NodesHealth(metrics elastictransport.Metrics) []NodeHealth {
+	nodes := []NodeHealth{}
+
+	for _, c := range metrics.Connections {
+		cm, ok := c.(elastictransport.ConnectionMetric)
+		if !ok {
+			continue
+		}
+
+		nodes = append(nodes, NodeHealth{
+			URL:       cm.URL,
+			Alive:     !cm.IsDead,
+			Failures:  cm.Failures,
+			DeadSince: cm.DeadSince,
+		})
+	}
+
+	return nodes
+}
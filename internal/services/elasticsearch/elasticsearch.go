@@ -1,17 +1,23 @@
 package elasticsearch
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/esconn"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
 	"github.com/xoticdsign/go-simplesearch/internal/utils"
 )
 
@@ -26,8 +32,25 @@ var (
 	ErrInterfaceConversion = fmt.Errorf("interface conversion error")
 )
 
-// Constant representing the ElasticSearch Products index name.
-const iProducts = "products"
+// StatusError is returned when ElasticSearch responds with an error status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("elasticsearch responded with status %d", e.StatusCode)
+}
+
+// Retryable reports whether the status is transient: 429 Too Many Requests, 502 Bad Gateway, 503 Service Unavailable
+// or 504 Gateway Timeout.
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
 
 // Product struct represents a product with its properties that will be unmarshaled from Elasticsearch.
 type Product struct {
@@ -40,196 +63,234 @@ type Product struct {
 }
 
 var (
-	pName        = "name^3"
-	pDescription = "description^2"
+	pName        = "name"
+	pDescription = "description"
 	pPrice       = "price"
-	pCategory    = "category^2"
+	pCategory    = "category"
 	pStock       = "stock"
 	pCreatedAt   = "created_at"
 )
 
 // Service struct represents the Elasticsearch service with the necessary client and configurations.
+//
+// The products are searched through the alias named in the definition in cfg.ElasticSearch.Index, the file the esmigrator
+// creates the index from, so a reindex to a new version of the index doesn't interrupt the searches.
+// The ranking, the health of the nodes and their discovery are handled by the embedded Cluster, shared with OpenSearch.
 type Service struct {
 	ESClient *elasticsearch.Client
+	*Cluster
 
 	log    *slog.Logger
 	config utils.Config
+	index  string
+}
+
+// NodeHealth struct represents the state of a single ElasticSearch node as seen by the client.
+type NodeHealth struct {
+	URL       string     `json:"url"`
+	Alive     bool       `json:"alive"`
+	Failures  int        `json:"failures,omitempty"`
+	DeadSince *time.Time `json:"dead_since,omitempty"`
 }
 
 // New creates a new instance of the ElasticSearch Service with the given logger and configuration.
 //
-// It initializes the ElasticSearch client with TLS and authentication settings.
+// It initializes the ElasticSearch client with TLS and authentication settings: username and password,
+// API key or service token, a custom CA bundle, a pinned certificate fingerprint, and a client certificate for mTLS.
+//
+// The requests are balanced between the nodes in round-robin. A node that fails to respond is marked dead and skipped,
+// and it is resurrected after a timeout that grows with its consecutive failures. The nodes can also be discovered
+// from the cluster on start, periodically, and after failures, as configured.
+// The retries of the client are disabled, as the searches are retried with a backoff by the SimpleSearch service.
 func New(log *slog.Logger, cfg utils.Config) (*Service, error) {
+	transport, err := esconn.Transport(cfg.ElasticSearch)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	return NewWithTransport(log, cfg, transport)
+}
+
+// NewWithTransport creates a new instance of the ElasticSearch Service that makes the requests through the given transport,
+// e.g. the one recording or replaying the interactions in tests. The TLS settings of cfg are not applied to it.
+func NewWithTransport(log *slog.Logger, cfg utils.Config, transport http.RoundTripper) (*Service, error) {
+	definition, err := indexdef.Load(cfg.ElasticSearch.Index)
+	if err != nil {
+		return &Service{}, err
+	}
+
 	es, err := elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: []string{cfg.ElasticSearch.Address},
-		Username:  cfg.ElasticSearch.Username,
-		Password:  cfg.ElasticSearch.Password,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: cfg.ElasticSearch.Transport.TLS.Insecure,
-			},
-			TLSHandshakeTimeout: cfg.ElasticSearch.Transport.TLSTimeout,
-			IdleConnTimeout:     cfg.ElasticSearch.Transport.IdleTimeout,
-		},
+		Addresses:             cfg.ElasticSearch.Nodes(),
+		Username:              cfg.ElasticSearch.Username,
+		Password:              cfg.ElasticSearch.Password,
+		APIKey:                cfg.ElasticSearch.APIKey,
+		ServiceToken:          cfg.ElasticSearch.ServiceToken,
+		Transport:             transport,
+		DiscoverNodesOnStart:  cfg.ElasticSearch.Discovery.OnStart,
+		DiscoverNodesInterval: cfg.ElasticSearch.Discovery.Interval,
+		EnableMetrics:         true,
+		DisableRetry:          true,
 	})
 	if err != nil {
 		return &Service{}, err
 	}
+
 	return &Service{
 		ESClient: es,
+		Cluster:  NewCluster(log, op, cfg, es),
 
 		log:    log,
 		config: cfg,
+		index:  definition.Name,
 	}, nil
 }
 
-// Takes an interface{} (typically the decoded Elasticsearch response),
-// extracts the 'hits' from the response, and unmarshals them into a slice of Product structs.
-// It returns a slice of Product structs and an error, or an empty slice and a specific error
-// if the conversion or unmarshaling process fails.
-//
-// The function expects the input to be in a format that contains a 'hits' field in the response,
-// which is a common structure in Elasticsearch search results. Each hit is a product document
-// that is converted to a Product struct. If the structure doesn't match, or there are issues
-// with marshaling or unmarshaling, an appropriate error is returned.
-func (s *Service) productHitsExtractor(v any) ([]Product, error) {
+// Extracts the products from the decoded search response, logging the failures.
+func (s *Service) productHitsExtractor(ctx context.Context, v any) ([]Product, error) {
 	const fu = "producHitsEctractor()"
 
-	hits, ok := v.(map[string]interface{})["hits"].(map[string]interface{})["hits"].([]interface{})
-	if !ok {
-		s.log.Error(
-			"hits conversion error",
+	products, err := ProductHits(v)
+	if err != nil {
+		logger.FromContext(ctx, s.log).Error(
+			"can't extract the hits",
 			slog.String("op", op+fu),
-			slog.String("error", ErrInterfaceConversion.Error()),
+			slog.String("error", err.Error()),
 		)
 
-		return []Product{}, ErrInterfaceConversion
-	}
-	var products []Product
-
-	for _, hit := range hits {
-		source, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})
-		if !ok {
-			s.log.Error(
-				"hit conversion error",
-				slog.String("op", op+fu),
-				slog.String("error", ErrInterfaceConversion.Error()),
-			)
-
-			return []Product{}, ErrInterfaceConversion
-		}
-		productJSON, err := json.Marshal(source)
-		if err != nil {
-			s.log.Error(
-				"can't marshal a hit",
-				slog.String("op", op+fu),
-				slog.String("error", err.Error()),
-			)
-
-			return []Product{}, ErrMarshalingJSON
-		}
-
-		var product Product
-
-		err = json.Unmarshal(productJSON, &product)
-		if err != nil {
-			s.log.Error(
-				"can't umarshal a hit",
-				slog.String("op", op+fu),
-				slog.String("error", err.Error()),
-			)
-
-			return []Product{}, ErrUnmarshalingJSON
-		}
-
-		products = append(products, product)
+		return []Product{}, err
 	}
 
 	return products, nil
 }
 
-// MakeSearch performs a search query against Elasticsearch with the given request parameters.
-//
-// It uses the query, filters, and other parameters specified in the 'req' argument.
-func (s *Service) MakeSearch(req ssv1.MakeSearchRequest) ([]Product, error) {
-	const fu = "Search()"
+// Builds the Elasticsearch query body for the given request parameters with the current ranking settings.
+func (s *Service) buildQuery(ctx context.Context, req ssv1.MakeSearchRequest) (bytes.Buffer, error) {
+	const fu = "buildQuery()"
 
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"multi_match": map[string]interface{}{
-							"query":  req.SearchFor,
-							"fields": []string{pName},
-						},
-					},
-				},
-				"must_not": []map[string]interface{}{
-					{
-						"match": map[string]interface{}{
-							pStock: 0,
-						},
-					},
-				},
-				"filter": []map[string]interface{}{
-					{
-						"range": map[string]interface{}{
-							pPrice: map[string]interface{}{
-								"gte": req.Filters.PriceBottom,
-								"lte": req.Filters.PriceTop,
-							},
-						},
-					},
-				},
-			},
-		},
-	}
+	_, span := tracing.Tracer().Start(ctx, "elasticsearch.buildQuery")
+	defer span.End()
+
+	log := logger.FromContext(ctx, s.log)
 
-	buf, err := utils.JSONEncode(query)
+	buf, err := BuildQuery(req, s.Ranking())
 	if err != nil {
-		s.log.Error(
+		log.Error(
 			"can't encode",
 			slog.String("op", op+fu),
 			slog.String("error", err.Error()),
 		)
 
-		return []Product{}, ErrEncodingJSON
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return buf, ErrEncodingJSON
 	}
 
+	span.SetAttributes(attribute.Int("elasticsearch.query.size", buf.Len()))
+
+	// The query holds the search text, so only its size is logged, whatever access_log.redact_query says.
+	log.Debug(
+		"query built",
+		slog.String("op", op+fu),
+		slog.Int("query_size", buf.Len()),
+	)
+
+	return buf, nil
+}
+
+// MakeSearch performs a search query against Elasticsearch with the given request parameters.
+//
+// It uses the query, filters, and other parameters specified in the 'req' argument.
+// The round trip to Elasticsearch is traced with the index, the number of hits and the time Elasticsearch took.
+func (s *Service) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]Product, error) {
+	const fu = "Search()"
+
+	log := logger.FromContext(ctx, s.log)
+
+	buf, err := s.buildQuery(ctx, req)
+	if err != nil {
+		return []Product{}, err
+	}
+
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		"elasticsearch.search",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "elasticsearch"),
+			attribute.String("db.operation", "search"),
+			attribute.String("elasticsearch.index", s.index),
+		),
+	)
+	defer span.End()
+
 	resp, err := s.ESClient.Search(
-		s.ESClient.Search.WithContext(context.Background()),
-		s.ESClient.Search.WithIndex(iProducts),
+		s.ESClient.Search.WithContext(ctx),
+		s.ESClient.Search.WithIndex(s.index),
 		s.ESClient.Search.WithBody(&buf),
 		s.ESClient.Search.WithPretty(),
 	)
 	if err != nil {
-		s.log.Error(
+		log.Error(
 			"can't make a request to elasticsearch",
 			slog.String("op", op+fu),
 			slog.String("error", err.Error()),
 		)
 
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		s.DiscoverOnFailure()
+
 		return []Product{}, err
 	}
 	defer resp.Body.Close()
 
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.IsError() {
+		err := &StatusError{StatusCode: resp.StatusCode}
+
+		log.Error(
+			"elasticsearch responded with an error",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return []Product{}, err
+	}
+
 	r, err := utils.JSONDecode(resp.Body)
 	if err != nil {
-		s.log.Error(
+		log.Error(
 			"can't decode",
 			slog.String("op", op+fu),
 			slog.String("error", err.Error()),
 		)
 
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
 		return []Product{}, ErrDecodingJSON
 	}
 
-	products, err := s.productHitsExtractor(r)
+	if took, ok := Took(r); ok {
+		span.SetAttributes(attribute.Int64("elasticsearch.took_ms", took))
+	}
+
+	products, err := s.productHitsExtractor(ctx, r)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
 		return []Product{}, err
 	}
 
+	span.SetAttributes(attribute.Int("elasticsearch.hits", len(products)))
+
 	if len(products) == 0 {
 		return []Product{}, ErrNoHits
 	}
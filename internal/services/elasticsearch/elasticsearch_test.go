@@ -0,0 +1,245 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/esconn"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/esreplay"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// With -record the fixtures are recorded against the cluster in ES_ADDRESS (with ES_USERNAME and ES_PASSWORD
+// or ES_API_KEY), which must hold the products of the migration file. The TLS verification is skipped.
+var record = flag.Bool("record", false, "record the fixtures against ES_ADDRESS instead of replaying them")
+
+// Creates the Service replaying the interactions from testdata/fixtures/<test name>.json, or recording them with -record.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	cfg := utils.Config{
+		ElasticSearch: utils.ElasticSearch{
+			Address: "http://elasticsearch.test:9200",
+			Index:   "../../../migrations/indices/products.json",
+		},
+		Ranking: utils.Ranking{
+			NameBoost:        3,
+			DescriptionBoost: 1,
+		},
+	}
+
+	fixture := filepath.Join("testdata", "fixtures", t.Name()+".json")
+	mode := esreplay.Replay
+
+	var next http.RoundTripper
+
+	if *record {
+		mode = esreplay.Record
+
+		cfg.ElasticSearch.Address = os.Getenv("ES_ADDRESS")
+		cfg.ElasticSearch.Username = os.Getenv("ES_USERNAME")
+		cfg.ElasticSearch.Password = os.Getenv("ES_PASSWORD")
+		cfg.ElasticSearch.APIKey = os.Getenv("ES_API_KEY")
+		cfg.ElasticSearch.Transport.TLS.Insecure = true
+
+		transport, err := esconn.Transport(cfg.ElasticSearch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next = transport
+	}
+
+	transport, err := esreplay.New(fixture, mode, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *record {
+		t.Cleanup(func() {
+			err := transport.Save()
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	s, err := NewWithTransport(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestMakeSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ssv1.MakeSearchRequest
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "text",
+			req: ssv1.MakeSearchRequest{
+				SearchFor: "apple macbook",
+				Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 100000},
+			},
+			want: []string{"Apple MacBook Air M2", "Apple AirPods Pro 2"},
+		},
+		{
+			name: "price range",
+			req: ssv1.MakeSearchRequest{
+				SearchFor: "apple macbook",
+				Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 500},
+			},
+			want: []string{"Apple AirPods Pro 2"},
+		},
+		{
+			name: "category",
+			req: ssv1.MakeSearchRequest{
+				SearchFor: "apple",
+				Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 100000, Category: "laptop"},
+			},
+			want: []string{"Apple MacBook Air M2"},
+		},
+		{
+			name: "no hits",
+			req: ssv1.MakeSearchRequest{
+				SearchFor: "typewriter",
+				Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 100000},
+			},
+			wantErr: ErrNoHits,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+
+			products, err := s.MakeSearch(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MakeSearch() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var names []string
+			for _, p := range products {
+				names = append(names, p.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("MakeSearch() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+// The fixture of the unavailable cluster is written by hand, so it is never recorded.
+func TestMakeSearchUnavailable(t *testing.T) {
+	if *record {
+		t.Skip("the fixture is written by hand")
+	}
+
+	s := newTestService(t)
+
+	_, err := s.MakeSearch(context.Background(), ssv1.MakeSearchRequest{
+		SearchFor: "apple",
+		Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 100000},
+	})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable || !statusErr.Retryable() {
+		t.Fatalf("MakeSearch() error = %v, want a retryable 503 StatusError", err)
+	}
+}
+
+func TestProductHitsExtractor(t *testing.T) {
+	s := &Service{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	tests := []struct {
+		name    string
+		v       any
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "hits",
+			v: map[string]interface{}{
+				"hits": map[string]interface{}{
+					"hits": []interface{}{
+						map[string]interface{}{"_source": map[string]interface{}{"name": "a", "price": 1.5}},
+						map[string]interface{}{"_source": map[string]interface{}{"name": "b", "stock": 2.0}},
+					},
+				},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "no hits",
+			v: map[string]interface{}{
+				"hits": map[string]interface{}{"hits": []interface{}{}},
+			},
+		},
+		{
+			name:    "no hits key",
+			v:       map[string]interface{}{},
+			wantErr: ErrInterfaceConversion,
+		},
+		{
+			name:    "no hits field",
+			v:       map[string]interface{}{"hits": map[string]interface{}{}},
+			wantErr: ErrInterfaceConversion,
+		},
+		{
+			name: "non-object hit",
+			v: map[string]interface{}{
+				"hits": map[string]interface{}{"hits": []interface{}{"1"}},
+			},
+			wantErr: ErrInterfaceConversion,
+		},
+		{
+			name: "no source",
+			v: map[string]interface{}{
+				"hits": map[string]interface{}{
+					"hits": []interface{}{map[string]interface{}{"_id": "1"}},
+				},
+			},
+			wantErr: ErrInterfaceConversion,
+		},
+		{
+			name: "malformed source",
+			v: map[string]interface{}{
+				"hits": map[string]interface{}{
+					"hits": []interface{}{
+						map[string]interface{}{"_source": map[string]interface{}{"price": "free"}},
+					},
+				},
+			},
+			wantErr: ErrUnmarshalingJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products, err := s.productHitsExtractor(context.Background(), tt.v)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("productHitsExtractor() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var names []string
+			for _, p := range products {
+				names = append(names, p.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("productHitsExtractor() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/esquery"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// BuildQuery() builds the Elasticsearch query body for the request with the ranking settings.
+//
+// The query matches the search text against the product fields, excludes products that are out of stock
+// and filters the results by the requested price range and, if set, the category. The body is returned JSON encoded.
+// It depends on nothing but its arguments, so the generated queries are covered by the golden files in testdata/golden.
+func BuildQuery(req ssv1.MakeSearchRequest, ranking utils.Ranking) (bytes.Buffer, error) {
+	query := esquery.Bool().
+		Must(esquery.MultiMatch(req.SearchFor, searchFields(ranking)...)).
+		MustNot(esquery.Match(pStock, 0)).
+		Filter(esquery.Range(pPrice).Gte(req.Filters.PriceBottom).Lte(req.Filters.PriceTop))
+
+	if req.Filters.Category != "" {
+		query.Filter(esquery.Term(pCategory, req.Filters.Category))
+	}
+
+	return utils.JSONEncode(esquery.Search().Query(query))
+}
+
+// Returns the fields to search in, with the boosts from the ranking settings.
+//
+// The fields with a zero boost are left out.
+func searchFields(ranking utils.Ranking) []string {
+	var fields []string
+
+	for _, f := range []struct {
+		name  string
+		boost float64
+	}{
+		{pName, ranking.NameBoost},
+		{pDescription, ranking.DescriptionBoost},
+		{pCategory, ranking.CategoryBoost},
+	} {
+		if f.boost > 0 {
+			fields = append(fields, f.name+"^"+strconv.FormatFloat(f.boost, 'f', -1, 64))
+		}
+	}
+
+	return fields
+}
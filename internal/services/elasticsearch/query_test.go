@@ -0,0 +1,100 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// With -update the golden files are rewritten with the generated queries. Review the diff before committing it.
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// Every combination of the filters and the ranking settings is covered. There are no sort options:
+// the results are always sorted by the score.
+func TestBuildQuery(t *testing.T) {
+	filters := []struct {
+		name    string
+		filters ssv1.MakeSearchRequestFilters
+	}{
+		{"any_price", ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 1000000}},
+		{"price_range", ssv1.MakeSearchRequestFilters{PriceBottom: 99.5, PriceTop: 499.99}},
+		{"exact_price", ssv1.MakeSearchRequestFilters{PriceBottom: 100, PriceTop: 100}},
+		{"category", ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 1000000, Category: "laptop"}},
+		{"price_range_category", ssv1.MakeSearchRequestFilters{PriceBottom: 99.5, PriceTop: 499.99, Category: "smartphone"}},
+	}
+
+	rankings := []struct {
+		name    string
+		ranking utils.Ranking
+	}{
+		{"name", utils.Ranking{NameBoost: 3}},
+		{"name_description", utils.Ranking{NameBoost: 3, DescriptionBoost: 1}},
+		{"all_fields", utils.Ranking{NameBoost: 3, DescriptionBoost: 1, CategoryBoost: 2}},
+		{"fractional", utils.Ranking{NameBoost: 1.5, DescriptionBoost: 0.25, CategoryBoost: 0.1}},
+		{"description_category", utils.Ranking{DescriptionBoost: 2, CategoryBoost: 1}},
+	}
+
+	texts := []struct {
+		name string
+		text string
+	}{
+		{"text", "apple macbook"},
+		{"special_text", `"quoted" <tag> & ünïcode`},
+	}
+
+	for _, tx := range texts {
+		for _, f := range filters {
+			for _, r := range rankings {
+				name := tx.name + "-" + f.name + "-" + r.name
+
+				t.Run(name, func(t *testing.T) {
+					buf, err := BuildQuery(ssv1.MakeSearchRequest{SearchFor: tx.text, Filters: f.filters}, r.ranking)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					var got bytes.Buffer
+
+					err = json.Indent(&got, buf.Bytes(), "", "  ")
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					golden(t, filepath.Join("testdata", "golden", name+".json"), got.Bytes())
+				})
+			}
+		}
+	}
+}
+
+// Compares the output with the golden file, or rewrites the file with -update.
+func golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create the golden file)", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("query differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
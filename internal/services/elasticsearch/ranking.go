@@ -0,0 +1,28 @@
+package elasticsearch
+
+import (
+	"sync/atomic"
+
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Size is the number of the results returned by a search, the default size of the Elasticsearch searches.
+// The services searching without Elasticsearch return as many.
+const Size = 10
+
+// Rankings struct holds the ranking settings, kept apart from the config so they can be swapped atomically on reload.
+// It is embedded in the services, the Cluster included. The zero value holds no settings until the first Reload.
+type Rankings struct {
+	ranking atomic.Pointer[utils.Ranking]
+}
+
+// Reload applies the reloadable settings of the new config, i.e. the ranking.
+func (r *Rankings) Reload(cfg utils.Config) {
+	ranking := cfg.Ranking
+	r.ranking.Store(&ranking)
+}
+
+// Ranking returns the current ranking settings.
+func (r *Rankings) Ranking() utils.Ranking {
+	return *r.ranking.Load()
+}
@@ -0,0 +1,240 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/analyzer"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+const op = "service.Memory."
+
+var (
+	ErrUnsupportedAction = fmt.Errorf("unsupported bulk action")
+	ErrMissingSource     = fmt.Errorf("bulk action without a document")
+)
+
+// Service struct represents the in-memory search engine.
+//
+// It holds the products loaded on start and searches them the way the Elasticsearch service does, so the app
+// can run without Elasticsearch. The ranking settings and their reload are handled by the embedded Rankings.
+type Service struct {
+	search.Rankings
+
+	log      *slog.Logger
+	config   utils.Config
+	products []document
+}
+
+// Product with its text fields split into the terms, as they are indexed by Elasticsearch.
+type document struct {
+	product     search.Product
+	name        []string
+	description []string
+}
+
+// New creates a new instance of the in-memory Service with the products from cfg.Backend.File.
+func New(log *slog.Logger, cfg utils.Config) (*Service, error) {
+	const fu = "New()"
+
+	products, err := Load(cfg.Backend.File)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	s := &Service{
+		log:    log,
+		config: cfg,
+	}
+	s.Reload(cfg)
+
+	for _, p := range products {
+		s.products = append(s.products, document{
+			product:     p,
+			name:        analyzer.Terms(p.Name),
+			description: analyzer.Terms(p.Description),
+		})
+	}
+
+	log.Info(
+		"products loaded",
+		slog.String("op", op+fu),
+		slog.String("file", cfg.Backend.File),
+		slog.Int("products", len(s.products)),
+	)
+
+	return s, nil
+}
+
+// Load() reads the products from the file in the NDJSON format of the Elasticsearch bulk API.
+//
+// Every "index" or "create" action line is followed by the product document. The documents with the same _id
+// replace each other, as they do in Elasticsearch. The products are returned in the order they were first indexed.
+func Load(path string) ([]search.Product, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return []search.Product{}, err
+	}
+	defer f.Close()
+
+	var (
+		products []search.Product
+		ids      = make(map[string]int)
+	)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var action map[string]struct {
+			ID json.RawMessage `json:"_id"`
+		}
+
+		err := json.Unmarshal(scanner.Bytes(), &action)
+		if err != nil {
+			return []search.Product{}, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		meta, ok := action["index"]
+		if !ok {
+			meta, ok = action["create"]
+		}
+		if !ok || len(action) != 1 {
+			return []search.Product{}, fmt.Errorf("%s:%d: %w", path, line, ErrUnsupportedAction)
+		}
+
+		if !scanner.Scan() {
+			return []search.Product{}, fmt.Errorf("%s:%d: %w", path, line, ErrMissingSource)
+		}
+		line++
+
+		var product search.Product
+
+		err = json.Unmarshal(scanner.Bytes(), &product)
+		if err != nil {
+			return []search.Product{}, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		id := strings.Trim(string(meta.ID), `"`)
+
+		if i, ok := ids[id]; ok && id != "" {
+			products[i] = product
+			continue
+		}
+		if id != "" {
+			ids[id] = len(products)
+		}
+		products = append(products, product)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return []search.Product{}, err
+	}
+
+	return products, nil
+}
+
+// MakeSearch searches the products with the same semantics as the Elasticsearch query.
+//
+// The search text matches a product if any of its terms is found in the name or the description, or if it equals
+// the category, which is a keyword field. Only the fields with a positive boost are searched. A product scores
+// the best of its fields, each scoring the number of the matched terms times the field boost. The products out of stock,
+// outside of the price range or, if the category filter is set, of another category are filtered out, and the 10 best
+// ones are returned.
+func (s *Service) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error) {
+	const fu = "MakeSearch()"
+
+	_, span := tracing.Tracer().Start(ctx, "memory.search")
+	defer span.End()
+
+	ranking := s.Ranking()
+	query := analyzer.Terms(req.SearchFor)
+
+	type hit struct {
+		product search.Product
+		score   float64
+	}
+
+	var hits []hit
+
+	for _, d := range s.products {
+		p := d.product
+
+		if p.Stock == 0 || p.Price < req.Filters.PriceBottom || p.Price > req.Filters.PriceTop {
+			continue
+		}
+		if req.Filters.Category != "" && p.Category != req.Filters.Category {
+			continue
+		}
+
+		score := max(
+			float64(matches(query, d.name))*ranking.NameBoost,
+			float64(matches(query, d.description))*ranking.DescriptionBoost,
+		)
+		if p.Category == req.SearchFor && ranking.CategoryBoost > 0 {
+			score = max(score, ranking.CategoryBoost)
+		}
+
+		if score > 0 {
+			hits = append(hits, hit{product: p, score: score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].score > hits[j].score
+	})
+
+	var products []search.Product
+
+	for _, h := range hits[:min(len(hits), search.Size)] {
+		products = append(products, h.product)
+	}
+
+	span.SetAttributes(attribute.Int("memory.hits", len(products)))
+
+	logger.FromContext(ctx, s.log).Debug(
+		"search made",
+		slog.String("op", op+fu),
+		slog.Int("hits", len(products)),
+	)
+
+	if len(products) == 0 {
+		return []search.Product{}, search.ErrNoHits
+	}
+
+	return products, nil
+}
+
+// Returns the number of the distinct query terms found in the field terms.
+func matches(query []string, field []string) int {
+	n := 0
+
+	for i, q := range query {
+		if !slices.Contains(query[:i], q) && slices.Contains(field, q) {
+			n++
+		}
+	}
+	return n
+}
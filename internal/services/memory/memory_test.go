@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+const products = `{"index": {"_index": "products", "_id": "1"}}
+{"name": "Apple MacBook Air", "description": "Thin and light laptop", "price": 1200, "stock": 5, "category": "laptop"}
+{"index": {"_index": "products", "_id": "2"}}
+{"name": "Apple iPhone", "description": "Smartphone with a great camera", "price": 900, "stock": 10, "category": "smartphone"}
+{"create": {"_index": "products", "_id": "3"}}
+{"name": "Apple Watch", "description": "Smartwatch for the Apple iPhone", "price": 400, "stock": 0, "category": "watch"}
+
+{"index": {"_index": "products"}}
+{"name": "Lenovo ThinkPad", "description": "Business laptop", "price": 1500, "stock": 3, "category": "laptop"}
+{"index": {"_index": "products", "_id": "2"}}
+{"name": "Apple iPhone 15", "description": "Smartphone with a great camera", "price": 1000, "stock": 10, "category": "smartphone"}
+`
+
+func writeProducts(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "products.ndjson")
+
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	// A nil wantErr with no products wanted stands for the JSON decoding errors.
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "products",
+			content: products,
+			want:    []string{"Apple MacBook Air", "Apple iPhone 15", "Apple Watch", "Lenovo ThinkPad"},
+		},
+		{
+			name:    "unsupported action",
+			content: `{"delete": {"_index": "products", "_id": "1"}}` + "\n",
+			wantErr: ErrUnsupportedAction,
+		},
+		{
+			name:    "several actions",
+			content: `{"index": {}, "create": {}}` + "\n" + `{"name": "a"}` + "\n",
+			wantErr: ErrUnsupportedAction,
+		},
+		{
+			name:    "missing source",
+			content: `{"index": {"_id": "1"}}` + "\n",
+			wantErr: ErrMissingSource,
+		},
+		{
+			name:    "malformed action",
+			content: `{"index": ` + "\n",
+		},
+		{
+			name:    "malformed source",
+			content: `{"index": {"_id": "1"}}` + "\n" + `{"price": "free"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(writeProducts(t, tt.content))
+
+			if (err != nil) != (tt.want == nil) || !errors.Is(err, tt.wantErr) && tt.wantErr != nil {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var names []string
+			for _, p := range got {
+				names = append(names, p.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Load() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestMakeSearch(t *testing.T) {
+	cfg := utils.Config{
+		Backend: utils.Backend{File: writeProducts(t, products)},
+		Ranking: utils.Ranking{NameBoost: 3, DescriptionBoost: 1, CategoryBoost: 2},
+	}
+
+	s, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		req     ssv1.MakeSearchRequest
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "text",
+			req:  ssv1.MakeSearchRequest{SearchFor: "Apple laptop", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}},
+			want: []string{"Apple MacBook Air", "Apple iPhone 15", "Lenovo ThinkPad"},
+		},
+		{
+			name: "price bounds",
+			req:  ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceBottom: 1000, PriceTop: 1200}},
+			want: []string{"Apple MacBook Air", "Apple iPhone 15"},
+		},
+		{
+			name:    "out of stock",
+			req:     ssv1.MakeSearchRequest{SearchFor: "watch", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}},
+			wantErr: search.ErrNoHits,
+		},
+		{
+			name: "category filter",
+			req:  ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000, Category: "smartphone"}},
+			want: []string{"Apple iPhone 15"},
+		},
+		{
+			name: "category as text",
+			req:  ssv1.MakeSearchRequest{SearchFor: "laptop", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}},
+			want: []string{"Apple MacBook Air", "Lenovo ThinkPad"},
+		},
+		{
+			name:    "no hits",
+			req:     ssv1.MakeSearchRequest{SearchFor: "typewriter", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 100000}},
+			wantErr: search.ErrNoHits,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products, err := s.MakeSearch(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MakeSearch() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var names []string
+			for _, p := range products {
+				names = append(names, p.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("MakeSearch() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package opensearch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/esconn"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+const op = "service.OpenSearch."
+
+// Service struct represents the OpenSearch service.
+//
+// OpenSearch speaks the Elasticsearch REST API the app uses, but the official Elasticsearch client refuses it
+// in its product check. So the requests are made with the transport underneath that client, which has the same
+// node pool, metrics and discovery but no product check. The queries are built and the responses are decoded
+// by the Elasticsearch service code, so both backends behave the same.
+//
+// The products are searched through the alias named in the definition in cfg.ElasticSearch.Index, as in Elasticsearch.
+// The ranking, the health of the nodes and their discovery are handled by the embedded Cluster, as in Elasticsearch.
+type Service struct {
+	Client *elastictransport.Client
+	*search.Cluster
+
+	log    *slog.Logger
+	config utils.Config
+	index  string
+}
+
+// New creates a new instance of the OpenSearch Service with the given logger and configuration.
+//
+// The connection settings are the ones of the elasticsearch section: the nodes, the credentials (OpenSearch
+// usually takes the username and password), the TLS settings and the node discovery.
+// The retries of the client are disabled, as the searches are retried with a backoff by the SimpleSearch service.
+func New(log *slog.Logger, cfg utils.Config) (*Service, error) {
+	definition, err := indexdef.Load(cfg.ElasticSearch.Index)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	transport, err := esconn.Transport(cfg.ElasticSearch)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	var urls []*url.URL
+
+	for _, node := range cfg.ElasticSearch.Nodes() {
+		u, err := url.Parse(strings.TrimRight(node, "/"))
+		if err != nil {
+			return &Service{}, err
+		}
+		urls = append(urls, u)
+	}
+
+	client, err := elastictransport.New(elastictransport.Config{
+		URLs:                  urls,
+		Username:              cfg.ElasticSearch.Username,
+		Password:              cfg.ElasticSearch.Password,
+		APIKey:                cfg.ElasticSearch.APIKey,
+		ServiceToken:          cfg.ElasticSearch.ServiceToken,
+		Transport:             transport,
+		DiscoverNodesInterval: cfg.ElasticSearch.Discovery.Interval,
+		EnableMetrics:         true,
+		DisableRetry:          true,
+	})
+	if err != nil {
+		return &Service{}, err
+	}
+
+	s := &Service{
+		Client:  client,
+		Cluster: search.NewCluster(log, op, cfg, client),
+
+		log:    log,
+		config: cfg,
+		index:  definition.Name,
+	}
+
+	if cfg.ElasticSearch.Discovery.OnStart {
+		go client.DiscoverNodes()
+	}
+
+	return s, nil
+}
+
+// MakeSearch performs a search query against OpenSearch with the given request parameters.
+//
+// The query is the one of the Elasticsearch service. The round trip is traced with the index, the number of hits
+// and the time OpenSearch took.
+func (s *Service) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error) {
+	const fu = "MakeSearch()"
+
+	log := logger.FromContext(ctx, s.log)
+
+	buf, err := search.BuildQuery(req, s.Ranking())
+	if err != nil {
+		log.Error(
+			"can't encode",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		return []search.Product{}, search.ErrEncodingJSON
+	}
+
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		"opensearch.search",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "opensearch"),
+			attribute.String("db.operation", "search"),
+			attribute.String("opensearch.index", s.index),
+		),
+	)
+	defer span.End()
+
+	resp, err := s.perform(ctx, http.MethodPost, "/"+s.index+"/_search", &buf)
+	if err != nil {
+		log.Error(
+			"can't search",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return []search.Product{}, err
+	}
+	defer resp.Body.Close()
+
+	r, err := utils.JSONDecode(resp.Body)
+	if err != nil {
+		log.Error(
+			"can't decode",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return []search.Product{}, search.ErrDecodingJSON
+	}
+
+	if took, ok := search.Took(r); ok {
+		span.SetAttributes(attribute.Int64("opensearch.took_ms", took))
+	}
+
+	products, err := search.ProductHits(r)
+	if err != nil {
+		log.Error(
+			"can't extract the hits",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		return []search.Product{}, err
+	}
+
+	span.SetAttributes(attribute.Int("opensearch.hits", len(products)))
+
+	if len(products) == 0 {
+		return []search.Product{}, search.ErrNoHits
+	}
+
+	return products, nil
+}
+
+// Performs the request with the JSON body, returning a *search.StatusError if OpenSearch responds with an error status.
+func (s *Service) perform(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.Client.Perform(req)
+	if err != nil {
+		s.DiscoverOnFailure()
+		return nil, err
+	}
+
+	if resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		return nil, &search.StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/fakees"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/indexdef"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+const indexFile = "../../../migrations/indices/products.json"
+
+// Handler that makes the fake look like OpenSearch: it reports an OpenSearch version and doesn't send
+// the X-Elastic-Product header, so the official Elasticsearch client fails its product check.
+type openSearchFake struct {
+	next http.Handler
+}
+
+func (f openSearchFake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"version": {"distribution": "opensearch", "number": "2.13.0"}, "tagline": "The OpenSearch Project: https://opensearch.org/"}`)
+		return
+	}
+	f.next.ServeHTTP(withoutProduct{w}, r)
+}
+
+type withoutProduct struct {
+	http.ResponseWriter
+}
+
+func (w withoutProduct) WriteHeader(code int) {
+	w.Header().Del("X-Elastic-Product")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w withoutProduct) Write(b []byte) (int, error) {
+	w.Header().Del("X-Elastic-Product")
+	return w.ResponseWriter.Write(b)
+}
+
+// Starts the OpenSearch fake with the products index and a product in stock and out of it.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(openSearchFake{next: fakees.New()})
+	t.Cleanup(srv.Close)
+
+	definition, err := indexdef.Load(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliased, err := definition.Aliased()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := aliased.Body()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request(t, http.MethodPut, srv.URL+"/"+aliased.Name, bytes.NewReader(body))
+	request(t, http.MethodPost, srv.URL+"/"+definition.Name+"/_bulk?refresh=true", strings.NewReader(
+		`{"index": {"_id": "1"}}`+"\n"+
+			`{"name": "Apple MacBook Air", "category": "laptop", "price": 1199.99, "stock": 45}`+"\n"+
+			`{"index": {"_id": "2"}}`+"\n"+
+			`{"name": "Apple iPhone", "category": "smartphone", "price": 999, "stock": 0}`+"\n",
+	))
+
+	return srv
+}
+
+func request(t *testing.T, method string, url string, body io.Reader) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s = %d %s", method, url, resp.StatusCode, b)
+	}
+	if resp.Header.Get("X-Elastic-Product") != "" {
+		t.Fatalf("%s %s sent the X-Elastic-Product header", method, url)
+	}
+}
+
+func TestMakeSearch(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := utils.Config{
+		ElasticSearch: utils.ElasticSearch{Address: srv.URL, Index: indexFile},
+		Ranking:       utils.Ranking{NameBoost: 3},
+	}
+
+	s, err := New(log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	products, err := s.MakeSearch(ctx, ssv1.MakeSearchRequest{
+		SearchFor: "apple",
+		Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 2000},
+	})
+	if err != nil || len(products) != 1 || products[0].Name != "Apple MacBook Air" {
+		t.Fatalf("MakeSearch() = %v, %v, want the product in stock", products, err)
+	}
+
+	_, err = s.MakeSearch(ctx, ssv1.MakeSearchRequest{
+		SearchFor: "typewriter",
+		Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 2000},
+	})
+	if !errors.Is(err, search.ErrNoHits) {
+		t.Fatalf("MakeSearch() error = %v, want %v", err, search.ErrNoHits)
+	}
+
+	// The Elasticsearch service refuses the same server.
+	es, err := search.New(log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = es.MakeSearch(ctx, ssv1.MakeSearchRequest{
+		SearchFor: "apple",
+		Filters:   ssv1.MakeSearchRequestFilters{PriceBottom: 0, PriceTop: 2000},
+	})
+	if err == nil {
+		t.Fatal("Elasticsearch MakeSearch() succeeded against OpenSearch, want the product check to fail")
+	}
+}
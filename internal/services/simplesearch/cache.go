@@ -0,0 +1,212 @@
+package simplesearch
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Metrics of the search results cache, published with expvar.
+var (
+	cacheMetrics = expvar.NewMap("simplesearch.cache")
+	cacheEntries = new(expvar.Int)
+)
+
+func init() {
+	cacheMetrics.Set("entries", cacheEntries)
+}
+
+// CacheStatus tells how the search was served with regard to the cache.
+type CacheStatus string
+
+const (
+	// CacheHit means the results were served from the cache.
+	CacheHit CacheStatus = "hit"
+	// CacheMiss means the results were not cached and were fetched from the search engine.
+	CacheMiss CacheStatus = "miss"
+	// CacheBypass means the cache is disabled.
+	CacheBypass CacheStatus = "bypass"
+	// CacheStale means the expired results were served from the cache, as the search engine is unavailable.
+	CacheStale CacheStatus = "stale"
+)
+
+// Cache interface defines the contract for the search results caches used by the SimpleSearch service.
+//
+// The in-memory LRU cache is used by default, other backends (e.g. a shared one) can be plugged in
+// by setting Service.Cache. The cached results are shared between the callers and must not be modified.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]search.Product, bool)
+	Set(ctx context.Context, key string, products []search.Product)
+	Purge(ctx context.Context)
+}
+
+// StaleCache interface is implemented by the caches that keep the expired results for a while,
+// so they can be served when the search engine is unavailable.
+type StaleCache interface {
+	GetStale(ctx context.Context, key string) ([]search.Product, bool)
+}
+
+// ExpiringCache interface is implemented by the caches that can expire all the results at once,
+// keeping them as stale for the stale-if-error period instead of dropping them.
+type ExpiringCache interface {
+	Expire(ctx context.Context)
+}
+
+// CacheKey() returns the cache key of the search request.
+//
+// The request is normalized first, so the searches differing only in case and whitespace share the results.
+func CacheKey(req ssv1.MakeSearchRequest) string {
+	return strings.Join([]string{
+		strings.Join(strings.Fields(strings.ToLower(req.SearchFor)), " "),
+		strconv.FormatFloat(req.Filters.PriceBottom, 'f', -1, 64),
+		strconv.FormatFloat(req.Filters.PriceTop, 'f', -1, 64),
+		req.Filters.Category,
+	}, "\x00")
+}
+
+// LRU struct is the in-memory Cache with a TTL and a limit on the number of entries.
+//
+// The expired entries are kept as stale for the stale-if-error period and dropped when they are read after it,
+// the least recently used ones are dropped when the cache is full.
+type LRU struct {
+	mu           sync.Mutex
+	ttl          time.Duration
+	staleIfError time.Duration
+	maxEntries   int
+	entries      map[string]*list.Element
+	order        *list.List
+	now          func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	products  []search.Product
+	expiresAt time.Time
+}
+
+// NewLRU() creates an empty LRU cache with the settings from cfg.Search.Cache.
+func NewLRU(cfg utils.Config) *LRU {
+	return &LRU{
+		ttl:          cfg.Search.Cache.TTL,
+		staleIfError: cfg.Search.Cache.StaleIfError,
+		maxEntries:   cfg.Search.Cache.MaxEntries,
+		entries:      make(map[string]*list.Element),
+		order:        list.New(),
+		now:          time.Now,
+	}
+}
+
+// Get returns the cached results for the key, if they haven't expired.
+func (l *LRU) Get(_ context.Context, key string) ([]search.Product, bool) {
+	return l.get(key, false)
+}
+
+// GetStale returns the cached results for the key, even if they have expired within the stale-if-error period.
+func (l *LRU) GetStale(_ context.Context, key string) ([]search.Product, bool) {
+	return l.get(key, true)
+}
+
+// Returns the results for the key, if they haven't expired, or are within the stale-if-error period when stale is set.
+func (l *LRU) get(key string, stale bool) ([]search.Product, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	now := l.now()
+
+	if now.After(entry.expiresAt.Add(l.staleIfError)) {
+		l.remove(e)
+		return nil, false
+	}
+	if !stale && !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+
+	l.order.MoveToFront(e)
+
+	return entry.products, true
+}
+
+// Set caches the results for the key, evicting the least recently used entries if the cache is full.
+func (l *LRU) Set(_ context.Context, key string, products []search.Product) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[key]; ok {
+		l.remove(e)
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{
+		key:       key,
+		products:  products,
+		expiresAt: l.now().Add(l.ttl),
+	})
+	cacheEntries.Set(int64(l.order.Len()))
+
+	l.evict()
+}
+
+// Purge drops all the cached results.
+func (l *LRU) Purge(_ context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = make(map[string]*list.Element)
+	l.order.Init()
+	cacheEntries.Set(0)
+}
+
+// Expire makes all the cached results stale, so they are served only when the search engine is unavailable.
+func (l *LRU) Expire(_ context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	for e := l.order.Front(); e != nil; e = e.Next() {
+		if entry := e.Value.(*lruEntry); entry.expiresAt.After(now) {
+			entry.expiresAt = now
+		}
+	}
+}
+
+// Reload applies the new TTL and size limit. The entries above the new limit are evicted.
+func (l *LRU) Reload(cfg utils.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ttl = cfg.Search.Cache.TTL
+	l.staleIfError = cfg.Search.Cache.StaleIfError
+	l.maxEntries = cfg.Search.Cache.MaxEntries
+
+	l.evict()
+}
+
+// Must be called with the mutex held.
+func (l *LRU) evict() {
+	for l.maxEntries > 0 && l.order.Len() > l.maxEntries {
+		l.remove(l.order.Back())
+		cacheMetrics.Add("evictions", 1)
+	}
+}
+
+// Must be called with the mutex held.
+func (l *LRU) remove(e *list.Element) {
+	l.order.Remove(e)
+	delete(l.entries, e.Value.(*lruEntry).key)
+
+	cacheEntries.Set(int64(l.order.Len()))
+}
@@ -0,0 +1,161 @@
+package simplesearch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := ssv1.MakeSearchRequest{SearchFor: "apple macbook", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000}}
+
+	tests := []struct {
+		name string
+		req  ssv1.MakeSearchRequest
+		same bool
+	}{
+		{"case", ssv1.MakeSearchRequest{SearchFor: "Apple MacBook", Filters: base.Filters}, true},
+		{"whitespace", ssv1.MakeSearchRequest{SearchFor: "  apple \t macbook ", Filters: base.Filters}, true},
+		{"other text", ssv1.MakeSearchRequest{SearchFor: "apple watch", Filters: base.Filters}, false},
+		{"other price", ssv1.MakeSearchRequest{SearchFor: base.SearchFor, Filters: ssv1.MakeSearchRequestFilters{PriceTop: 1000}}, false},
+		{"category", ssv1.MakeSearchRequest{SearchFor: base.SearchFor, Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000, Category: "laptop"}}, false},
+		{"words joined", ssv1.MakeSearchRequest{SearchFor: "applemacbook", Filters: base.Filters}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := CacheKey(tt.req) == CacheKey(base); same != tt.same {
+				t.Errorf("CacheKey(%+v) equal = %v, want %v", tt.req, same, tt.same)
+			}
+		})
+	}
+}
+
+// Creates the LRU cache with a clock advanced by the returned function.
+func newTestLRU(cache utils.SearchCache) (*LRU, func(time.Duration)) {
+	now := time.Now()
+
+	l := NewLRU(utils.Config{Search: utils.Search{Cache: cache}})
+	l.now = func() time.Time { return now }
+
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	products := []search.Product{macbook}
+
+	t.Run("eviction", func(t *testing.T) {
+		l, _ := newTestLRU(utils.SearchCache{TTL: time.Minute, MaxEntries: 2})
+
+		l.Set(ctx, "a", products)
+		l.Set(ctx, "b", products)
+		l.Get(ctx, "a")
+		l.Set(ctx, "c", products)
+
+		// In order, as every Get makes its entry the most recently used one.
+		for _, tt := range []struct {
+			key  string
+			want bool
+		}{{"a", true}, {"b", false}, {"c", true}} {
+			if _, ok := l.Get(ctx, tt.key); ok != tt.want {
+				t.Errorf("Get(%s) = %v, want %v", tt.key, ok, tt.want)
+			}
+		}
+
+		// A lower limit on reload evicts the least recently used entries.
+		l.Reload(utils.Config{Search: utils.Search{Cache: utils.SearchCache{TTL: time.Minute, MaxEntries: 1}}})
+
+		if _, ok := l.Get(ctx, "a"); ok {
+			t.Error("Get(a) found the least recently used entry after the reload")
+		}
+		if _, ok := l.Get(ctx, "c"); !ok {
+			t.Error("Get(c) didn't find the most recently used entry after the reload")
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		l, advance := newTestLRU(utils.SearchCache{TTL: time.Minute, StaleIfError: time.Hour})
+
+		l.Set(ctx, "a", products)
+
+		advance(59 * time.Second)
+		if _, ok := l.Get(ctx, "a"); !ok {
+			t.Fatal("Get() didn't find the entry before its TTL")
+		}
+
+		advance(time.Second)
+		if _, ok := l.Get(ctx, "a"); ok {
+			t.Fatal("Get() found the expired entry")
+		}
+		if _, ok := l.GetStale(ctx, "a"); !ok {
+			t.Fatal("GetStale() didn't find the entry within the stale-if-error period")
+		}
+
+		advance(time.Hour + time.Second)
+		if _, ok := l.GetStale(ctx, "a"); ok {
+			t.Fatal("GetStale() found the entry after the stale-if-error period")
+		}
+		if l.order.Len() != 0 {
+			t.Errorf("%d entries kept, want the expired one dropped", l.order.Len())
+		}
+	})
+
+	t.Run("expire all", func(t *testing.T) {
+		l, _ := newTestLRU(utils.SearchCache{TTL: time.Minute, StaleIfError: time.Hour})
+
+		l.Set(ctx, "a", products)
+		l.Expire(ctx)
+
+		if _, ok := l.Get(ctx, "a"); ok {
+			t.Error("Get() found the expired entry")
+		}
+		if _, ok := l.GetStale(ctx, "a"); !ok {
+			t.Error("GetStale() didn't find the expired entry")
+		}
+
+		l.Purge(ctx)
+		if _, ok := l.GetStale(ctx, "a"); ok {
+			t.Error("GetStale() found the purged entry")
+		}
+	})
+}
+
+func TestMakeSearchCacheStatus(t *testing.T) {
+	ctx := context.Background()
+	req := ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000}}
+
+	f := &fakeSearcher{products: []search.Product{macbook}}
+	s := newTestService(t, f, utils.Config{Search: utils.Search{Cache: utils.SearchCache{Enabled: true, TTL: time.Minute}}}, nil)
+
+	for _, want := range []struct {
+		status CacheStatus
+		calls  int
+	}{{CacheMiss, 1}, {CacheHit, 1}} {
+		res, err := s.MakeSearch(ctx, req)
+		if err != nil || res.CacheStatus != want.status || f.count() != want.calls {
+			t.Fatalf("MakeSearch() = %s, %v with %d calls, want %s with %d", res.CacheStatus, err, f.count(), want.status, want.calls)
+		}
+	}
+
+	// The results aren't cached when no hits are found.
+	f.set(nil, search.ErrNoHits)
+
+	for range 2 {
+		res, _ := s.MakeSearch(ctx, ssv1.MakeSearchRequest{SearchFor: "typewriter", Filters: req.Filters})
+		if res.CacheStatus != CacheMiss {
+			t.Fatalf("MakeSearch() = %s, want %s", res.CacheStatus, CacheMiss)
+		}
+	}
+
+	s.cacheEnabled.Store(false)
+
+	res, _ := s.MakeSearch(ctx, req)
+	if res.CacheStatus != CacheBypass || f.count() != 4 {
+		t.Fatalf("MakeSearch() = %s with %d calls, want %s with 4", res.CacheStatus, f.count(), CacheBypass)
+	}
+}
@@ -0,0 +1,92 @@
+package simplesearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+)
+
+// Loads the fallback products from the JSON file. No products are loaded when the path is empty.
+func loadFallback(path string) ([]search.Product, error) {
+	if path == "" {
+		return []search.Product{}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return []search.Product{}, err
+	}
+	defer f.Close()
+
+	var products []search.Product
+
+	err = json.NewDecoder(f).Decode(&products)
+	if err != nil {
+		return []search.Product{}, err
+	}
+
+	return products, nil
+}
+
+// Serves the degraded results for the search that failed with err, reporting false if there are none.
+//
+// The last known good results of the search are served first, even if they have expired, within the stale-if-error
+// period. Otherwise the fallback products matching the filters and in stock are served. The searches
+// with no hits are not degraded, as the search engine has answered them.
+func (s *Service) degrade(ctx context.Context, req ssv1.MakeSearchRequest, key string, err error) (Result, bool) {
+	const fu = "degrade()"
+
+	if errors.Is(err, search.ErrNoHits) {
+		return Result{}, false
+	}
+
+	log := logger.FromContext(ctx, s.log)
+	span := trace.SpanFromContext(ctx)
+
+	if stale, ok := s.Cache.(StaleCache); ok && s.cacheEnabled.Load() {
+		if products, ok := stale.GetStale(ctx, key); ok {
+			searchMetrics.Add("degraded_stale", 1)
+			span.SetAttributes(attribute.String("simplesearch.degraded", "stale"))
+
+			log.Warn(
+				"serving stale results",
+				slog.String("op", op+fu),
+				slog.String("error", err.Error()),
+			)
+
+			return Result{Products: products, CacheStatus: CacheStale, Degraded: true}, true
+		}
+	}
+
+	var products []search.Product
+
+	for _, p := range *s.fallback.Load() {
+		if p.Stock > 0 && p.Price >= req.Filters.PriceBottom && p.Price <= req.Filters.PriceTop &&
+			(req.Filters.Category == "" || p.Category == req.Filters.Category) {
+			products = append(products, p)
+		}
+	}
+	if len(products) == 0 {
+		return Result{}, false
+	}
+
+	searchMetrics.Add("degraded_fallback", 1)
+	span.SetAttributes(attribute.String("simplesearch.degraded", "fallback"))
+
+	log.Warn(
+		"serving fallback results",
+		slog.String("op", op+fu),
+		slog.String("error", err.Error()),
+	)
+
+	return Result{Products: products, CacheStatus: CacheMiss, Degraded: true}, true
+}
@@ -0,0 +1,143 @@
+package simplesearch
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+var (
+	unavailable = &search.StatusError{StatusCode: 503}
+	cacheConfig = utils.Config{Search: utils.Search{Cache: utils.SearchCache{Enabled: true, TTL: time.Minute, StaleIfError: time.Hour}}}
+)
+
+// Returns the names of the products.
+func names(products []search.Product) []string {
+	var n []string
+	for _, p := range products {
+		n = append(n, p.Name)
+	}
+	return n
+}
+
+// Advances the clock of the LRU cache of the service.
+func advanceCache(s *Service, d time.Duration) {
+	l := s.Cache.(*LRU)
+
+	now := l.now().Add(d)
+	l.now = func() time.Time { return now }
+}
+
+func TestMakeSearchStale(t *testing.T) {
+	ctx := context.Background()
+	req := ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000}}
+
+	f := &fakeSearcher{products: []search.Product{macbook}}
+	s := newTestService(t, f, cacheConfig, nil)
+
+	_, err := s.MakeSearch(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	advanceCache(s, 2*time.Minute)
+	f.set(nil, unavailable)
+
+	res, err := s.MakeSearch(ctx, req)
+	if err != nil || !res.Degraded || res.CacheStatus != CacheStale || !slices.Equal(names(res.Products), []string{macbook.Name}) {
+		t.Fatalf("MakeSearch() = %+v, %v, want the stale MacBook", res, err)
+	}
+
+	// No stale results past the stale-if-error period, and no fallback products.
+	advanceCache(s, time.Hour)
+
+	res, err = s.MakeSearch(ctx, req)
+	if !errors.Is(err, unavailable) || res.Degraded {
+		t.Fatalf("MakeSearch() = %+v, %v, want %v", res, err, unavailable)
+	}
+}
+
+func TestMakeSearchFallback(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		filters ssv1.MakeSearchRequestFilters
+		err     error
+		want    []string
+	}{
+		{"in stock", ssv1.MakeSearchRequestFilters{PriceTop: 2000}, unavailable, []string{macbook.Name, watch.Name}},
+		{"price range", ssv1.MakeSearchRequestFilters{PriceBottom: 500, PriceTop: 2000}, unavailable, []string{macbook.Name}},
+		{"category", ssv1.MakeSearchRequestFilters{PriceTop: 2000, Category: "watch"}, unavailable, []string{watch.Name}},
+		{"out of stock category", ssv1.MakeSearchRequestFilters{PriceTop: 2000, Category: "smartphone"}, unavailable, nil},
+		{"no hits", ssv1.MakeSearchRequestFilters{PriceTop: 2000}, search.ErrNoHits, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeSearcher{err: tt.err}
+			s := newTestService(t, f, cacheConfig, []search.Product{macbook, iphone, watch})
+
+			res, err := s.MakeSearch(ctx, ssv1.MakeSearchRequest{SearchFor: "apple", Filters: tt.filters})
+
+			if tt.want == nil {
+				if !errors.Is(err, tt.err) || res.Degraded {
+					t.Fatalf("MakeSearch() = %+v, %v, want %v", res, err, tt.err)
+				}
+				return
+			}
+			if err != nil || !res.Degraded || res.CacheStatus != CacheMiss || !slices.Equal(names(res.Products), tt.want) {
+				t.Fatalf("MakeSearch() = %+v, %v, want the degraded %v", res, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReloadExpiresOnRankingChange(t *testing.T) {
+	ctx := context.Background()
+	req := ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000}}
+
+	f := &fakeSearcher{products: []search.Product{macbook}}
+	s := newTestService(t, f, cacheConfig, nil)
+
+	_, err := s.MakeSearch(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache is kept when the ranking didn't change.
+	cfg := cacheConfig
+	cfg.Search.Timeout = time.Second
+	s.Reload(cfg)
+
+	res, err := s.MakeSearch(ctx, req)
+	if err != nil || res.CacheStatus != CacheHit {
+		t.Fatalf("MakeSearch() = %s, %v, want %s", res.CacheStatus, err, CacheHit)
+	}
+
+	// It is expired when it did, but kept as stale.
+	cfg.Ranking.NameBoost = 5
+	s.Reload(cfg)
+	f.set(nil, unavailable)
+
+	res, err = s.MakeSearch(ctx, req)
+	if err != nil || res.CacheStatus != CacheStale || !res.Degraded {
+		t.Fatalf("MakeSearch() = %+v, %v, want the stale results", res, err)
+	}
+
+	f.set([]search.Product{watch}, nil)
+
+	res, err = s.MakeSearch(ctx, req)
+	if err != nil || res.CacheStatus != CacheMiss || !slices.Equal(names(res.Products), []string{watch.Name}) {
+		t.Fatalf("MakeSearch() = %+v, %v, want the new results", res, err)
+	}
+	if f.count() != 3 {
+		t.Errorf("Searcher called %d times, want 3", f.count())
+	}
+}
@@ -0,0 +1,169 @@
+package simplesearch
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/logger"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/resilience"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Metrics of the resilience layer, published with expvar.
+var (
+	resilienceMetrics = expvar.NewMap("simplesearch.resilience")
+	breakerState      = new(expvar.String)
+)
+
+func init() {
+	breakerState.Set(resilience.Closed.String())
+	resilienceMetrics.Set("breaker_state", breakerState)
+}
+
+// Resilient struct is the Searcher that retries the transient failures of the wrapped Searcher
+// and stops calling it for a while once it keeps failing.
+//
+// Only the searches are wrapped, which are idempotent reads and safe to repeat. The retries are spread with
+// a jittered exponential backoff, and the circuit breaker fails the searches fast with resilience.ErrCircuitOpen
+// when it is open. The retries, the fast failures and the breaker transitions are logged and counted in the
+// "simplesearch.resilience" expvar map.
+type Resilient struct {
+	Search Searcher
+
+	log     *slog.Logger
+	config  utils.Config
+	breaker *resilience.Breaker
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// NewResilient() wraps the Searcher with the retries and the circuit breaker configured in cfg.Resilience.
+func NewResilient(log *slog.Logger, cfg utils.Config, searcher Searcher) *Resilient {
+	const fu = "NewResilient()"
+
+	r := &Resilient{
+		Search: searcher,
+
+		log:    log,
+		config: cfg,
+		sleep:  resilience.Sleep,
+	}
+
+	r.breaker = resilience.NewBreaker(cfg.Resilience.Breaker, func(from resilience.State, to resilience.State) {
+		breakerState.Set(to.String())
+		if to == resilience.Open {
+			resilienceMetrics.Add("breaker_opened", 1)
+		}
+
+		log.Warn(
+			"circuit breaker state changed",
+			slog.String("op", op+fu),
+			slog.String("from", from.String()),
+			slog.String("to", to.String()),
+		)
+	})
+
+	return r
+}
+
+// Reload passes the new config to the wrapped Searcher.
+func (r *Resilient) Reload(cfg utils.Config) {
+	if rl, ok := r.Search.(Reloader); ok {
+		rl.Reload(cfg)
+	}
+}
+
+// Health returns the health of the nodes behind the wrapped Searcher.
+func (r *Resilient) Health() []search.NodeHealth {
+	if h, ok := r.Search.(HealthReporter); ok {
+		return h.Health()
+	}
+	return []search.NodeHealth{}
+}
+
+// MakeSearch performs the search with the wrapped Searcher, retrying the transient failures.
+//
+// The search is not retried once the context is done. Only the searches that succeeded, found nothing or were
+// rejected as the client's fault (a 4xx status but 429) count as a success for the circuit breaker. Any other error,
+// e.g. a persistent 500 or a response that can't be decoded, counts as a failure, as does a search that ran out
+// of time. The searches abandoned by the client are not counted.
+func (r *Resilient) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error) {
+	const fu = "MakeSearch()"
+
+	log := logger.FromContext(ctx, r.log)
+	span := trace.SpanFromContext(ctx)
+
+	err := r.breaker.Allow()
+	if err != nil {
+		resilienceMetrics.Add("fast_failures", 1)
+
+		log.Warn(
+			"search failed fast",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+
+		return []search.Product{}, err
+	}
+
+	var products []search.Product
+
+	for attempt := 1; ; attempt++ {
+		products, err = r.Search.MakeSearch(ctx, req)
+		if err == nil || !resilience.Retryable(err) || attempt >= r.config.Resilience.Retry.MaxAttempts {
+			break
+		}
+
+		delay := resilience.Backoff(r.config.Resilience.Retry, attempt)
+
+		resilienceMetrics.Add("retries", 1)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.String("error", err.Error()),
+		))
+
+		log.Warn(
+			"retrying the search",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("backoff", delay),
+		)
+
+		if r.sleep(ctx, delay) != nil {
+			break
+		}
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		r.breaker.Cancel()
+	case responding(err):
+		r.breaker.Success()
+	default:
+		r.breaker.Failure()
+	}
+
+	return products, err
+}
+
+// Reports whether the outcome of a search shows the search engine working: a result, no hits,
+// or a rejection of the request itself (a 4xx status, except for 429 Too Many Requests).
+func responding(err error) bool {
+	if err == nil || errors.Is(err, search.ErrNoHits) {
+		return true
+	}
+
+	var se *search.StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 400 && se.StatusCode < 500 && !se.Retryable()
+	}
+	return false
+}
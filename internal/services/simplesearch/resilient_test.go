@@ -0,0 +1,112 @@
+package simplesearch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/resilience"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Searcher failing with the errors in turn, the last one repeated. A nil error returns a product.
+type scriptedSearcher struct {
+	errs  []error
+	calls int
+}
+
+func (s *scriptedSearcher) MakeSearch(ctx context.Context, _ ssv1.MakeSearchRequest) ([]search.Product, error) {
+	err := s.errs[min(s.calls, len(s.errs)-1)]
+	s.calls++
+
+	if ctx.Err() != nil {
+		return []search.Product{}, ctx.Err()
+	}
+	if err != nil {
+		return []search.Product{}, err
+	}
+	return []search.Product{macbook}, nil
+}
+
+func TestResilientMakeSearch(t *testing.T) {
+	var (
+		unavailable     = &search.StatusError{StatusCode: 503}
+		tooManyRequests = &search.StatusError{StatusCode: 429}
+		serverError     = &search.StatusError{StatusCode: 500}
+		badRequest      = &search.StatusError{StatusCode: 400}
+	)
+
+	tests := []struct {
+		name     string
+		errs     []error
+		canceled bool
+		calls    int
+		err      error
+		state    resilience.State
+	}{
+		{"success", []error{nil}, false, 1, nil, resilience.Closed},
+		{"transient failure retried", []error{unavailable, nil}, false, 2, nil, resilience.Closed},
+		{"attempts exhausted", []error{unavailable}, false, 3, unavailable, resilience.Open},
+		{"too many requests", []error{tooManyRequests}, false, 3, tooManyRequests, resilience.Open},
+		{"server error not retried", []error{serverError}, false, 1, serverError, resilience.Open},
+		{"undecodable response", []error{search.ErrDecodingJSON}, false, 1, search.ErrDecodingJSON, resilience.Open},
+		{"bad request", []error{badRequest}, false, 1, badRequest, resilience.Closed},
+		{"no hits", []error{search.ErrNoHits}, false, 1, search.ErrNoHits, resilience.Closed},
+		{"canceled", []error{nil}, true, 1, context.Canceled, resilience.Closed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scriptedSearcher{errs: tt.errs}
+
+			r := NewResilient(slog.New(slog.NewTextHandler(io.Discard, nil)), utils.Config{
+				Resilience: utils.Resilience{
+					Retry:   utils.Retry{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second},
+					Breaker: utils.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Minute},
+				},
+			}, s)
+
+			var delays []time.Duration
+			r.sleep = func(_ context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.canceled {
+				cancel()
+			}
+			defer cancel()
+
+			_, err := r.MakeSearch(ctx, ssv1.MakeSearchRequest{SearchFor: "apple"})
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("MakeSearch() error = %v, want %v", err, tt.err)
+			}
+			if s.calls != tt.calls || len(delays) != tt.calls-1 {
+				t.Errorf("Searcher called %d times with %d backoffs, want %d calls", s.calls, len(delays), tt.calls)
+			}
+			for _, d := range delays {
+				if d < 0 || d > time.Second {
+					t.Errorf("backoff = %s, want within [0, 1s]", d)
+				}
+			}
+			if got := r.breaker.State(); got != tt.state {
+				t.Errorf("breaker state = %s, want %s", got, tt.state)
+			}
+
+			// An open breaker fails the following searches fast.
+			if tt.state == resilience.Open {
+				_, err = r.MakeSearch(context.Background(), ssv1.MakeSearchRequest{SearchFor: "apple"})
+				if !errors.Is(err, resilience.ErrCircuitOpen) || s.calls != tt.calls {
+					t.Errorf("MakeSearch() error = %v after %d calls, want %v without a call", err, s.calls, resilience.ErrCircuitOpen)
+				}
+			}
+		})
+	}
+}
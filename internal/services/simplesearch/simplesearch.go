@@ -2,10 +2,22 @@ package simplesearch
 
 import (
 	"context"
+	"expvar"
 	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	"github.com/xoticdsign/go-simplesearch/internal/lib/tracing"
+	"github.com/xoticdsign/go-simplesearch/internal/services/diskindex"
 	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/services/memory"
+	"github.com/xoticdsign/go-simplesearch/internal/services/opensearch"
 	"github.com/xoticdsign/go-simplesearch/internal/utils"
 )
 
@@ -14,48 +26,266 @@ const op = "service.SimpleSearch."
 // Service struct represents the SimpleSearch service.
 //
 // It contains the necessary dependencies such as the Searcher (interface for search engines),
-// logger for logging, and configuration settings.
+// the Cache of the search results, logger for logging, and configuration settings. The search timeout
+// and the cache switch are kept apart from the config, so they can be swapped atomically on reload.
+// The config itself is accessed only by Reload, which isn't called concurrently.
 type Service struct {
 	Search Searcher
+	Cache  Cache
+
+	log          *slog.Logger
+	config       utils.Config
+	timeout      atomic.Int64
+	cacheEnabled atomic.Bool
+	fallback     atomic.Pointer[[]search.Product]
+	flight       singleflight.Group
+}
 
-	log    *slog.Logger
-	config utils.Config
+// Metrics of the searches, published with expvar.
+var searchMetrics = expvar.NewMap("simplesearch.search")
+
+// Result struct represents the outcome of a search, along with how it was served.
+//
+// Degraded results are served when the search engine is unavailable: the stale results of the same search
+// or the fallback products.
+type Result struct {
+	Products    []search.Product
+	CacheStatus CacheStatus
+	Degraded    bool
 }
 
 // Searcher interface defines the contract for search engines used by the SimpleSearch service.
 //
 // It has a method 'MakeSearch' that takes a request object and returns search results (as Product structs) and an error.
 type Searcher interface {
-	MakeSearch(req ssv1.MakeSearchRequest) ([]search.Product, error)
+	MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error)
+}
+
+// Reloader interface is implemented by the components that can apply a new config without restarting.
+type Reloader interface {
+	Reload(cfg utils.Config)
+}
+
+// HealthReporter interface is implemented by the Searchers that can report the health of their nodes.
+type HealthReporter interface {
+	Health() []search.NodeHealth
 }
 
 // New initializes and returns a new instance of the SimpleSearch service.
 //
-// It creates a new search engine client (such as Elasticsearch) and passes the logger and configuration settings.
+// It creates a new search engine client (Elasticsearch, OpenSearch, the in-memory one or the on-disk index, as configured) and passes the logger
+// and configuration settings.
+// The client is wrapped with the retries and the circuit breaker, the results are cached in memory.
 func New(log *slog.Logger, cfg utils.Config) (*Service, error) {
-	search, err := search.New(log, cfg)
+	searcher, err := newSearcher(log, cfg)
 	if err != nil {
 		return &Service{}, err
 	}
 
-	return &Service{
-		Search: search,
+	fallback, err := loadFallback(cfg.Search.Fallback.File)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	s := &Service{
+		Search: NewResilient(log, cfg, searcher),
+		Cache:  NewLRU(cfg),
 
 		log:    log,
 		config: cfg,
-	}, nil
+	}
+	s.timeout.Store(int64(cfg.Search.Timeout))
+	s.cacheEnabled.Store(cfg.Search.Cache.Enabled)
+	s.fallback.Store(&fallback)
+
+	return s, nil
+}
+
+// Creates the search engine client for the configured backend: Elasticsearch, OpenSearch, the in-memory one or the on-disk index.
+func newSearcher(log *slog.Logger, cfg utils.Config) (Searcher, error) {
+	switch cfg.Backend.Type {
+	case "opensearch":
+		return opensearch.New(log, cfg)
+	case "memory":
+		return memory.New(log, cfg)
+	case "disk":
+		return diskindex.New(log, cfg)
+	default:
+		return search.New(log, cfg)
+	}
+}
+
+// Reload applies the reloadable settings of the new config to the service, its Searcher and its Cache.
+//
+// The cached results are kept, unless the ranking changed: they may not match it anymore, so they are expired,
+// kept only as stale for the stale-if-error period, or purged if the Cache can't expire them. The fallback products
+// are re-read, and the current ones are kept if the file can't be read.
+func (s *Service) Reload(cfg utils.Config) {
+	const fu = "Reload()"
+
+	rankingChanged := cfg.Ranking != s.config.Ranking
+	s.config = s.config.WithReloadable(cfg)
+
+	s.timeout.Store(int64(cfg.Search.Timeout))
+	s.cacheEnabled.Store(cfg.Search.Cache.Enabled)
+
+	fallback, err := loadFallback(cfg.Search.Fallback.File)
+	if err != nil {
+		s.log.Error(
+			"can't load the fallback products, keeping the current ones",
+			slog.String("op", op+fu),
+			slog.String("error", err.Error()),
+		)
+	} else {
+		s.fallback.Store(&fallback)
+	}
+
+	if r, ok := s.Search.(Reloader); ok {
+		r.Reload(cfg)
+	}
+	if r, ok := s.Cache.(Reloader); ok {
+		r.Reload(cfg)
+	}
+
+	if !rankingChanged {
+		return
+	}
+	if c, ok := s.Cache.(ExpiringCache); ok {
+		c.Expire(context.Background())
+	} else {
+		s.Cache.Purge(context.Background())
+	}
+}
+
+// Invalidate drops the cached search results.
+//
+// It must be called whenever the products are written, so the searches don't return the stale results until they expire.
+// The app doesn't write the products itself: the writes made by the migrator are seen once the results expire,
+// within search.cache.ttl, or once the cache is purged through the admin endpoint, which calls it.
+func (s *Service) Invalidate(ctx context.Context) {
+	const fu = "Invalidate()"
+
+	s.Cache.Purge(ctx)
+
+	s.log.Info(
+		"search cache invalidated",
+		slog.String("op", op+fu),
+	)
+}
+
+// Health returns the health of the nodes behind the Searcher.
+//
+// It returns no nodes if the Searcher doesn't track them, e.g. the in-memory one.
+func (s *Service) Health() []search.NodeHealth {
+	if h, ok := s.Search.(HealthReporter); ok {
+		return h.Health()
+	}
+	return []search.NodeHealth{}
 }
 
 // MakeSearch is a method on the SimpleSearch service that performs a search using the provided request.
 //
 // It delegates the search operation to the underlying Searcher interface (e.g., Elasticsearch client).
 // If the search operation is successful, it returns the results, otherwise it returns an error.
-func (s *Service) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error) {
+// The results are served from the cache when possible, and the successful ones are cached.
+//
+// The identical concurrent searches are coalesced: the first one calls the Searcher and the rest wait for
+// its results. The call is detached from the cancellation of the caller that made it and is bounded by the
+// search timeout alone, while every caller stops waiting as soon as its own context is done.
+//
+// When the search fails, the degraded results are served if there are any (see degrade()).
+func (s *Service) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) (Result, error) {
 	const fu = "MakeSearch()"
 
-	result, err := s.Search.MakeSearch(req)
+	ctx, span := tracing.Tracer().Start(ctx, "simplesearch.Service.MakeSearch")
+	defer span.End()
+
+	// The strings of the request may point into the buffers of the HTTP server, which are reused once the caller
+	// returns, while the coalesced search may still be running. So they are copied.
+	req.SearchFor = strings.Clone(req.SearchFor)
+	req.Filters.Category = strings.Clone(req.Filters.Category)
+
+	status := CacheBypass
+	key := CacheKey(req)
+
+	if s.cacheEnabled.Load() {
+		if products, ok := s.Cache.Get(ctx, key); ok {
+			cacheMetrics.Add("hits", 1)
+			span.SetAttributes(
+				attribute.String("simplesearch.cache", string(CacheHit)),
+				attribute.Int("simplesearch.hits", len(products)),
+			)
+
+			return Result{Products: products, CacheStatus: CacheHit}, nil
+		}
+
+		cacheMetrics.Add("misses", 1)
+		status = CacheMiss
+	}
+
+	span.SetAttributes(attribute.String("simplesearch.cache", string(status)))
+
+	var leader bool
+
+	ch := s.flight.DoChan(key, func() (any, error) {
+		leader = true
+
+		return s.search(context.WithoutCancel(ctx), req, key, status)
+	})
+
+	var res singleflight.Result
+
+	select {
+	case <-ctx.Done():
+		span.RecordError(ctx.Err())
+		span.SetStatus(codes.Error, ctx.Err().Error())
+
+		return Result{Products: []search.Product{}, CacheStatus: status}, ctx.Err()
+	case res = <-ch:
+	}
+
+	if !leader {
+		searchMetrics.Add("deduplicated", 1)
+		span.SetAttributes(attribute.Bool("simplesearch.coalesced", true))
+	}
+
+	if res.Err != nil {
+		if degraded, ok := s.degrade(ctx, req, key, res.Err); ok {
+			span.SetAttributes(attribute.Int("simplesearch.hits", len(degraded.Products)))
+
+			return degraded, nil
+		}
+
+		span.RecordError(res.Err)
+		span.SetStatus(codes.Error, res.Err.Error())
+
+		return Result{Products: []search.Product{}, CacheStatus: status}, res.Err
+	}
+
+	result := res.Val.([]search.Product)
+
+	span.SetAttributes(attribute.Int("simplesearch.hits", len(result)))
+
+	return Result{Products: result, CacheStatus: status}, nil
+}
+
+// Calls the Searcher within the search timeout and caches the results on a cache miss.
+func (s *Service) search(ctx context.Context, req ssv1.MakeSearchRequest, key string, status CacheStatus) ([]search.Product, error) {
+	if timeout := time.Duration(s.timeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := s.Search.MakeSearch(ctx, req)
 	if err != nil {
 		return []search.Product{}, err
 	}
+
+	if status == CacheMiss {
+		s.Cache.Set(ctx, key, result)
+	}
+
 	return result, nil
 }
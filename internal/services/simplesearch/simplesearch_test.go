@@ -0,0 +1,194 @@
+package simplesearch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/xoticdsign/go-simplesearch/https/simplesearch/ssv1"
+	search "github.com/xoticdsign/go-simplesearch/internal/services/elasticsearch"
+	"github.com/xoticdsign/go-simplesearch/internal/utils"
+)
+
+// Searcher returning the set products or error, and counting the calls. When release is set, every call
+// signals started and blocks until release is closed. The search text is recorded when the call returns.
+type fakeSearcher struct {
+	mu       sync.Mutex
+	calls    int
+	seen     []string
+	products []search.Product
+	err      error
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func (f *fakeSearcher) MakeSearch(ctx context.Context, req ssv1.MakeSearchRequest) ([]search.Product, error) {
+	f.mu.Lock()
+	f.calls++
+	started, release := f.started, f.release
+	f.mu.Unlock()
+
+	if release != nil {
+		started <- struct{}{}
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return []search.Product{}, ctx.Err()
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seen = append(f.seen, req.SearchFor)
+	if f.err != nil {
+		return []search.Product{}, f.err
+	}
+	return f.products, nil
+}
+
+// Makes the following calls return the products or fail with the error.
+func (f *fakeSearcher) set(products []search.Product, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.products, f.err = products, err
+}
+
+// Makes the following calls block until release() is called.
+func (f *fakeSearcher) block() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.started, f.release = make(chan struct{}, 16), make(chan struct{})
+}
+
+func (f *fakeSearcher) unblock() {
+	close(f.release)
+}
+
+func (f *fakeSearcher) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls
+}
+
+func newTestService(t *testing.T, searcher Searcher, cfg utils.Config, fallback []search.Product) *Service {
+	t.Helper()
+
+	s := &Service{
+		Search: searcher,
+		Cache:  NewLRU(cfg),
+
+		log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		config: cfg,
+	}
+	s.timeout.Store(int64(cfg.Search.Timeout))
+	s.cacheEnabled.Store(cfg.Search.Cache.Enabled)
+	s.fallback.Store(&fallback)
+
+	return s
+}
+
+var (
+	macbook = search.Product{Name: "Apple MacBook Air", Category: "laptop", Price: 1199, Stock: 45}
+	iphone  = search.Product{Name: "Apple iPhone", Category: "smartphone", Price: 999, Stock: 0}
+	watch   = search.Product{Name: "Apple Watch", Category: "watch", Price: 399, Stock: 3}
+)
+
+func TestMakeSearchCoalesces(t *testing.T) {
+	ctx := context.Background()
+
+	f := &fakeSearcher{products: []search.Product{macbook}}
+	f.block()
+	s := newTestService(t, f, utils.Config{}, nil)
+
+	req := ssv1.MakeSearchRequest{SearchFor: "apple", Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000}}
+
+	var wg sync.WaitGroup
+
+	results := make([]Result, 5)
+	errs := make([]error, len(results))
+
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.MakeSearch(ctx, req)
+		}()
+	}
+
+	<-f.started
+	// Letting the other callers join the running search.
+	time.Sleep(50 * time.Millisecond)
+	f.unblock()
+	wg.Wait()
+
+	if n := f.count(); n != 1 {
+		t.Fatalf("Searcher called %d times, want once", n)
+	}
+	for i := range results {
+		if errs[i] != nil || len(results[i].Products) != 1 {
+			t.Errorf("MakeSearch() = %+v, %v, want the MacBook", results[i], errs[i])
+		}
+	}
+
+	// A different search isn't coalesced.
+	_, err := s.MakeSearch(ctx, ssv1.MakeSearchRequest{SearchFor: "watch", Filters: req.Filters})
+	if err != nil || f.count() != 2 {
+		t.Fatalf("MakeSearch() = %v with %d calls, want a second call", err, f.count())
+	}
+}
+
+func TestMakeSearchDetached(t *testing.T) {
+	f := &fakeSearcher{products: []search.Product{macbook}}
+	f.block()
+	s := newTestService(t, f, utils.Config{}, nil)
+
+	// The search text points into a buffer that is reused once the caller returns, as the HTTP server does.
+	buf := []byte("apple")
+	req := ssv1.MakeSearchRequest{SearchFor: unsafe.String(&buf[0], len(buf)), Filters: ssv1.MakeSearchRequestFilters{PriceTop: 2000}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		_, err := s.MakeSearch(ctx, req)
+		done <- err
+	}()
+
+	<-f.started
+	cancel()
+
+	// The caller stops waiting as soon as it is canceled.
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("MakeSearch() error = %v, want %v", err, context.Canceled)
+	}
+	copy(buf, "xxxxx")
+
+	// While the search goes on for the others.
+	go func() {
+		res, err := s.MakeSearch(context.Background(), ssv1.MakeSearchRequest{SearchFor: "apple", Filters: req.Filters})
+		if err == nil && len(res.Products) != 1 {
+			err = errors.New("no products")
+		}
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	f.unblock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("MakeSearch() error = %v, want the results of the running search", err)
+	}
+	if f.count() != 1 || len(f.seen) != 1 || f.seen[0] != "apple" {
+		t.Fatalf("Searcher called %d times with %q, want once with the original text", f.count(), f.seen)
+	}
+}
@@ -1,78 +1,518 @@
 package utils
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/secrets"
 )
 
 // Config struct represents the configuration of the application.
 //
 // It holds all necessary configuration parameters such as the host, port, timeouts,
-// service name, and ElasticSearch-related settings.
+// service name, and ElasticSearch-related settings. Every field can be overridden
+// with the environment variable named in its env tag.
 type Config struct {
-	Address      string
-	ReadTimeout  time.Duration `yaml:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout"`
-	IdleTimeout  time.Duration `yaml:"idle_timeout"`
-	ServiceName  string        `yaml:"service_name"`
+	Env          string        `yaml:"env" env:"ENV" env-default:"local"`
+	Address      string        `yaml:"address" env:"ADDRESS" env-default:"0.0.0.0:8080"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" env-default:"10s"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-default:"10s"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-default:"20s"`
+	ServiceName  string        `yaml:"service_name" env:"SERVICE_NAME" env-default:"simplesearch"`
 
-	ElasticSearch ElasticSearch `yaml:"elasticsearch"`
+	Backend       Backend       `yaml:"backend" env-prefix:"BACKEND_"`
+	ElasticSearch ElasticSearch `yaml:"elasticsearch" env-prefix:"ES_"`
+	Search        Search        `yaml:"search" env-prefix:"SEARCH_"`
+	Ranking       Ranking       `yaml:"ranking" env-prefix:"RANKING_"`
+	Resilience    Resilience    `yaml:"resilience" env-prefix:"RESILIENCE_"`
+	RateLimit     RateLimit     `yaml:"rate_limit" env-prefix:"RATE_LIMIT_"`
+	Tracing       Tracing       `yaml:"tracing" env-prefix:"TRACING_"`
+	AccessLog     AccessLog     `yaml:"access_log" env-prefix:"ACCESS_LOG_"`
+	Log           Log           `yaml:"log" env-prefix:"LOG_"`
+	Admin         Admin         `yaml:"admin" env-prefix:"ADMIN_"`
+	Secrets       Secrets       `yaml:"secrets" env-prefix:"SECRETS_"`
+}
+
+// Backend struct represents the settings of the search engine behind the SimpleSearch service.
+//
+// Type is "elasticsearch" (default), "opensearch", "memory" or "disk". The "opensearch" backend connects to an OpenSearch
+// cluster with the settings of the elasticsearch section. The "memory" and "disk" backends search the products loaded
+// from File, in the NDJSON bulk format of the migrations, and need no Elasticsearch. The "memory" one is meant for
+// development and CI, the "disk" one keeps an inverted index in IndexDir, rebuilt whenever File changes, and is meant
+// for small deployments.
+type Backend struct {
+	Type     string `yaml:"type" env:"TYPE" env-default:"elasticsearch"`
+	File     string `yaml:"file" env:"FILE" env-default:"./migrations/elasticsearch/0002_products.ndjson"`
+	IndexDir string `yaml:"index_dir" env:"INDEX_DIR" env-default:"./data/index"`
 }
 
 // ElasticSearch struct represents the ElasticSearch connection settings.
 //
 // It contains the addresses, credentials, and transport-related settings for connecting to ElasticSearch.
+// Only one authentication method is used: the API key, the service token, or the username and password.
+// Address is a single node, kept for compatibility; Addresses lists the nodes of a cluster (ES_ADDRESSES is comma separated).
+// Index is the file of the products index definition (its name, aliases, settings and mappings), shared with the esmigrator.
 type ElasticSearch struct {
-	Address   string
-	Username  string
-	Password  string
-	Transport ESTransport `yaml:"transport"`
+	Address      string      `yaml:"address" env:"ADDRESS"`
+	Addresses    []string    `yaml:"addresses" env:"ADDRESSES" env-separator:","`
+	Username     string      `yaml:"username" env:"USERNAME"`
+	Password     string      `yaml:"password" env:"PASSWORD"`
+	APIKey       string      `yaml:"api_key" env:"API_KEY"`
+	ServiceToken string      `yaml:"service_token" env:"SERVICE_TOKEN"`
+	Index        string      `yaml:"index" env:"INDEX" env-default:"./migrations/indices/products.json"`
+	Discovery    ESDiscovery `yaml:"discovery" env-prefix:"DISCOVERY_"`
+	Transport    ESTransport `yaml:"transport" env-prefix:"TRANSPORT_"`
+}
+
+// Nodes() returns the addresses of all the configured ElasticSearch nodes, without duplicates.
+func (e ElasticSearch) Nodes() []string {
+	var nodes []string
+
+	for _, address := range append([]string{e.Address}, e.Addresses...) {
+		address = strings.TrimSpace(address)
+		if address != "" && !slices.Contains(nodes, address) {
+			nodes = append(nodes, address)
+		}
+	}
+	return nodes
+}
+
+// ESDiscovery struct holds the settings of the node discovery (sniffing).
+//
+// When enabled, the client asks the cluster for its nodes on start, periodically every Interval,
+// and after a node fails to respond, so the nodes added to the cluster are used without a restart.
+type ESDiscovery struct {
+	OnStart   bool          `yaml:"on_start" env:"ON_START"`
+	OnFailure bool          `yaml:"on_failure" env:"ON_FAILURE"`
+	Interval  time.Duration `yaml:"interval" env:"INTERVAL"`
 }
 
 // ESTransport struct represents the transport layer settings for ElasticSearch.
 //
 // It includes TLS settings and timeouts for the transport layer.
 type ESTransport struct {
-	TLS         ESTransportTLS `yaml:"tls"`
-	TLSTimeout  time.Duration  `yaml:"tls_timeout"`
-	IdleTimeout time.Duration  `yaml:"idle_timeout"`
+	TLS         ESTransportTLS `yaml:"tls" env-prefix:"TLS_"`
+	TLSTimeout  time.Duration  `yaml:"tls_timeout" env:"TLS_TIMEOUT" env-default:"10s"`
+	IdleTimeout time.Duration  `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-default:"20s"`
 }
 
 // ESTransportTLS struct holds the TLS settings for ElasticSearch.
 //
-// It specifies whether the connection should ignore insecure TLS settings.
+// It specifies whether the connection should ignore insecure TLS settings, the PEM bundle of the certificate
+// authorities to trust or, instead of it, the SHA-256 fingerprint of a certificate to pin, and the client certificate
+// and key for mTLS.
 type ESTransportTLS struct {
-	Insecure bool `yaml:"tls_insecure"`
+	Insecure    bool   `yaml:"tls_insecure" env:"INSECURE"`
+	CACert      string `yaml:"ca_cert" env:"CA_CERT"`
+	Fingerprint string `yaml:"fingerprint" env:"FINGERPRINT"`
+	ClientCert  string `yaml:"client_cert" env:"CLIENT_CERT"`
+	ClientKey   string `yaml:"client_key" env:"CLIENT_KEY"`
 }
 
-// MustLoadConfig() loads the application configuration from a .yaml file.
+// Search struct represents the settings of the search requests.
 //
-// It takes the environment as an argument to determine the config file to use. If the environment is "production"
-// or "development", it will load respective config files (not implemented yet). If the environment is not recognized,
-// it loads a local config file. The function also retrieves ElasticSearch credentials from environment variables,
-// and sets them into the configuration. If any error occurs during the loading process, it returns an error.
-func MustLoadConfig(envs map[string]string) (Config, error) {
-	var cfg Config
+// Timeout bounds a single search, including all the round trips to the search engine.
+type Search struct {
+	Timeout  time.Duration  `yaml:"timeout" env:"TIMEOUT" env-default:"5s"`
+	Cache    SearchCache    `yaml:"cache" env-prefix:"CACHE_"`
+	Fallback SearchFallback `yaml:"fallback" env-prefix:"FALLBACK_"`
+}
+
+// SearchCache struct holds the settings of the search results cache.
+//
+// The results are kept for TTL, and the least recently used ones are evicted once there are MaxEntries of them.
+// The expired results are kept for StaleIfError more, to be served when the search engine is unavailable.
+//
+// The cache isn't invalidated when the products are written outside the app (e.g. by esmigrator), so the writes
+// are invisible to the cached searches for up to TTL, unless the cache is purged through the admin endpoint.
+type SearchCache struct {
+	Enabled      bool          `yaml:"enabled" env:"ENABLED"`
+	TTL          time.Duration `yaml:"ttl" env:"TTL" env-default:"1m"`
+	MaxEntries   int           `yaml:"max_entries" env:"MAX_ENTRIES" env-default:"1000"`
+	StaleIfError time.Duration `yaml:"stale_if_error" env:"STALE_IF_ERROR"`
+}
 
-	switch envs["env"] {
-	case "production":
-		// TODO
+// SearchFallback struct holds the settings of the results served when the search engine is unavailable
+// and there are no stale results for the search.
+//
+// File is a JSON array of products, e.g. the top in-stock ones. No fallback results are served when it is not set.
+type SearchFallback struct {
+	File string `yaml:"file" env:"FILE"`
+}
 
-	case "development":
-		// TODO
+// Ranking struct represents the relevance settings of the search.
+//
+// The boosts weigh the matches in the respective product fields against each other.
+// A field with a zero boost is not searched at all.
+type Ranking struct {
+	NameBoost        float64 `yaml:"name_boost" env:"NAME_BOOST" env-default:"3"`
+	DescriptionBoost float64 `yaml:"description_boost" env:"DESCRIPTION_BOOST"`
+	CategoryBoost    float64 `yaml:"category_boost" env:"CATEGORY_BOOST"`
+}
 
-	default:
-		err := cleanenv.ReadConfig("./config/local.yaml", &cfg)
+// Resilience struct represents the settings of the retries and the circuit breaker around the search engine.
+type Resilience struct {
+	Retry   Retry          `yaml:"retry" env-prefix:"RETRY_"`
+	Breaker CircuitBreaker `yaml:"breaker" env-prefix:"BREAKER_"`
+}
+
+// Retry struct holds the settings of the retries of the failed searches.
+//
+// MaxAttempts counts the first attempt too, so 1 disables the retries. The delay before each retry is picked
+// at random up to InitialBackoff doubled with every attempt, but not above MaxBackoff.
+type Retry struct {
+	MaxAttempts    int           `yaml:"max_attempts" env:"MAX_ATTEMPTS" env-default:"3"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"INITIAL_BACKOFF" env-default:"100ms"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"MAX_BACKOFF" env-default:"2s"`
+}
+
+// CircuitBreaker struct holds the settings of the circuit breaker.
+//
+// The breaker opens after FailureThreshold consecutive failed searches and fails the searches fast for OpenTimeout,
+// then lets a single search through to check whether the search engine has recovered.
+type CircuitBreaker struct {
+	FailureThreshold int           `yaml:"failure_threshold" env:"FAILURE_THRESHOLD" env-default:"5"`
+	OpenTimeout      time.Duration `yaml:"open_timeout" env:"OPEN_TIMEOUT" env-default:"30s"`
+}
+
+// RateLimit struct represents the settings of the rate limit of the search requests.
+//
+// Every client, identified by its IP address, can make at most Requests searches per Window, the rest are answered
+// with 429 Too Many Requests. Zero Requests disables the limit.
+type RateLimit struct {
+	Requests int           `yaml:"requests" env:"REQUESTS"`
+	Window   time.Duration `yaml:"window" env:"WINDOW" env-default:"1m"`
+}
+
+// Tracing struct represents the OpenTelemetry tracing settings.
+//
+// Exporter selects where the spans are sent: "none" (default), "stdout", "file" or "otlp".
+// File is used by the "file" exporter, Endpoint and Insecure by the "otlp" exporter.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"EXPORTER" env-default:"none"`
+	File        string  `yaml:"file" env:"FILE" env-default:"./traces.json"`
+	Endpoint    string  `yaml:"endpoint" env:"ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"SAMPLE_RATIO" env-default:"1"`
+}
+
+// AccessLog struct represents the access logging settings.
+//
+// When RedactQuery is set, the raw search text is left out of the access log and only its length is logged.
+type AccessLog struct {
+	Enabled     bool `yaml:"enabled" env:"ENABLED"`
+	RedactQuery bool `yaml:"redact_query" env:"REDACT_QUERY"`
+}
+
+// Log struct represents the logger settings.
+//
+// Level is one of "debug", "info", "warn" or "error". Sampling limits how many identical error logs
+// are written per interval, the rest are dropped and counted. DebugTTL and DebugOpPrefix describe the
+// temporary debug level switched on with SIGUSR1.
+type Log struct {
+	Level         string        `yaml:"level" env:"LEVEL"`
+	Sampling      LogSampling   `yaml:"sampling" env-prefix:"SAMPLING_"`
+	DebugTTL      time.Duration `yaml:"debug_ttl" env:"DEBUG_TTL" env-default:"5m"`
+	DebugOpPrefix string        `yaml:"debug_op_prefix" env:"DEBUG_OP_PREFIX"`
+}
+
+// LogSampling struct holds the sampling settings for repetitive error logs.
+//
+// At most Burst records with the same level, message and op are written per Interval. Zero Burst disables sampling.
+type LogSampling struct {
+	Burst    int           `yaml:"burst" env:"BURST"`
+	Interval time.Duration `yaml:"interval" env:"INTERVAL" env-default:"1s"`
+}
+
+// Admin struct represents the settings of the admin endpoints.
+//
+// The endpoints are served under /admin only when Token is set, and every request must carry it as a bearer token.
+type Admin struct {
+	Token string `yaml:"token" env:"TOKEN"`
+}
+
+// Secrets struct represents the settings of the secret provider.
+//
+// Provider is one of "env" (default), "file" or "encrypted". The "file" provider reads every secret from its own file
+// in Dir, the "encrypted" provider reads all of them from File, encrypted with the key from KeyFile.
+// In every case a NAME_FILE environment variable (e.g. ES_PASSWORD_FILE) takes precedence for the secret NAME.
+type Secrets struct {
+	Provider string `yaml:"provider" env:"PROVIDER" env-default:"env"`
+	Dir      string `yaml:"dir" env:"DIR" env-default:"/run/secrets"`
+	File     string `yaml:"file" env:"FILE"`
+	KeyFile  string `yaml:"key_file" env:"KEY_FILE"`
+}
+
+// Flags struct represents the command-line flags of the application.
+//
+// Env and ConfigPath select the configuration files, the rest override the respective config fields.
+// Empty values mean the flag was not set. Args holds the arguments after the flags, e.g. the esmigrator command.
+type Flags struct {
+	Env        string
+	ConfigPath string
+	Address    string
+	ESAddress  string
+	LogLevel   string
+	Args       []string
+}
+
+// ParseFlags() parses the command-line arguments into Flags.
+//
+// The config path and the environment fall back to the CONFIG_PATH and ENV environment variables, and then
+// to "./config" and "local" respectively.
+func ParseFlags(name string, args []string) (Flags, error) {
+	var f Flags
+
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	set.StringVar(&f.Env, "env", os.Getenv("ENV"), "environment: local, development or production (env ENV)")
+	set.StringVar(&f.ConfigPath, "config", os.Getenv("CONFIG_PATH"), "config directory or file (env CONFIG_PATH)")
+	set.StringVar(&f.Address, "address", "", "listening address, overrides ADDRESS")
+	set.StringVar(&f.ESAddress, "es-address", "", "comma separated Elasticsearch addresses, override ES_ADDRESS and ES_ADDRESSES")
+	set.StringVar(&f.LogLevel, "log-level", "", "log level, overrides LOG_LEVEL")
+
+	err := set.Parse(args)
+	if err != nil {
+		return Flags{}, err
+	}
+
+	f.Args = set.Args()
+
+	if f.Env == "" {
+		f.Env = "local"
+	}
+	if f.ConfigPath == "" {
+		f.ConfigPath = "./config"
+	}
+
+	return f, nil
+}
+
+// MustLoadConfig() loads the application configuration in layers.
+//
+// The layers are applied from the lowest to the highest precedence:
+//   - the defaults from the env-default struct tags;
+//   - base.yaml in the config directory;
+//   - <env>.yaml in the config directory (e.g. production.yaml);
+//   - the environment variables from the env struct tags (e.g. ES_ADDRESS);
+//   - the secrets from the configured secret provider and the NAME_FILE variables;
+//   - the command-line flags.
+//
+// If the config path points to a file instead of a directory, only that file is read. Missing files are skipped,
+// so the application starts with the defaults alone. If any error occurs during the loading process, it returns an error.
+func MustLoadConfig(flags Flags) (Config, error) {
+	var cfg Config
+
+	err := readDefaults(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, path := range configFiles(flags) {
+		err := readYAML(path, &cfg)
 		if err != nil {
 			return Config{}, err
 		}
 	}
 
-	cfg.Address = envs["address"]
-	cfg.ElasticSearch.Address = envs["es_address"]
-	cfg.ElasticSearch.Username = envs["es_username"]
-	cfg.ElasticSearch.Password = envs["es_password"]
+	err = readEnv(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = resolveSecrets(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg.Env = flags.Env
+
+	if flags.Address != "" {
+		cfg.Address = flags.Address
+	}
+	if flags.ESAddress != "" {
+		cfg.ElasticSearch.Address = ""
+		cfg.ElasticSearch.Addresses = strings.Split(flags.ESAddress, ",")
+	}
+	if flags.LogLevel != "" {
+		cfg.Log.Level = flags.LogLevel
+	}
 
 	return cfg, nil
 }
+
+// Returns pointers to the secret fields of the config, keyed by the secret names.
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		"ES_PASSWORD":      &c.ElasticSearch.Password,
+		"ES_API_KEY":       &c.ElasticSearch.APIKey,
+		"ES_SERVICE_TOKEN": &c.ElasticSearch.ServiceToken,
+		"ADMIN_TOKEN":      &c.Admin.Token,
+	}
+}
+
+// SecretValues() returns the non-empty secrets of the config, e.g. to redact them from the logs.
+func (c Config) SecretValues() []string {
+	var values []string
+
+	for _, field := range c.secretFields() {
+		if *field != "" {
+			values = append(values, *field)
+		}
+	}
+	return values
+}
+
+// Fills the secret fields of the config from the configured secret provider.
+//
+// The NAME_FILE environment variables are honoured with every provider and take precedence over it.
+func resolveSecrets(cfg *Config) error {
+	var provider secrets.Provider
+
+	switch cfg.Secrets.Provider {
+	case "", "env":
+		provider = secrets.Env{}
+
+	case "file":
+		provider = secrets.Chain{secrets.Env{}, secrets.File{Dir: cfg.Secrets.Dir}}
+
+	case "encrypted":
+		encrypted, err := secrets.NewEncryptedFile(cfg.Secrets.File, cfg.Secrets.KeyFile)
+		if err != nil {
+			return fmt.Errorf("secrets: %w", err)
+		}
+		provider = secrets.Chain{secrets.Env{}, encrypted}
+
+	default:
+		return fmt.Errorf("secrets.provider: must be one of env, file or encrypted, got %q", cfg.Secrets.Provider)
+	}
+
+	for name, field := range cfg.secretFields() {
+		value, ok, err := provider.Lookup(name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*field = value
+		}
+	}
+	return nil
+}
+
+// Sets the fields of the config to the values of their env-default struct tags.
+//
+// The defaults are the lowest layer, so the values set explicitly in the files, zero values included, override them.
+func readDefaults(cfg *Config) error {
+	v := reflect.ValueOf(cfg).Elem()
+
+	return envFields(v.Type(), nil, "", func(index []int, field reflect.StructField, _ string) error {
+		def, ok := field.Tag.Lookup("env-default")
+		if !ok {
+			return nil
+		}
+
+		err := yaml.Unmarshal([]byte(def), v.FieldByIndex(index).Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("default of %s: %w", field.Name, err)
+		}
+		return nil
+	})
+}
+
+// Overrides the fields of the config with the environment variables that are set.
+//
+// cleanenv also applies the env-default struct tags to the zero fields, which would override the zero values set
+// in the files (e.g. tracing.sample_ratio: 0), so the fields without their variable set are restored afterwards.
+func readEnv(cfg *Config) error {
+	prev := *cfg
+
+	err := cleanenv.ReadEnv(cfg)
+	if err != nil {
+		return err
+	}
+
+	v, p := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(prev)
+
+	return envFields(v.Type(), nil, "", func(index []int, _ reflect.StructField, name string) error {
+		if _, ok := os.LookupEnv(name); !ok {
+			v.FieldByIndex(index).Set(p.FieldByIndex(index))
+		}
+		return nil
+	})
+}
+
+// Calls fn for every field of the struct type read from an environment variable, with its index and the name
+// of the variable, descending into the nested structs with their env-prefix.
+func envFields(t reflect.Type, index []int, prefix string, fn func([]int, reflect.StructField, string) error) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(slices.Clone(index), i)
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok && field.Type.Kind() == reflect.Struct {
+			err := envFields(field.Type, fieldIndex, prefix+field.Tag.Get("env-prefix"), fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		err := fn(fieldIndex, field, prefix+name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the config files to read, in the order of precedence.
+func configFiles(flags Flags) []string {
+	info, err := os.Stat(flags.ConfigPath)
+	if err == nil && !info.IsDir() {
+		return []string{flags.ConfigPath}
+	}
+
+	return []string{
+		filepath.Join(flags.ConfigPath, "base.yaml"),
+		filepath.Join(flags.ConfigPath, flags.Env+".yaml"),
+	}
+}
+
+// Decodes the YAML file on top of the values already in cfg.
+//
+// The fields absent in the file keep their values, which is what makes the layering work. Unknown keys (e.g. typos)
+// are reported as errors. A missing file is not an error.
+func readYAML(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	err = dec.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xoticdsign/go-simplesearch/internal/lib/secrets"
+)
+
+// Writes the file, creating its directory.
+func write(t *testing.T, path string, data string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(data), 0o600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMustLoadConfigLayers(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		local string
+		env   map[string]string
+		flags Flags
+
+		address   string
+		timeout   time.Duration
+		ratio     float64
+		nameBoost float64
+	}{
+		{
+			name:    "defaults",
+			address: "0.0.0.0:8080", timeout: 5 * time.Second, ratio: 1, nameBoost: 3,
+		},
+		{
+			name:    "base file",
+			base:    "address: \"127.0.0.1:1\"\nsearch:\n  timeout: 1s\n",
+			address: "127.0.0.1:1", timeout: time.Second, ratio: 1, nameBoost: 3,
+		},
+		{
+			name:    "explicit zero values",
+			base:    "tracing:\n  sample_ratio: 0\nranking:\n  name_boost: 0\n",
+			address: "0.0.0.0:8080", timeout: 5 * time.Second, ratio: 0, nameBoost: 0,
+		},
+		{
+			name:    "env file over base file",
+			base:    "address: \"127.0.0.1:1\"\nsearch:\n  timeout: 1s\n",
+			local:   "address: \"127.0.0.1:2\"\n",
+			address: "127.0.0.1:2", timeout: time.Second, ratio: 1, nameBoost: 3,
+		},
+		{
+			name:    "env vars over files",
+			base:    "address: \"127.0.0.1:1\"\ntracing:\n  sample_ratio: 0\n",
+			local:   "address: \"127.0.0.1:2\"\n",
+			env:     map[string]string{"ADDRESS": "127.0.0.1:3", "SEARCH_TIMEOUT": "2s", "RANKING_NAME_BOOST": "0"},
+			address: "127.0.0.1:3", timeout: 2 * time.Second, ratio: 0, nameBoost: 0,
+		},
+		{
+			name:    "flags over env vars",
+			local:   "address: \"127.0.0.1:2\"\n",
+			env:     map[string]string{"ADDRESS": "127.0.0.1:3", "TRACING_SAMPLE_RATIO": "0.5"},
+			flags:   Flags{Address: "127.0.0.1:4"},
+			address: "127.0.0.1:4", timeout: 5 * time.Second, ratio: 0.5, nameBoost: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			if tt.base != "" {
+				write(t, filepath.Join(dir, "base.yaml"), tt.base)
+			}
+			if tt.local != "" {
+				write(t, filepath.Join(dir, "local.yaml"), tt.local)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			flags := tt.flags
+			flags.Env, flags.ConfigPath = "local", dir
+
+			cfg, err := MustLoadConfig(flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Address != tt.address || cfg.Search.Timeout != tt.timeout || cfg.Tracing.SampleRatio != tt.ratio || cfg.Ranking.NameBoost != tt.nameBoost {
+				t.Errorf(
+					"MustLoadConfig() = address %s, timeout %s, sample ratio %v, name boost %v, want %s, %s, %v, %v",
+					cfg.Address, cfg.Search.Timeout, cfg.Tracing.SampleRatio, cfg.Ranking.NameBoost,
+					tt.address, tt.timeout, tt.ratio, tt.nameBoost,
+				)
+			}
+		})
+	}
+}
+
+func TestMustLoadConfigUnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "base.yaml"), "adress: \"127.0.0.1:1\"\n")
+
+	_, err := MustLoadConfig(Flags{Env: "local", ConfigPath: dir})
+	if err == nil {
+		t.Error("MustLoadConfig() accepted the unknown key")
+	}
+}
+
+func TestMustLoadConfigSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := hex.DecodeString(key)
+
+	encrypted, err := secrets.Encrypt(raw, map[string]string{"ES_PASSWORD": "encrypted-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, filepath.Join(dir, "key"), key+"\n")
+	write(t, filepath.Join(dir, "secrets.enc"), string(encrypted))
+	write(t, filepath.Join(dir, "password"), "file-password\n")
+	write(t, filepath.Join(dir, "run", "ES_PASSWORD"), "dir-password\n")
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"env var", map[string]string{"ES_PASSWORD": "env-password"}, "env-password", false},
+		{"file variable over env var", map[string]string{"ES_PASSWORD": "env-password", "ES_PASSWORD_FILE": filepath.Join(dir, "password")}, "file-password", false},
+		{"missing file variable", map[string]string{"ES_PASSWORD_FILE": filepath.Join(dir, "missing")}, "", true},
+		{"file provider", map[string]string{"SECRETS_PROVIDER": "file", "SECRETS_DIR": filepath.Join(dir, "run")}, "dir-password", false},
+		{
+			"encrypted provider",
+			map[string]string{"SECRETS_PROVIDER": "encrypted", "SECRETS_FILE": filepath.Join(dir, "secrets.enc"), "SECRETS_KEY_FILE": filepath.Join(dir, "key")},
+			"encrypted-password", false,
+		},
+		{
+			"wrong key",
+			map[string]string{"SECRETS_PROVIDER": "encrypted", "SECRETS_FILE": filepath.Join(dir, "secrets.enc"), "SECRETS_KEY_FILE": filepath.Join(dir, "password")},
+			"", true,
+		},
+		{"unknown provider", map[string]string{"SECRETS_PROVIDER": "vault"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := MustLoadConfig(Flags{Env: "local", ConfigPath: t.TempDir()})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MustLoadConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			if cfg.ElasticSearch.Password != tt.want {
+				t.Errorf("password = %q, want %q", cfg.ElasticSearch.Password, tt.want)
+			}
+		})
+	}
+}
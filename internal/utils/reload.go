@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Sections of the config that can be changed without restarting the application, as dotted yaml paths.
+var reloadable = []string{
+	"search",
+	"ranking",
+	"rate_limit",
+	"log.level",
+}
+
+// Change struct describes a single field that differs between two configs.
+type Change struct {
+	Field      string
+	Old        string
+	New        string
+	Reloadable bool
+}
+
+// String() formats the change for the logs.
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// Diff() returns the fields that differ between the old and the new config.
+//
+// The fields are named by their dotted yaml paths (e.g. "ranking.name_boost"). The secrets are masked,
+// so the changes can be logged as is.
+func Diff(old Config, new Config) []Change {
+	var changes []Change
+
+	diffValues(reflect.ValueOf(old.Masked()), reflect.ValueOf(new.Masked()), "", &changes)
+
+	return changes
+}
+
+// WithReloadable() returns a copy of c with the reloadable sections taken from the new config.
+//
+// The rest of the fields (e.g. the listening address) keep their current values.
+func (c Config) WithReloadable(new Config) Config {
+	c.Search = new.Search
+	c.Ranking = new.Ranking
+	c.RateLimit = new.RateLimit
+	c.Log.Level = new.Log.Level
+
+	return c
+}
+
+// Walks the structs side by side, collecting the leaves that differ.
+func diffValues(old reflect.Value, new reflect.Value, path string, changes *[]Change) {
+	if old.Kind() == reflect.Struct && !isLeafStruct(old.Type()) {
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if name == "-" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+
+			diffValues(old.Field(i), new.Field(i), name, changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(old.Interface(), new.Interface()) {
+		return
+	}
+
+	*changes = append(*changes, Change{
+		Field:      path,
+		Old:        fmt.Sprint(old.Interface()),
+		New:        fmt.Sprint(new.Interface()),
+		Reloadable: isReloadable(path),
+	})
+}
+
+// Reports whether the struct type is compared as a whole rather than field by field.
+func isLeafStruct(t reflect.Type) bool {
+	return t.PkgPath() != reflect.TypeOf(Config{}).PkgPath()
+}
+
+// Reports whether the field at the dotted path belongs to a reloadable section.
+func isReloadable(path string) bool {
+	for _, r := range reloadable {
+		if path == r || strings.HasPrefix(path, r+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Placeholder that replaces the secrets in the masked config.
+const masked = "******"
+
+var (
+	ErrInvalidConfig = fmt.Errorf("invalid config")
+)
+
+// Validate() checks the config and reports all the problems at once.
+//
+// It checks that the required fields are set, the addresses are well-formed, the timeouts are positive
+// and the enumerations hold known values. The returned error wraps ErrInvalidConfig and lists every problem on its own line.
+func (c Config) Validate() error {
+	var problems []string
+
+	add := func(field string, format string, args ...any) {
+		problems = append(problems, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch c.Env {
+	case "local", "development", "production":
+	default:
+		add("env", "must be one of local, development or production, got %q", c.Env)
+	}
+
+	if c.ServiceName == "" {
+		add("service_name", "must be set")
+	}
+
+	if c.Address == "" {
+		add("address", "must be set")
+	} else if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		add("address", "must be host:port, got %q", c.Address)
+	}
+
+	positive(add, "read_timeout", c.ReadTimeout)
+	positive(add, "write_timeout", c.WriteTimeout)
+	positive(add, "idle_timeout", c.IdleTimeout)
+
+	switch c.Backend.Type {
+	case "", "elasticsearch", "opensearch":
+	case "memory", "disk":
+		if c.Backend.File == "" {
+			add("backend.file", "must be set for the %s backend", c.Backend.Type)
+		}
+		readable(add, "backend.file", c.Backend.File)
+		if c.Backend.Type == "disk" && c.Backend.IndexDir == "" {
+			add("backend.index_dir", "must be set for the disk backend")
+		}
+	default:
+		add("backend.type", "must be one of elasticsearch, opensearch, memory or disk, got %q", c.Backend.Type)
+	}
+
+	remote := c.Backend.Type == "" || c.Backend.Type == "elasticsearch" || c.Backend.Type == "opensearch"
+
+	nodes := c.ElasticSearch.Nodes()
+	if len(nodes) == 0 && remote {
+		add("elasticsearch.addresses", "at least one node must be set (ES_ADDRESS or ES_ADDRESSES)")
+	}
+	for _, node := range nodes {
+		if err := validURL(node); err != nil {
+			add("elasticsearch.addresses", "%v", err)
+		}
+	}
+	if remote {
+		if c.ElasticSearch.Index == "" {
+			add("elasticsearch.index", "must be set to the file of the index definition (ES_INDEX)")
+		}
+		readable(add, "elasticsearch.index", c.ElasticSearch.Index)
+	}
+	if c.ElasticSearch.Discovery.Interval < 0 {
+		add("elasticsearch.discovery.interval", "must not be negative, got %s", c.ElasticSearch.Discovery.Interval)
+	}
+	if c.ElasticSearch.Username != "" && c.ElasticSearch.Password == "" {
+		add("elasticsearch.password", "must be set when the username is set (ES_PASSWORD)")
+	}
+
+	methods := 0
+	for _, set := range []bool{c.ElasticSearch.Username != "", c.ElasticSearch.APIKey != "", c.ElasticSearch.ServiceToken != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		add("elasticsearch", "only one of username/password, api_key and service_token can be set")
+	}
+
+	tlsCfg := c.ElasticSearch.Transport.TLS
+
+	readable(add, "elasticsearch.transport.tls.ca_cert", tlsCfg.CACert)
+	readable(add, "elasticsearch.transport.tls.client_cert", tlsCfg.ClientCert)
+	readable(add, "elasticsearch.transport.tls.client_key", tlsCfg.ClientKey)
+
+	if (tlsCfg.ClientCert == "") != (tlsCfg.ClientKey == "") {
+		add("elasticsearch.transport.tls", "client_cert and client_key must be set together")
+	}
+	if tlsCfg.Fingerprint != "" && tlsCfg.CACert != "" {
+		add("elasticsearch.transport.tls", "ca_cert and fingerprint can't be set together, the pinned fingerprint replaces the verification against the CA")
+	}
+	if tlsCfg.Fingerprint != "" {
+		fp := strings.ReplaceAll(tlsCfg.Fingerprint, ":", "")
+
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+			add("elasticsearch.transport.tls.fingerprint", "must be a hex encoded SHA-256 fingerprint")
+		}
+	}
+
+	positive(add, "elasticsearch.transport.tls_timeout", c.ElasticSearch.Transport.TLSTimeout)
+	positive(add, "elasticsearch.transport.idle_timeout", c.ElasticSearch.Transport.IdleTimeout)
+
+	positive(add, "search.timeout", c.Search.Timeout)
+	if c.Search.Cache.Enabled {
+		positive(add, "search.cache.ttl", c.Search.Cache.TTL)
+		if c.Search.Cache.MaxEntries < 1 {
+			add("search.cache.max_entries", "must be at least 1, got %d", c.Search.Cache.MaxEntries)
+		}
+	}
+	if c.Search.Cache.StaleIfError < 0 {
+		add("search.cache.stale_if_error", "must not be negative, got %v", c.Search.Cache.StaleIfError)
+	}
+	readable(add, "search.fallback.file", c.Search.Fallback.File)
+
+	if c.Ranking.NameBoost < 0 || c.Ranking.DescriptionBoost < 0 || c.Ranking.CategoryBoost < 0 {
+		add("ranking", "the boosts must not be negative")
+	}
+	if c.Ranking.NameBoost == 0 && c.Ranking.DescriptionBoost == 0 && c.Ranking.CategoryBoost == 0 {
+		add("ranking", "at least one field must have a positive boost")
+	}
+
+	if c.Resilience.Retry.MaxAttempts < 1 {
+		add("resilience.retry.max_attempts", "must be at least 1, got %d", c.Resilience.Retry.MaxAttempts)
+	}
+	positive(add, "resilience.retry.initial_backoff", c.Resilience.Retry.InitialBackoff)
+	positive(add, "resilience.retry.max_backoff", c.Resilience.Retry.MaxBackoff)
+	if c.Resilience.Retry.MaxBackoff < c.Resilience.Retry.InitialBackoff {
+		add("resilience.retry.max_backoff", "must not be less than initial_backoff")
+	}
+	if c.Resilience.Breaker.FailureThreshold < 1 {
+		add("resilience.breaker.failure_threshold", "must be at least 1, got %d", c.Resilience.Breaker.FailureThreshold)
+	}
+	positive(add, "resilience.breaker.open_timeout", c.Resilience.Breaker.OpenTimeout)
+
+	if c.RateLimit.Requests < 0 {
+		add("rate_limit.requests", "must not be negative, got %d", c.RateLimit.Requests)
+	}
+	if c.RateLimit.Requests > 0 {
+		positive(add, "rate_limit.window", c.RateLimit.Window)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			add("tracing.file", "must be set for the file exporter")
+		}
+	case "otlp":
+	default:
+		add("tracing.exporter", "must be one of none, stdout, file or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Log.Level != "" {
+		var level slog.Level
+
+		if err := level.UnmarshalText([]byte(strings.ToUpper(c.Log.Level))); err != nil {
+			add("log.level", "must be one of debug, info, warn or error, got %q", c.Log.Level)
+		}
+	}
+	if c.Log.Sampling.Burst < 0 {
+		add("log.sampling.burst", "must not be negative")
+	}
+	if c.Log.Sampling.Burst > 0 {
+		positive(add, "log.sampling.interval", c.Log.Sampling.Interval)
+	}
+	positive(add, "log.debug_ttl", c.Log.DebugTTL)
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w:\n  %s", ErrInvalidConfig, strings.Join(problems, "\n  "))
+}
+
+// Masked() returns a copy of the config with the secrets replaced by a placeholder.
+//
+// It is used to print the effective config without leaking the credentials.
+func (c Config) Masked() Config {
+	for _, field := range c.secretFields() {
+		if *field != "" {
+			*field = masked
+		}
+	}
+	return c
+}
+
+// Reports a problem if the duration is not positive.
+func positive(add func(string, string, ...any), field string, d time.Duration) {
+	if d <= 0 {
+		add(field, "must be a positive duration, got %v", d)
+	}
+}
+
+// Reports a problem if the file is set but can't be read.
+func readable(add func(string, string, ...any), field string, path string) {
+	if path == "" {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		add(field, "can't read %q: %v", path, errors.Unwrap(err))
+		return
+	}
+	f.Close()
+}
+
+// Checks that the address is an absolute http(s) URL.
+func validURL(address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return errors.New("must be a valid URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL, got %q", address)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("must have a host, got %q", address)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a valid config, with the defaults and the index definition of the repo.
+func validConfig(t *testing.T) Config {
+	t.Helper()
+
+	cfg, err := MustLoadConfig(Flags{Env: "local", ConfigPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.ElasticSearch.Address = "http://localhost:9200"
+	cfg.ElasticSearch.Index = "../../migrations/indices/products.json"
+
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*Config)
+		problems []string
+	}{
+		{"valid", func(*Config) {}, nil},
+		{"no node", func(c *Config) { c.ElasticSearch.Address = "" }, []string{"elasticsearch.addresses"}},
+		{"memory backend without node", func(c *Config) {
+			c.ElasticSearch.Address = ""
+			c.Backend = Backend{Type: "memory", File: "../../migrations/elasticsearch/0002_products.ndjson"}
+		}, nil},
+		{"zero sample ratio", func(c *Config) { c.Tracing.SampleRatio = 0 }, nil},
+		{"sample ratio", func(c *Config) { c.Tracing.SampleRatio = 2 }, []string{"tracing.sample_ratio"}},
+		{"fingerprint with ca cert", func(c *Config) {
+			c.ElasticSearch.Transport.TLS.CACert = "../../migrations/indices/products.json"
+			c.ElasticSearch.Transport.TLS.Fingerprint = strings.Repeat("ab", 32)
+		}, []string{"elasticsearch.transport.tls:"}},
+		{"two auth methods", func(c *Config) {
+			c.ElasticSearch.Username, c.ElasticSearch.Password, c.ElasticSearch.APIKey = "elastic", "changeme", "key"
+		}, []string{"elasticsearch:"}},
+		{"all problems at once", func(c *Config) {
+			c.Env = "staging"
+			c.Address = "8080"
+			c.Search.Timeout = 0
+			c.Ranking = Ranking{}
+			c.ElasticSearch.Transport.TLS.Fingerprint = "zz"
+			c.Resilience.Retry.MaxBackoff = time.Millisecond
+		}, []string{
+			"env", "address", "elasticsearch.transport.tls.fingerprint", "search.timeout", "ranking", "resilience.retry.max_backoff",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+
+			if tt.problems == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("Validate() = %v, want %v", err, ErrInvalidConfig)
+			}
+
+			lines := strings.Split(err.Error(), "\n")[1:]
+			if len(lines) != len(tt.problems) {
+				t.Fatalf("Validate() reported %d problems, want %d:\n%v", len(lines), len(tt.problems), err)
+			}
+			for i, field := range tt.problems {
+				if !strings.HasPrefix(strings.TrimSpace(lines[i]), field) {
+					t.Errorf("problem %d = %q, want one about %s", i, lines[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestMasked(t *testing.T) {
+	cfg := Config{
+		ElasticSearch: ElasticSearch{Username: "elastic", Password: "changeme"},
+		Admin:         Admin{Token: "token"},
+	}
+
+	m := cfg.Masked()
+
+	if m.ElasticSearch.Password != masked || m.Admin.Token != masked {
+		t.Errorf("Masked() = %+v, want the secrets masked", m)
+	}
+	if m.ElasticSearch.APIKey != "" || m.ElasticSearch.Username != "elastic" {
+		t.Errorf("Masked() = %+v, want the unset secrets and the username kept", m)
+	}
+	if cfg.ElasticSearch.Password != "changeme" {
+		t.Error("Masked() changed the original config")
+	}
+}